@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/joho/godotenv"
@@ -26,23 +29,117 @@ type RedisConfig struct {
 	Password string
 }
 
-type ServiceConfig struct {
-	DefaultHealthCheckURL     string
-	FallbackHealthCheckURL    string
-	DefaultProcessPaymentURL  string
-	FallbackProcessPaymentURL string
+// ProcessorConfig is one payment processor of the registry. Lower Priority
+// is preferred; Timeout bounds each payment call, in milliseconds.
+type ProcessorConfig struct {
+	Name              string
+	ProcessPaymentURL string
+	HealthCheckURL    string
+	FeeRate           float64
+	Priority          int
+	Timeout           int
+}
+
+// WebhookConfig configures completion webhooks. They are disabled without a
+// Secret. Callbacks may only reach AllowedHosts, when set, and never an
+// address in DeniedNetworks.
+type WebhookConfig struct {
+	Secret         string
+	AllowedHosts   []string
+	DeniedNetworks []string
+	KeyPrefix      string
+	ScheduleKey    string
+	MaxAttempts    int
+	BackoffBaseMs  int
+	BackoffMaxMs   int
+	TimeoutMs      int
+	PollInterval   int
+	RetentionSecs  int
+}
+
+// AdmissionConfig holds the intake load-shedding thresholds; a threshold of 0
+// is disabled. The shed lists name the priorities rejected at each level.
+type AdmissionConfig struct {
+	CheckInterval    int
+	ThrottleLag      int
+	ThrottleOldestMs int
+	OverloadLag      int
+	OverloadOldestMs int
+	ThrottleShed     []string
+	OverloadShed     []string
+}
+
+// CircuitBreakerConfig holds the per-processor circuit breaker settings and
+// where opened and closed breakers are shared.
+type CircuitBreakerConfig struct {
+	FailureThreshold int
+	OpenMs           int
+	HalfOpenProbes   int
+	KeyPrefix        string
+	Channel          string
 }
 
 type Config struct {
-	Database                      DatabaseConfig
-	Services                      ServiceConfig
-	Redis                         RedisConfig
-	Queue                         string
-	SetQueue                      string
-	DQLQueue                      string
-	RedisDefaultServiceStatuskey  string
-	RedisFallbackServiceStatuskey string
-	ShouldPersistInDB             bool
+	Database                DatabaseConfig
+	Processors              []ProcessorConfig
+	Redis                   RedisConfig
+	Queue                   string
+	QueueBackend            string
+	PriorityLanes           string
+	QueuePartitions         int
+	RoutingStrategy         string
+	RoutingWeights          []string
+	RoutingLatencyPenalty   float64
+	PartitionMembersKey     string
+	PartitionHeartbeat      int
+	PartitionMemberTTL      int
+	PriorityHighAmount      string
+	PriorityLowAmount       string
+	SetQueue                string
+	DQLQueue                string
+	RetryQueue              string
+	RedisProcessorStatusKey string
+	ProcessorStatusChannel  string
+	ProcessorStatusMaxAge   int
+	HealthPollInterval      int
+	HealthLeaseTTL          int
+	HealthLeasePrefix       string
+	RedisScoreKey           string
+	ConsumerGroup           string
+	AdminToken              string
+	PaymentStatusPrefix     string
+	PaymentStatusTTL        int
+	IdempotencyPrefix       string
+	IdempotencyWindow       int
+	BatchMaxItems           int
+	BatchMaxBytes           int
+	GRPCStreamMaxItems      int
+	QueueMaxLength          int
+	IntakeRetryAfter        int
+	SpoolEnabled            bool
+	SpoolDir                string
+	SpoolReplayInterval     int
+	ClaimMinIdle            int
+	MaxAttempts             int
+	RetryBackoffBaseMs      int
+	RetryBackoffMaxMs       int
+	RetryPollInterval       int
+	RetentionInterval       int
+	DQLMaxLength            int
+	SummaryCompactAfter     int
+	SummaryRetention        int
+	MemoryHighWatermark     int
+	MemoryCheckInterval     int
+	ClaimInterval           int
+	WorkersMin              int
+	WorkersMax              int
+	AutoscaleInterval       int
+	AutoscaleDrainTarget    int
+	GRPCPort                string
+	Webhooks                WebhookConfig
+	Admission               AdmissionConfig
+	CircuitBreaker          CircuitBreakerConfig
+	ShouldPersistInDB       bool
 }
 
 var (
@@ -65,32 +162,211 @@ func LoadConfig() *Config {
 				Username: getEnv("DB_USER", "postgres"),
 				Password: getEnv("DB_PASSWORD", "postgres"),
 			},
-			Services: ServiceConfig{
-				DefaultHealthCheckURL:     getEnv("DEFAULT_HEALTH_CHECK_URL", "http://localhost:8001/payments/service-health"),
-				FallbackHealthCheckURL:    getEnv("FALLBACK_HEALTH_CHECK_URL", "http://localhost:8002/payments/service-health"),
-				DefaultProcessPaymentURL:  getEnv("DEFAULT_PROCESS_PAYMENT_URL", "http://localhost:8001/payments"),
-				FallbackProcessPaymentURL: getEnv("FALLBACK_PROCESS_PAYMENT_URL", "http://localhost:8002/payments"),
-			},
+			Processors: loadProcessors(),
 			Redis: RedisConfig{
 				Host:     getEnv("REDIS_HOST", "localhost"),
 				Port:     getEnv("REDIS_PORT", "6379"),
 				Password: getEnv("REDIS_PASSWORD", ""),
 			},
-			Queue:                         getEnv("QUEUE_NAME", "payments"),
-			DQLQueue:                      getEnv("DQL_QUEUE_NAME", "dql_payments"),
-			SetQueue:                      getEnv("SET_QUEUE_NAME", "processed_payments"),
-			RedisDefaultServiceStatuskey:  getEnv("REDIS_DEFAULT_SERVICE_STATUS_KEY", "default_service_status"),
-			RedisFallbackServiceStatuskey: getEnv("REDIS_FALLBACK_SERVICE_STATUS_KEY", "fallback_service_status"),
-			ShouldPersistInDB:             parseBool(getEnv("SHOULD_PERSIST_IN_DB", "false")),
+			Queue:                   getEnv("QUEUE_NAME", "payments"),
+			QueueBackend:            getEnv("QUEUE_BACKEND", "redis"),
+			PriorityLanes:           getEnv("PRIORITY_LANES", ""),
+			QueuePartitions:         parseInt(getEnv("QUEUE_PARTITIONS", "1"), 1),
+			RoutingStrategy:         getEnv("ROUTING_STRATEGY", "max-profit"),
+			RoutingWeights:          parseList(getEnv("ROUTING_WEIGHTS", "default:1,fallback:1")),
+			RoutingLatencyPenalty:   parseFloat(getEnv("ROUTING_LATENCY_PENALTY", "0.05"), 0.05),
+			PartitionMembersKey:     getEnv("PARTITION_MEMBERS_KEY", "queue_members"),
+			PartitionHeartbeat:      parseInt(getEnv("PARTITION_HEARTBEAT_MS", "1000"), 1000),
+			PartitionMemberTTL:      parseInt(getEnv("PARTITION_MEMBER_TTL_MS", "5000"), 5000),
+			PriorityHighAmount:      getEnv("PRIORITY_HIGH_AMOUNT", ""),
+			PriorityLowAmount:       getEnv("PRIORITY_LOW_AMOUNT", ""),
+			DQLQueue:                getEnv("DQL_QUEUE_NAME", "dql_payments"),
+			RetryQueue:              getEnv("RETRY_QUEUE_NAME", "payments_retry"),
+			SetQueue:                getEnv("SET_QUEUE_NAME", "processed_payments"),
+			RedisProcessorStatusKey: getEnv("REDIS_PROCESSOR_STATUS_KEY", "processor_status"),
+			ProcessorStatusChannel:  getEnv("PROCESSOR_STATUS_CHANNEL", "processor_status"),
+			ProcessorStatusMaxAge:   parseInt(getEnv("PROCESSOR_STATUS_MAX_AGE_MS", "15000"), 15000),
+			HealthPollInterval:      parseInt(getEnv("HEALTH_POLL_INTERVAL_MS", "5000"), 5000),
+			HealthLeaseTTL:          parseInt(getEnv("HEALTH_LEASE_MS", "12000"), 12000),
+			HealthLeasePrefix:       getEnv("HEALTH_LEASE_PREFIX", "health_poll_lease:"),
+			RedisScoreKey:           getEnv("REDIS_SCORE_KEY", "score"),
+			ConsumerGroup:           getEnv("CONSUMER_GROUP", "payment-group"),
+			AdminToken:              getEnv("ADMIN_TOKEN", ""),
+			PaymentStatusPrefix:     getEnv("PAYMENT_STATUS_PREFIX", "payment_status:"),
+			PaymentStatusTTL:        parseInt(getEnv("PAYMENT_STATUS_TTL_SECONDS", "3600"), 3600),
+			IdempotencyPrefix:       getEnv("IDEMPOTENCY_PREFIX", "idempotency:"),
+			IdempotencyWindow:       parsePositiveInt(getEnv("IDEMPOTENCY_WINDOW_SECONDS", "3600"), 3600),
+			BatchMaxItems:           parseInt(getEnv("BATCH_MAX_ITEMS", "5000"), 5000),
+			BatchMaxBytes:           parseInt(getEnv("BATCH_MAX_BYTES", "2097152"), 2097152),
+			GRPCStreamMaxItems:      parseInt(getEnv("GRPC_STREAM_MAX_ITEMS", "50000"), 50000),
+			QueueMaxLength:          parseInt(getEnv("QUEUE_MAX_LENGTH", "0"), 0),
+			IntakeRetryAfter:        parseInt(getEnv("INTAKE_RETRY_AFTER_SECONDS", "1"), 1),
+			SpoolEnabled:            parseBool(getEnv("SPOOL_ENABLED", "true")),
+			SpoolDir:                getEnv("SPOOL_DIR", "/tmp/payment-spool"),
+			SpoolReplayInterval:     parseInt(getEnv("SPOOL_REPLAY_INTERVAL_MS", "1000"), 1000),
+			ClaimMinIdle:            parseInt(getEnv("CLAIM_MIN_IDLE_MS", "5000"), 5000),
+			MaxAttempts:             parseInt(getEnv("MAX_ATTEMPTS", "5"), 5),
+			RetryBackoffBaseMs:      parseInt(getEnv("RETRY_BACKOFF_BASE_MS", "100"), 100),
+			RetryBackoffMaxMs:       parseInt(getEnv("RETRY_BACKOFF_MAX_MS", "10000"), 10000),
+			RetryPollInterval:       parseInt(getEnv("RETRY_POLL_INTERVAL_MS", "100"), 100),
+			RetentionInterval:       parseInt(getEnv("RETENTION_INTERVAL_MS", "5000"), 5000),
+			DQLMaxLength:            parseInt(getEnv("DQL_MAX_LENGTH", "10000"), 10000),
+			SummaryCompactAfter:     parseInt(getEnv("SUMMARY_COMPACT_AFTER_SECONDS", "120"), 120),
+			SummaryRetention:        parseInt(getEnv("SUMMARY_RETENTION_SECONDS", "0"), 0),
+			MemoryHighWatermark:     parseInt(getEnv("MEMORY_HIGH_WATERMARK_PERCENT", "85"), 85),
+			MemoryCheckInterval:     parseInt(getEnv("MEMORY_CHECK_INTERVAL_MS", "1000"), 1000),
+			ClaimInterval:           parseInt(getEnv("CLAIM_INTERVAL_MS", "1000"), 1000),
+			WorkersMin:              parseInt(getEnv("WORKERS_MIN", "4"), 4),
+			WorkersMax:              parseInt(getEnv("WORKERS_MAX", "32"), 32),
+			AutoscaleInterval:       parseInt(getEnv("AUTOSCALE_INTERVAL_MS", "1000"), 1000),
+			AutoscaleDrainTarget:    parseInt(getEnv("AUTOSCALE_DRAIN_TARGET_MS", "1000"), 1000),
+			GRPCPort:                getEnv("GRPC_PORT", "9090"),
+			Webhooks: WebhookConfig{
+				Secret:       getEnv("WEBHOOK_SECRET", ""),
+				AllowedHosts: parseList(getEnv("WEBHOOK_ALLOWED_HOSTS", "")),
+				DeniedNetworks: parseList(getEnv("WEBHOOK_DENIED_NETWORKS",
+					"0.0.0.0/8,10.0.0.0/8,100.64.0.0/10,127.0.0.0/8,169.254.0.0/16,172.16.0.0/12,192.168.0.0/16,::1/128,fc00::/7,fe80::/10")),
+				KeyPrefix:     getEnv("WEBHOOK_KEY_PREFIX", "webhook:"),
+				ScheduleKey:   getEnv("WEBHOOK_SCHEDULE_KEY", "webhook_deliveries"),
+				MaxAttempts:   parseInt(getEnv("WEBHOOK_MAX_ATTEMPTS", "8"), 8),
+				BackoffBaseMs: parseInt(getEnv("WEBHOOK_BACKOFF_BASE_MS", "500"), 500),
+				BackoffMaxMs:  parseInt(getEnv("WEBHOOK_BACKOFF_MAX_MS", "60000"), 60000),
+				TimeoutMs:     parseInt(getEnv("WEBHOOK_TIMEOUT_MS", "2000"), 2000),
+				PollInterval:  parseInt(getEnv("WEBHOOK_POLL_INTERVAL_MS", "500"), 500),
+				RetentionSecs: parseInt(getEnv("WEBHOOK_RETENTION_SECONDS", "86400"), 86400),
+			},
+			Admission: AdmissionConfig{
+				CheckInterval:    parseInt(getEnv("ADMISSION_CHECK_INTERVAL_MS", "250"), 250),
+				ThrottleLag:      parseInt(getEnv("ADMISSION_THROTTLE_LAG", "5000"), 5000),
+				ThrottleOldestMs: parseInt(getEnv("ADMISSION_THROTTLE_OLDEST_MS", "2000"), 2000),
+				OverloadLag:      parseInt(getEnv("ADMISSION_OVERLOAD_LAG", "20000"), 20000),
+				OverloadOldestMs: parseInt(getEnv("ADMISSION_OVERLOAD_OLDEST_MS", "8000"), 8000),
+				ThrottleShed:     parseList(getEnv("ADMISSION_THROTTLE_SHED", "low")),
+				OverloadShed:     parseList(getEnv("ADMISSION_OVERLOAD_SHED", "low,normal")),
+			},
+			CircuitBreaker: CircuitBreakerConfig{
+				FailureThreshold: parseInt(getEnv("CIRCUIT_FAILURE_THRESHOLD", "5"), 5),
+				OpenMs:           parseInt(getEnv("CIRCUIT_OPEN_MS", "2000"), 2000),
+				HalfOpenProbes:   parseInt(getEnv("CIRCUIT_HALF_OPEN_PROBES", "1"), 1),
+				KeyPrefix:        getEnv("CIRCUIT_BREAKER_PREFIX", "circuit_breaker:"),
+				Channel:          getEnv("CIRCUIT_BREAKER_CHANNEL", "circuit_breaker"),
+			},
+			ShouldPersistInDB: parseBool(getEnv("SHOULD_PERSIST_IN_DB", "false")),
 		}
 	})
 	return config
 }
 
+// Enabled reports whether webhooks can be signed, and so sent at all.
+func (w WebhookConfig) Enabled() bool {
+	return w.Secret != ""
+}
+
+// Processor returns the registry entry called name.
+func (c *Config) Processor(name string) (ProcessorConfig, bool) {
+	for _, processor := range c.Processors {
+		if processor.Name == name {
+			return processor, true
+		}
+	}
+	return ProcessorConfig{}, false
+}
+
+// builtinProcessors are the defaults of the two rinha processors, which keep
+// working without any processor settings.
+var builtinProcessors = map[string]ProcessorConfig{
+	"default": {
+		ProcessPaymentURL: "http://localhost:8001/payments",
+		HealthCheckURL:    "http://localhost:8001/payments/service-health",
+		FeeRate:           0.05,
+		Priority:          0,
+	},
+	"fallback": {
+		ProcessPaymentURL: "http://localhost:8002/payments",
+		HealthCheckURL:    "http://localhost:8002/payments/service-health",
+		FeeRate:           0.15,
+		Priority:          1,
+	},
+}
+
+// loadProcessors reads the registry: PROCESSORS names the processors, and
+// each one is set by <NAME>_PROCESS_PAYMENT_URL, <NAME>_HEALTH_CHECK_URL,
+// <NAME>_FEE_RATE, <NAME>_PRIORITY and <NAME>_TIMEOUT_MS, NAME upper-cased
+// with dashes as underscores. Processors are returned by priority.
+func loadProcessors() []ProcessorConfig {
+	var processors []ProcessorConfig
+	for i, name := range parseList(getEnv("PROCESSORS", "default,fallback")) {
+		defaults, builtin := builtinProcessors[name]
+		if !builtin {
+			defaults.Priority = i
+		}
+		prefix := strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		processor := ProcessorConfig{
+			Name:              name,
+			ProcessPaymentURL: getEnv(prefix+"PROCESS_PAYMENT_URL", defaults.ProcessPaymentURL),
+			HealthCheckURL:    getEnv(prefix+"HEALTH_CHECK_URL", defaults.HealthCheckURL),
+			FeeRate:           parseFloat(getEnv(prefix+"FEE_RATE", strconv.FormatFloat(defaults.FeeRate, 'f', -1, 64)), defaults.FeeRate),
+			Priority:          parseInt(getEnv(prefix+"PRIORITY", strconv.Itoa(defaults.Priority)), defaults.Priority),
+			Timeout:           parseInt(getEnv(prefix+"TIMEOUT_MS", "800"), 800),
+		}
+		if processor.ProcessPaymentURL == "" || processor.HealthCheckURL == "" {
+			log.Fatalf("Processor %q needs %sPROCESS_PAYMENT_URL and %sHEALTH_CHECK_URL", name, prefix, prefix)
+		}
+		processors = append(processors, processor)
+	}
+	if len(processors) == 0 {
+		log.Fatal("PROCESSORS names no payment processor")
+	}
+	sort.SliceStable(processors, func(i, j int) bool {
+		return processors[i].Priority < processors[j].Priority
+	})
+	return processors
+}
+
+// parseList splits a comma separated list, dropping blanks.
+func parseList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 func parseBool(s string) bool {
 	return s == "1" || s == "true" || s == "True" || s == "TRUE"
 }
 
+func parseFloat(s string, defaultValue float64) float64 {
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		log.Printf("Invalid number %q, using default %g", s, defaultValue)
+		return defaultValue
+	}
+	return value
+}
+
+// parsePositiveInt is parseInt for settings that must be above zero, such as
+// key TTLs: Redis rejects an expire time of zero or below.
+func parsePositiveInt(s string, defaultValue int) int {
+	value := parseInt(s, defaultValue)
+	if value <= 0 {
+		log.Printf("Invalid value %d, must be positive, using default %d", value, defaultValue)
+		return defaultValue
+	}
+	return value
+}
+
+func parseInt(s string, defaultValue int) int {
+	value, err := strconv.Atoi(s)
+	if err != nil {
+		log.Printf("Invalid integer %q, using default %d", s, defaultValue)
+		return defaultValue
+	}
+	return value
+}
+
 func (db *DatabaseConfig) ConnectionString() string {
 	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
 		db.Host, db.Port, db.Username, db.Password, db.Database)
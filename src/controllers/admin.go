@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	usecases "payment-processor/use_cases"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AdminController struct {
+	PurgePaymentsUseCase *usecases.PurgePaymentsUseCase
+	WebhookUseCase       *usecases.WebhookUseCase
+	DeadLetterUseCase    *usecases.DeadLetterUseCase
+}
+
+func NewAdminController(
+	purgePaymentsUseCase *usecases.PurgePaymentsUseCase,
+	webhookUseCase *usecases.WebhookUseCase,
+	deadLetterUseCase *usecases.DeadLetterUseCase,
+) *AdminController {
+	return &AdminController{
+		PurgePaymentsUseCase: purgePaymentsUseCase,
+		WebhookUseCase:       webhookUseCase,
+		DeadLetterUseCase:    deadLetterUseCase,
+	}
+}
+
+func (ac *AdminController) PurgePayments(c *gin.Context) {
+	result, err := ac.PurgePaymentsUseCase.Execute(c.Request.Context())
+	if err != nil {
+		log.Printf("Failed to purge payments: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Internal Server Error",
+			Message: "Failed to purge payments",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func (ac *AdminController) GetIntakeMetrics(c *gin.Context) {
+	c.JSON(http.StatusOK, usecases.GetIntakeMetrics().Snapshot())
+}
+
+type ProcessorStatusResponse struct {
+	*usecases.ProcessorStatusSnapshot
+	AgeMs int64 `json:"ageMs"`
+	Stale bool  `json:"stale"`
+}
+
+// GetProcessorStatus reports the processor health this instance routes on.
+func (ac *AdminController) GetProcessorStatus(c *gin.Context) {
+	snapshot := usecases.GetProcessorStatus().Load()
+	if snapshot == nil {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{
+			Error:   "Service Unavailable",
+			Message: "No processor status received yet",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, ProcessorStatusResponse{
+		ProcessorStatusSnapshot: snapshot,
+		AgeMs:                   snapshot.Age().Milliseconds(),
+		Stale:                   snapshot.Stale(),
+	})
+}
+
+// GetCircuitBreakers reports this instance's circuit breaker of every
+// processor.
+func (ac *AdminController) GetCircuitBreakers(c *gin.Context) {
+	c.JSON(http.StatusOK, usecases.GetCircuitBreakers().Snapshot())
+}
+
+// GetWorkers reports this instance's worker pool size and the autoscaler's
+// recent decisions.
+func (ac *AdminController) GetWorkers(c *gin.Context) {
+	c.JSON(http.StatusOK, usecases.GetWorkerScaling().Snapshot())
+}
+
+func (ac *AdminController) GetWebhook(c *gin.Context) {
+	correlationID := c.Param("correlationId")
+	delivery, err := ac.WebhookUseCase.Get(c.Request.Context(), correlationID)
+	if err != nil {
+		writeWebhookError(c, correlationID, err)
+		return
+	}
+	c.JSON(http.StatusOK, delivery)
+}
+
+// ResendWebhook schedules a fresh delivery of a payment's notification, even
+// if it was already delivered or ran out of attempts.
+func (ac *AdminController) ResendWebhook(c *gin.Context) {
+	correlationID := c.Param("correlationId")
+	delivery, err := ac.WebhookUseCase.Resend(c.Request.Context(), correlationID)
+	if err != nil {
+		writeWebhookError(c, correlationID, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, delivery)
+}
+
+func writeWebhookError(c *gin.Context, correlationID string, err error) {
+	if errors.Is(err, usecases.ErrWebhookNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{
+			Error:   "Not Found",
+			Message: "No webhook delivery found for correlationId " + correlationID,
+		})
+		return
+	}
+	log.Printf("Failed to access webhook delivery %s: %v", correlationID, err)
+	c.JSON(http.StatusInternalServerError, ErrorResponse{
+		Error:   "Internal Server Error",
+		Message: "Failed to access webhook delivery",
+	})
+}
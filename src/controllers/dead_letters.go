@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	usecases "payment-processor/use_cases"
+	"regexp"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultDeadLetterPage = 100
+	maxDeadLetterPage     = 1000
+)
+
+// Redis ids look like 1718000000000-0, Postgres ids are plain row ids.
+var streamIDPattern = regexp.MustCompile(`^\d+(-\d+)?$`)
+
+// ListDeadLetters pages through the dead-letter queue, oldest first. Pass the
+// returned next id as ?start= to get the following page.
+func (ac *AdminController) ListDeadLetters(c *gin.Context) {
+	start := c.Query("start")
+	if start != "" && !streamIDPattern.MatchString(start) {
+		writeInvalidStreamID(c)
+		return
+	}
+	count := int64(defaultDeadLetterPage)
+	if raw := c.Query("count"); raw != "" {
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || parsed < 1 || parsed > maxDeadLetterPage {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error:   "Invalid Request",
+				Message: "count must be between 1 and " + strconv.Itoa(maxDeadLetterPage),
+			})
+			return
+		}
+		count = parsed
+	}
+
+	page, err := ac.DeadLetterUseCase.List(c.Request.Context(), start, count)
+	if err != nil {
+		writeDeadLetterError(c, start, err)
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+func (ac *AdminController) GetDeadLetter(c *gin.Context) {
+	id := c.Param("id")
+	if !streamIDPattern.MatchString(id) {
+		writeInvalidStreamID(c)
+		return
+	}
+
+	entry, err := ac.DeadLetterUseCase.Get(c.Request.Context(), id)
+	if err != nil {
+		writeDeadLetterError(c, id, err)
+		return
+	}
+	c.JSON(http.StatusOK, entry)
+}
+
+// ReplayDeadLetter moves the entry back to the payments stream with a fresh
+// attempt budget.
+func (ac *AdminController) ReplayDeadLetter(c *gin.Context) {
+	id := c.Param("id")
+	if !streamIDPattern.MatchString(id) {
+		writeInvalidStreamID(c)
+		return
+	}
+
+	streamID, err := ac.DeadLetterUseCase.Replay(c.Request.Context(), id)
+	if err != nil {
+		writeDeadLetterError(c, id, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"id": id, "streamId": streamID})
+}
+
+func (ac *AdminController) DiscardDeadLetter(c *gin.Context) {
+	id := c.Param("id")
+	if !streamIDPattern.MatchString(id) {
+		writeInvalidStreamID(c)
+		return
+	}
+
+	if err := ac.DeadLetterUseCase.Discard(c.Request.Context(), id); err != nil {
+		writeDeadLetterError(c, id, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func writeInvalidStreamID(c *gin.Context) {
+	c.JSON(http.StatusBadRequest, ErrorResponse{
+		Error:   "Invalid Request",
+		Message: "id must be a queue entry id such as 1718000000000-0",
+	})
+}
+
+func writeDeadLetterError(c *gin.Context, id string, err error) {
+	if errors.Is(err, usecases.ErrDeadLetterNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{
+			Error:   "Not Found",
+			Message: "No dead-letter entry with id " + id,
+		})
+		return
+	}
+	log.Printf("Failed to access dead-letter entry %s: %v", id, err)
+	c.JSON(http.StatusInternalServerError, ErrorResponse{
+		Error:   "Internal Server Error",
+		Message: "Failed to access the dead-letter queue",
+	})
+}
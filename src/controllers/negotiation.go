@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"payment-processor/core/models"
+	"payment-processor/protocol"
+	usecases "payment-processor/use_cases"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errUnsupportedMediaType = errors.New("unsupported media type")
+
+// bindPaymentRequest decodes the request body according to its Content-Type:
+// JSON (the default), MessagePack or protobuf.
+func bindPaymentRequest(c *gin.Context, req *CreatePaymentRequest) error {
+	switch requestMediaType(c) {
+	case "", protocol.ContentTypeJSON:
+		return c.ShouldBindJSON(req)
+	case protocol.ContentTypeMsgpack, "application/x-msgpack":
+		var message protocol.MsgpackPaymentRequest
+		if err := protocol.DecodeMsgpack(c.Request.Body, &message); err != nil {
+			return err
+		}
+		amount, err := message.AmountString()
+		if err != nil {
+			return err
+		}
+		req.CorrelationID = message.CorrelationID
+		req.CallbackURL = message.CallbackURL
+		req.Priority = message.Priority
+		req.Amount, err = models.ParseMoney(amount)
+		return err
+	case protocol.ContentTypeProtobuf, "application/protobuf":
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			return err
+		}
+		var message protocol.PaymentRequest
+		if err := message.UnmarshalProto(body); err != nil {
+			return err
+		}
+		req.CorrelationID = message.CorrelationID
+		req.Amount = models.Money(message.AmountCents)
+		req.CallbackURL = message.CallbackURL
+		req.Priority = message.Priority
+		return nil
+	default:
+		return errUnsupportedMediaType
+	}
+}
+
+// renderSummary writes the summary in the format picked from the Accept
+// header, falling back to JSON.
+func renderSummary(c *gin.Context, summary *usecases.PaymentsSummary) {
+	switch c.NegotiateFormat(protocol.ContentTypeJSON, protocol.ContentTypeMsgpack, protocol.ContentTypeProtobuf) {
+	case protocol.ContentTypeMsgpack:
+		message := protocol.MsgpackPaymentsSummary{}
+		for name, item := range *summary {
+			message[name] = msgpackSummaryItem(item)
+		}
+		body, err := protocol.EncodeMsgpack(&message)
+		renderBinary(c, protocol.ContentTypeMsgpack, body, err)
+	case protocol.ContentTypeProtobuf:
+		message := &protocol.PaymentsSummary{
+			DefaultProcessor:  protoSummaryItem((*summary)["default"]),
+			FallbackProcessor: protoSummaryItem((*summary)["fallback"]),
+			Processors:        make(map[string]*protocol.SummaryItem, len(*summary)),
+		}
+		for name, item := range *summary {
+			message.Processors[name] = protoSummaryItem(item)
+		}
+		body, err := message.MarshalProto()
+		renderBinary(c, protocol.ContentTypeProtobuf, body, err)
+	default:
+		c.JSON(http.StatusOK, summary)
+	}
+}
+
+func renderBinary(c *gin.Context, contentType string, body []byte, err error) {
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode payments summary"})
+		return
+	}
+	c.Header("Vary", "Accept")
+	c.Data(http.StatusOK, contentType, body)
+}
+
+func requestMediaType(c *gin.Context) string {
+	mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	return mediaType
+}
+
+func msgpackSummaryItem(item *usecases.SummaryItem) *protocol.MsgpackSummaryItem {
+	return &protocol.MsgpackSummaryItem{
+		TotalRequests: int64(item.TotalRequests),
+		TotalAmount:   item.TotalAmount.String(),
+	}
+}
+
+// protoSummaryItem returns nil for a processor missing from the summary, so
+// a registry without default or fallback leaves those fields unset.
+func protoSummaryItem(item *usecases.SummaryItem) *protocol.SummaryItem {
+	if item == nil {
+		return nil
+	}
+	return &protocol.SummaryItem{
+		TotalRequests:    int64(item.TotalRequests),
+		TotalAmountCents: item.TotalAmount.Cents(),
+	}
+}
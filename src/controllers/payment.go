@@ -1,18 +1,23 @@
 package controllers
 
 import (
+	"errors"
 	"log"
+	"math"
 	"net/http"
 	"payment-processor/core/models"
 	usecases "payment-processor/use_cases"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
 type PaymentController struct {
 	EnqueuePaymentuseCase     *usecases.QueuePaymentsUseCase
 	GetPaymentsSummaryUseCase *usecases.GetPaymentsSummaryUseCase
+	PaymentStatusUseCase      *usecases.PaymentStatusUseCase
 }
 
 type PaymentsSummaryResponse struct {
@@ -21,23 +26,27 @@ type PaymentsSummaryResponse struct {
 }
 
 type SummaryItem struct {
-	TotalRequests int     `json:"totalRequests"`
-	TotalAmount   float64 `json:"totalAmount"`
+	TotalRequests int          `json:"totalRequests"`
+	TotalAmount   models.Money `json:"totalAmount"`
 }
 
 func NewPaymentController(
 	enqueuePaymentuseCase *usecases.QueuePaymentsUseCase,
 	getPaymentSummaryUseCase *usecases.GetPaymentsSummaryUseCase,
+	paymentStatusUseCase *usecases.PaymentStatusUseCase,
 ) *PaymentController {
 	return &PaymentController{
 		EnqueuePaymentuseCase:     enqueuePaymentuseCase,
 		GetPaymentsSummaryUseCase: getPaymentSummaryUseCase,
+		PaymentStatusUseCase:      paymentStatusUseCase,
 	}
 }
 
 type CreatePaymentRequest struct {
-	CorrelationID string  `json:"correlationId" validate:"required,uuid"`
-	Amount        float64 `json:"amount" validate:"required,gt=0"`
+	CorrelationID string       `json:"correlationId" validate:"required,uuid"`
+	Amount        models.Money `json:"amount" validate:"required,gt=0"`
+	CallbackURL   string       `json:"callbackUrl,omitempty" validate:"omitempty,url"`
+	Priority      string       `json:"priority,omitempty"`
 }
 
 type ErrorResponse struct {
@@ -47,7 +56,15 @@ type ErrorResponse struct {
 
 func (pc *PaymentController) EnqueuePayment(c *gin.Context) {
 	var req CreatePaymentRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
+	if err := bindPaymentRequest(c, &req); err != nil {
+		if errors.Is(err, errUnsupportedMediaType) {
+			c.JSON(http.StatusUnsupportedMediaType, ErrorResponse{
+				Error:   "Unsupported Media Type",
+				Message: "Content-Type must be application/json, application/msgpack or application/x-protobuf",
+			})
+			return
+		}
+		usecases.GetIntakeMetrics().Invalid.Add(1)
 		c.JSON(400, ErrorResponse{
 			Error:   "Invalid Request",
 			Message: "Invalid request data: correlationId and amount are required and must be valid",
@@ -55,24 +72,24 @@ func (pc *PaymentController) EnqueuePayment(c *gin.Context) {
 		return
 	}
 
-	err := pc.EnqueuePaymentuseCase.EnqueuePayment(
+	result, err := pc.EnqueuePaymentuseCase.EnqueuePayment(
 		c.Request.Context(),
-		"payments",
 		models.Payment{
 			CorrelationID: req.CorrelationID,
 			Amount:        req.Amount,
 			RequestedAt:   time.Now().UTC().Format(time.RFC3339),
+			CallbackURL:   req.CallbackURL,
+			Priority:      models.Priority(req.Priority),
 		},
 	)
 	if err != nil {
-		log.Printf("Failed to queue payment %s: %v", req.CorrelationID, err)
-		c.JSON(500, ErrorResponse{
-			Error:   "Internal Server Error",
-			Message: "Failed to process payment",
-		})
+		writeIntakeError(c, req.CorrelationID, err)
 		return
 	}
 
+	if result == usecases.EnqueueDuplicate {
+		c.Header("Idempotent-Replayed", "true")
+	}
 	c.Status(204)
 }
 
@@ -95,5 +112,84 @@ func (pc *PaymentController) GetPaymentsSummary(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve payments summary"})
 		return
 	}
-	c.JSON(http.StatusOK, summary)
+	renderSummary(c, summary)
+}
+
+func (pc *PaymentController) GetPayment(c *gin.Context) {
+	correlationID := c.Param("correlationId")
+	if _, err := uuid.Parse(correlationID); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid Request",
+			Message: "correlationId must be a valid UUID",
+		})
+		return
+	}
+
+	status, err := pc.PaymentStatusUseCase.Get(c.Request.Context(), correlationID)
+	if errors.Is(err, usecases.ErrPaymentNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{
+			Error:   "Not Found",
+			Message: "No payment found for correlationId " + correlationID,
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to get payment status %s: %v", correlationID, err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Internal Server Error",
+			Message: "Failed to retrieve payment status",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// writeIntakeError maps intake failures to responses clients can act on:
+// 400 for invalid payments, 409 for conflicting replays, 429 when the queue is
+// full and 503 when it is unreachable, both with a Retry-After header.
+func writeIntakeError(c *gin.Context, correlationID string, err error) {
+	var intakeErr *usecases.IntakeError
+	if errors.As(err, &intakeErr) && intakeErr.RetryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(intakeErr.RetryAfter.Seconds()))))
+	}
+
+	switch {
+	case errors.Is(err, usecases.ErrInvalidPayment):
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid Request",
+			Message: "Invalid request data: " + errors.Unwrap(err).Error(),
+		})
+	case errors.Is(err, usecases.ErrPaymentConflict):
+		c.JSON(http.StatusConflict, ErrorResponse{
+			Error:   "Conflict",
+			Message: "A payment with this correlationId was already received with a different amount",
+		})
+	case errors.Is(err, usecases.ErrQueueFull):
+		c.JSON(http.StatusTooManyRequests, ErrorResponse{
+			Error:   "Too Many Requests",
+			Message: "Payment queue is full, retry later",
+		})
+	case errors.Is(err, usecases.ErrIntakeThrottled):
+		c.JSON(http.StatusTooManyRequests, ErrorResponse{
+			Error:   "Too Many Requests",
+			Message: "Intake is throttled, retry later",
+		})
+	case errors.Is(err, usecases.ErrIntakeOverloaded):
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{
+			Error:   "Service Unavailable",
+			Message: "Intake is overloaded, retry later",
+		})
+	case errors.Is(err, usecases.ErrQueueUnavailable):
+		log.Printf("Failed to queue payment %s: %v", correlationID, err)
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{
+			Error:   "Service Unavailable",
+			Message: "Payment queue is unavailable, retry later",
+		})
+	default:
+		log.Printf("Failed to queue payment %s: %v", correlationID, err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Internal Server Error",
+			Message: "Failed to process payment",
+		})
+	}
 }
@@ -0,0 +1,187 @@
+package controllers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"mime"
+	"net/http"
+	"payment-processor/config"
+	"payment-processor/core/models"
+	usecases "payment-processor/use_cases"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type BatchItemResult struct {
+	Index         int    `json:"index"`
+	CorrelationID string `json:"correlationId,omitempty"`
+	Status        string `json:"status"`
+	Reason        string `json:"reason,omitempty"`
+}
+
+type BatchPaymentsResponse struct {
+	Accepted  int               `json:"accepted"`
+	Duplicate int               `json:"duplicate"`
+	Rejected  int               `json:"rejected"`
+	Results   []BatchItemResult `json:"results"`
+}
+
+// EnqueuePayments accepts a JSON array or an NDJSON stream of
+// CreatePaymentRequest, validates every item and enqueues the valid ones in a
+// single pipelined round trip.
+func (pc *PaymentController) EnqueuePayments(c *gin.Context) {
+	config := config.LoadConfig()
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, int64(config.BatchMaxBytes))
+	items, err := decodeBatch(c.Request)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, ErrorResponse{
+			Error:   "Request Entity Too Large",
+			Message: fmt.Sprintf("Batch body must not exceed %d bytes", config.BatchMaxBytes),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid Request",
+			Message: err.Error(),
+		})
+		return
+	}
+	if len(items) == 0 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid Request",
+			Message: "Batch must contain at least one payment",
+		})
+		return
+	}
+	if len(items) > config.BatchMaxItems {
+		c.JSON(http.StatusRequestEntityTooLarge, ErrorResponse{
+			Error:   "Request Entity Too Large",
+			Message: fmt.Sprintf("Batch must not contain more than %d payments", config.BatchMaxItems),
+		})
+		return
+	}
+
+	results := make([]BatchItemResult, len(items))
+	var (
+		payments []models.Payment
+		indexes  []int
+	)
+	requestedAt := time.Now().UTC().Format(time.RFC3339)
+	for i, item := range items {
+		results[i] = BatchItemResult{Index: i, CorrelationID: item.request.CorrelationID}
+		if item.err != nil {
+			usecases.GetIntakeMetrics().Invalid.Add(1)
+			results[i].Status = usecases.OutcomeInvalid
+			results[i].Reason = item.err.Error()
+			continue
+		}
+		payments = append(payments, models.Payment{
+			CorrelationID: item.request.CorrelationID,
+			Amount:        item.request.Amount,
+			RequestedAt:   requestedAt,
+			CallbackURL:   item.request.CallbackURL,
+			Priority:      models.Priority(item.request.Priority),
+		})
+		indexes = append(indexes, i)
+	}
+
+	enqueueResults, enqueueErrs := pc.EnqueuePaymentuseCase.EnqueuePayments(c.Request.Context(), payments)
+
+	response := BatchPaymentsResponse{Results: results}
+	var retryAfter time.Duration
+	for j, i := range indexes {
+		var intakeErr *usecases.IntakeError
+		if errors.As(enqueueErrs[j], &intakeErr) && intakeErr.RetryAfter > retryAfter {
+			retryAfter = intakeErr.RetryAfter
+		}
+
+		if errors.Is(enqueueErrs[j], usecases.ErrQueueUnavailable) {
+			log.Printf("Failed to queue payment %s: %v", results[i].CorrelationID, enqueueErrs[j])
+		}
+		results[i].Status, results[i].Reason = usecases.DescribeOutcome(enqueueResults[j], enqueueErrs[j])
+	}
+	for _, result := range results {
+		switch result.Status {
+		case usecases.OutcomeAccepted:
+			response.Accepted++
+		case usecases.OutcomeDuplicate:
+			response.Duplicate++
+		default:
+			response.Rejected++
+		}
+	}
+
+	if retryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+type batchItem struct {
+	request CreatePaymentRequest
+	err     error
+}
+
+func decodeBatch(r *http.Request) ([]batchItem, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/x-ndjson", "application/ndjson", "application/jsonl":
+		return decodeNDJSONBatch(r.Body)
+	default:
+		return decodeJSONArrayBatch(r.Body)
+	}
+}
+
+func decodeJSONArrayBatch(body io.Reader) ([]batchItem, error) {
+	var raw []json.RawMessage
+	if err := json.NewDecoder(body).Decode(&raw); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, err
+		}
+		return nil, errors.New("Invalid request data: body must be a JSON array of payments")
+	}
+
+	items := make([]batchItem, len(raw))
+	for i, message := range raw {
+		items[i].err = decodeBatchItem(message, &items[i].request)
+	}
+	return items, nil
+}
+
+func decodeNDJSONBatch(body io.Reader) ([]batchItem, error) {
+	var items []batchItem
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 4096), 64*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var item batchItem
+		item.err = decodeBatchItem(line, &item.request)
+		items = append(items, item)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Invalid request data: %w", err)
+	}
+	return items, nil
+}
+
+func decodeBatchItem(data []byte, req *CreatePaymentRequest) error {
+	if err := json.Unmarshal(data, req); err != nil {
+		return errors.New("malformed payment: " + err.Error())
+	}
+	return nil
+}
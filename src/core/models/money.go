@@ -0,0 +1,139 @@
+package models
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Money is an exact monetary amount stored as an integer number of cents.
+// It encodes as a plain JSON number ("19.90"), so it stays compatible with the
+// rinha payload format while never going through float64 arithmetic.
+type Money int64
+
+const centsPerUnit = 100
+
+// maxMoneyExponent bounds the exponent ParseMoney accepts. Any amount that
+// fits in an int64 of cents is written with a far smaller one, and a huge
+// exponent would make the exact decimal expansion expensive to compute.
+const maxMoneyExponent = 64
+
+// decimalPattern is plain decimal notation with an optional exponent; the
+// base prefixes and digit separators big.Rat also accepts are not amounts.
+var decimalPattern = regexp.MustCompile(`^[+-]?(\d+(\.\d*)?|\.\d+)([eE]([+-]?\d+))?$`)
+
+var (
+	ErrInvalidMoney   = errors.New("invalid monetary amount")
+	ErrMoneyPrecision = errors.New("monetary amount must have at most 2 decimal places")
+	ErrMoneyOverflow  = errors.New("monetary amount is out of range")
+)
+
+// ParseMoney parses a decimal string such as "19.9", "19.90", "19.90000" or
+// "1.99e1". Amounts with non-zero digits beyond the cents are rejected instead
+// of being rounded.
+func ParseMoney(s string) (Money, error) {
+	match := decimalPattern.FindStringSubmatch(s)
+	if match == nil {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidMoney, s)
+	}
+	if match[4] != "" {
+		exponent, err := strconv.Atoi(match[4])
+		switch {
+		case err != nil && strings.HasPrefix(match[4], "-"), exponent < -maxMoneyExponent:
+			return 0, fmt.Errorf("%w: %q", ErrMoneyPrecision, s)
+		case err != nil, exponent > maxMoneyExponent:
+			return 0, fmt.Errorf("%w: %q", ErrMoneyOverflow, s)
+		}
+	}
+	value, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidMoney, s)
+	}
+	cents := value.Mul(value, big.NewRat(centsPerUnit, 1))
+	if !cents.IsInt() {
+		return 0, fmt.Errorf("%w: %q", ErrMoneyPrecision, s)
+	}
+	if !cents.Num().IsInt64() {
+		return 0, fmt.Errorf("%w: %q", ErrMoneyOverflow, s)
+	}
+	return Money(cents.Num().Int64()), nil
+}
+
+func (m Money) Cents() int64 {
+	return int64(m)
+}
+
+func (m Money) String() string {
+	cents := int64(m)
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+	}
+	abs := uint64(cents)
+	if cents < 0 {
+		abs = uint64(-cents)
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, abs/centsPerUnit, abs%centsPerUnit)
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON accepts a JSON number or a quoted decimal string.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		unquoted, err := strconv.Unquote(string(data))
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidMoney, data)
+		}
+		data = []byte(unquoted)
+	}
+	parsed, err := ParseMoney(string(data))
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+// Scan reads NUMERIC/DECIMAL columns, which the driver returns as text.
+func (m *Money) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*m = 0
+		return nil
+	case []byte:
+		parsed, err := ParseMoney(string(v))
+		if err != nil {
+			return err
+		}
+		*m = parsed
+		return nil
+	case string:
+		parsed, err := ParseMoney(v)
+		if err != nil {
+			return err
+		}
+		*m = parsed
+		return nil
+	case int64:
+		*m = Money(v * centsPerUnit)
+		return nil
+	default:
+		return fmt.Errorf("%w: cannot scan %T", ErrInvalidMoney, src)
+	}
+}
@@ -0,0 +1,181 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Money
+		err  error
+	}{
+		{in: "19.9", want: 1990},
+		{in: "19.90", want: 1990},
+		{in: "19.90000", want: 1990},
+		{in: "19", want: 1900},
+		{in: "0.01", want: 1},
+		{in: ".5", want: 50},
+		{in: "5.", want: 500},
+		{in: "+5", want: 500},
+		{in: "-5.25", want: -525},
+		{in: "-0.01", want: -1},
+		{in: "0", want: 0},
+		{in: "1e2", want: 10000},
+		{in: "1E2", want: 10000},
+		{in: "1.99e1", want: 1990},
+		{in: "1e-2", want: 1},
+		{in: "1e+21", err: ErrMoneyOverflow},
+		{in: "92233720368547758.07", want: 9223372036854775807},
+		{in: "-92233720368547758.08", want: -9223372036854775808},
+		{in: "92233720368547758.08", err: ErrMoneyOverflow},
+		{in: "1e64", err: ErrMoneyOverflow},
+		{in: "1e65", err: ErrMoneyOverflow},
+		{in: "1e1000000", err: ErrMoneyOverflow},
+		{in: "1e99999999999999999999", err: ErrMoneyOverflow},
+		{in: "0.001", err: ErrMoneyPrecision},
+		{in: "19.901", err: ErrMoneyPrecision},
+		{in: "1e-3", err: ErrMoneyPrecision},
+		{in: "1e-1000000", err: ErrMoneyPrecision},
+		{in: "1e-99999999999999999999", err: ErrMoneyPrecision},
+		{in: "", err: ErrInvalidMoney},
+		{in: "abc", err: ErrInvalidMoney},
+		{in: " 19.90", err: ErrInvalidMoney},
+		{in: "19.90 ", err: ErrInvalidMoney},
+		{in: "19,90", err: ErrInvalidMoney},
+		{in: "1/2", err: ErrInvalidMoney},
+		{in: "0x10", err: ErrInvalidMoney},
+		{in: "0b11", err: ErrInvalidMoney},
+		{in: "1_000", err: ErrInvalidMoney},
+		{in: "NaN", err: ErrInvalidMoney},
+		{in: "Inf", err: ErrInvalidMoney},
+		{in: ".", err: ErrInvalidMoney},
+		{in: "1e", err: ErrInvalidMoney},
+		{in: "--1", err: ErrInvalidMoney},
+		{in: `"19.90"`, err: ErrInvalidMoney},
+	}
+	for _, tt := range tests {
+		got, err := ParseMoney(tt.in)
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) {
+				t.Errorf("ParseMoney(%q) error = %v, want %v", tt.in, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseMoney(%q) = %d, %v, want %d", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		in   Money
+		want string
+	}{
+		{0, "0.00"},
+		{1, "0.01"},
+		{1990, "19.90"},
+		{-525, "-5.25"},
+		{-1, "-0.01"},
+		{9223372036854775807, "92233720368547758.07"},
+		{-9223372036854775808, "-92233720368547758.08"},
+	}
+	for _, tt := range tests {
+		if got := tt.in.String(); got != tt.want {
+			t.Errorf("Money(%d).String() = %q, want %q", int64(tt.in), got, tt.want)
+		}
+	}
+}
+
+func TestMoneyUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Money
+		err  error
+	}{
+		{in: `19.9`, want: 1990},
+		{in: `19.90000`, want: 1990},
+		{in: `1e2`, want: 10000},
+		{in: `"19.90"`, want: 1990},
+		{in: `"1e2"`, want: 10000},
+		{in: `-5`, want: -500},
+		{in: `0.001`, err: ErrMoneyPrecision},
+		{in: `"0.001"`, err: ErrMoneyPrecision},
+		{in: `1e30`, err: ErrMoneyOverflow},
+		{in: `"19,90"`, err: ErrInvalidMoney},
+		{in: `""`, err: ErrInvalidMoney},
+		{in: `true`, err: ErrInvalidMoney},
+	}
+	for _, tt := range tests {
+		var payment Payment
+		err := json.Unmarshal([]byte(`{"amount": `+tt.in+`}`), &payment)
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) {
+				t.Errorf("unmarshal amount %s error = %v, want %v", tt.in, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || payment.Amount != tt.want {
+			t.Errorf("unmarshal amount %s = %d, %v, want %d", tt.in, payment.Amount, err, tt.want)
+		}
+	}
+}
+
+func TestMoneyUnmarshalJSONNullKeepsValue(t *testing.T) {
+	amount := Money(1990)
+	if err := json.Unmarshal([]byte(`null`), &amount); err != nil {
+		t.Fatal(err)
+	}
+	if amount != 1990 {
+		t.Errorf("null changed the amount to %d", amount)
+	}
+}
+
+func TestMoneyJSONRoundTrip(t *testing.T) {
+	for _, amount := range []Money{0, 1, 10, 1990, 23143700, -525, 9223372036854775807, -9223372036854775808} {
+		data, err := json.Marshal(Payment{Amount: amount})
+		if err != nil {
+			t.Fatalf("marshal %d: %v", amount, err)
+		}
+		var payment Payment
+		if err := json.Unmarshal(data, &payment); err != nil {
+			t.Fatalf("unmarshal %s: %v", data, err)
+		}
+		if payment.Amount != amount {
+			t.Errorf("round trip of %d through %s gave %d", int64(amount), data, int64(payment.Amount))
+		}
+	}
+
+	data, err := json.Marshal(map[string]Money{"totalAmount": 23143700})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"totalAmount":231437.00}` {
+		t.Errorf("got %s, want two decimal places", data)
+	}
+}
+
+func TestMoneyScan(t *testing.T) {
+	tests := []struct {
+		src  interface{}
+		want Money
+	}{
+		{nil, 0},
+		{[]byte("19.90000"), 1990},
+		{"231437.00", 23143700},
+		{int64(3), 300},
+	}
+	for _, tt := range tests {
+		var m Money
+		if err := m.Scan(tt.src); err != nil || m != tt.want {
+			t.Errorf("Scan(%v) = %d, %v, want %d", tt.src, m, err, tt.want)
+		}
+	}
+	var m Money
+	if err := m.Scan(1.5); !errors.Is(err, ErrInvalidMoney) {
+		t.Errorf("Scan(float64) error = %v, want %v", err, ErrInvalidMoney)
+	}
+}
@@ -1,14 +1,39 @@
 package models
 
 type PaymentsSummary struct {
-	TotalRequests int     `json:"totalRequests" required:"true"`
-	TotalAmount   float64 `json:"totalAmount" required:"true"`
-	Type          string  `json:"type" required:"true"`
+	TotalRequests int    `json:"totalRequests" required:"true"`
+	TotalAmount   Money  `json:"totalAmount" required:"true"`
+	Type          string `json:"type" required:"true"`
 }
 
 type Payment struct {
-	CorrelationID string  `json:"correlationId" required:"true"`
-	Amount        float64 `json:"amount" required:"true"`
-	RequestedAt   string  `json:"requestedAt" required:"true"`
-	Type          string  `json:"type" required:"false"`
+	CorrelationID string `json:"correlationId" required:"true"`
+	Amount        Money  `json:"amount" required:"true"`
+	RequestedAt   string `json:"requestedAt" required:"true"`
+	Type          string `json:"type" required:"false"`
+	CallbackURL   string `json:"callbackUrl,omitempty" required:"false"`
+	// Priority only matters inside this service; processors never see it.
+	Priority Priority `json:"-"`
+}
+
+// Priority decides which payments intake sheds first under load. The empty
+// priority is normal.
+type Priority string
+
+const (
+	PriorityHigh   Priority = "high"
+	PriorityNormal Priority = "normal"
+	PriorityLow    Priority = "low"
+)
+
+func (p Priority) Valid() bool {
+	return p == "" || p == PriorityHigh || p == PriorityNormal || p == PriorityLow
+}
+
+// Normalize maps the empty priority to PriorityNormal.
+func (p Priority) Normalize() Priority {
+	if p == "" {
+		return PriorityNormal
+	}
+	return p
 }
@@ -0,0 +1,45 @@
+package models
+
+type PaymentState string
+
+const (
+	PaymentStateQueued              PaymentState = "queued"
+	PaymentStateDispatching         PaymentState = "dispatching"
+	PaymentStateProcessedByDefault  PaymentState = PaymentStateProcessedPrefix + "default"
+	PaymentStateProcessedByFallback PaymentState = PaymentStateProcessedPrefix + "fallback"
+	PaymentStateRetrying            PaymentState = "retrying"
+	PaymentStateDeadLettered        PaymentState = "dead-lettered"
+)
+
+var PaymentStates = []PaymentState{
+	PaymentStateQueued,
+	PaymentStateDispatching,
+	PaymentStateProcessedByDefault,
+	PaymentStateProcessedByFallback,
+	PaymentStateRetrying,
+	PaymentStateDeadLettered,
+}
+
+type PaymentStatus struct {
+	CorrelationID string                  `json:"correlationId"`
+	Amount        Money                   `json:"amount"`
+	RequestedAt   string                  `json:"requestedAt"`
+	State         PaymentState            `json:"state"`
+	Processor     string                  `json:"processor,omitempty"`
+	Attempts      int                     `json:"attempts"`
+	LastError     string                  `json:"lastError,omitempty"`
+	Conflict      string                  `json:"conflict,omitempty"`
+	CreatedAt     string                  `json:"createdAt"`
+	UpdatedAt     string                  `json:"updatedAt"`
+	Transitions   map[PaymentState]string `json:"transitions"`
+}
+
+// PaymentStateProcessedPrefix prefixes the final state of a payment accepted
+// by a processor, followed by the processor name.
+const PaymentStateProcessedPrefix = "processed-by-"
+
+// ProcessedState maps the processor that accepted a payment to its final
+// state, processed-by-<name>.
+func ProcessedState(processor string) PaymentState {
+	return PaymentState(PaymentStateProcessedPrefix + processor)
+}
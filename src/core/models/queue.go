@@ -0,0 +1,28 @@
+package models
+
+// QueueLaneField is the message field naming the priority lane a message is
+// queued in; messages without it go to the normal lane.
+const QueueLaneField = "priority"
+
+// QueueMessage is one delivery of a queued payment. Values hold the payment
+// fields and its delivery history as strings, whatever the queue backend.
+type QueueMessage struct {
+	ID     string
+	Values map[string]interface{}
+}
+
+// QueueItem is a payment to enqueue at most once per Key.
+type QueueItem struct {
+	Key         string
+	Fingerprint string
+	Values      map[string]interface{}
+}
+
+type QueueAddResult int
+
+const (
+	QueueAddAccepted QueueAddResult = iota
+	QueueAddDuplicate
+	QueueAddConflict
+	QueueAddFull
+)
@@ -0,0 +1,26 @@
+package models
+
+// QueuedPayment is a payment as stored in the payments stream or the
+// dead-letter queue, together with its delivery history.
+type QueuedPayment struct {
+	ID             string   `json:"id"`
+	CorrelationID  string   `json:"correlationId"`
+	Amount         Money    `json:"amount"`
+	RequestedAt    string   `json:"requestedAt"`
+	CallbackURL    string   `json:"callbackUrl,omitempty"`
+	Priority       Priority `json:"priority,omitempty"`
+	Attempts       int      `json:"attempts"`
+	Deferrals      int      `json:"deferrals,omitempty"`
+	Reasons        []string `json:"reasons,omitempty"`
+	DeadLetteredAt string   `json:"deadLetteredAt,omitempty"`
+}
+
+func (q QueuedPayment) Payment() Payment {
+	return Payment{
+		CorrelationID: q.CorrelationID,
+		Amount:        q.Amount,
+		RequestedAt:   q.RequestedAt,
+		CallbackURL:   q.CallbackURL,
+		Priority:      q.Priority,
+	}
+}
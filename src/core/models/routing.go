@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// ProcessorState is what routing knows about the payment processors when a
+// payment is dispatched, in preference order: the cheapest processor first.
+type ProcessorState struct {
+	Processors []ProcessorHealth
+}
+
+type ProcessorHealth struct {
+	Name string
+	// Priority is the configured preference, lower first.
+	Priority        int
+	Failing         bool
+	MinResponseTime int64
+	// FeeRate is the share of the amount the processor keeps, 0.05 for 5%.
+	FeeRate float64
+	// FailureRate and Latency are measured from this instance's recent calls,
+	// both zero before the first one.
+	FailureRate float64
+	Latency     time.Duration
+}
+
+type RoutingAction string
+
+const (
+	// RouteDispatch sends the payment to RoutingDecision.Processor.
+	RouteDispatch RoutingAction = "dispatch"
+	// RouteHold leaves the payment pending, so it is redelivered once
+	// CLAIM_MIN_IDLE_MS has passed.
+	RouteHold RoutingAction = "hold"
+	// RouteRetryLater defers the payment to the retry schedule without
+	// spending one of its attempts.
+	RouteRetryLater RoutingAction = "retry"
+)
+
+type RoutingDecision struct {
+	Action    RoutingAction
+	Processor string
+	// Reason explains the decision in the worker log.
+	Reason string
+}
@@ -0,0 +1,7 @@
+package models
+
+// HashUpdate is a set of field values for the hash at Key.
+type HashUpdate struct {
+	Key    string
+	Values map[string]interface{}
+}
@@ -0,0 +1,42 @@
+package models
+
+type WebhookDeliveryState string
+
+const (
+	WebhookPending   WebhookDeliveryState = "pending"
+	WebhookDelivered WebhookDeliveryState = "delivered"
+	WebhookFailed    WebhookDeliveryState = "failed"
+)
+
+// WebhookNotification is the body POSTed to a payment's callbackUrl.
+type WebhookNotification struct {
+	CorrelationID string       `json:"correlationId"`
+	Processor     string       `json:"processor,omitempty"`
+	Amount        Money        `json:"amount"`
+	Status        PaymentState `json:"status"`
+	Reason        string       `json:"reason,omitempty"`
+	RequestedAt   string       `json:"requestedAt"`
+	CompletedAt   string       `json:"completedAt"`
+}
+
+type WebhookDelivery struct {
+	CorrelationID  string               `json:"correlationId"`
+	URL            string               `json:"url"`
+	Payload        string               `json:"payload"`
+	State          WebhookDeliveryState `json:"state"`
+	Attempts       int                  `json:"attempts"`
+	LastStatusCode int                  `json:"lastStatusCode,omitempty"`
+	LastError      string               `json:"lastError,omitempty"`
+	NextAttemptAt  string               `json:"nextAttemptAt,omitempty"`
+	CreatedAt      string               `json:"createdAt"`
+	UpdatedAt      string               `json:"updatedAt"`
+	Log            []WebhookAttempt     `json:"log,omitempty"`
+}
+
+type WebhookAttempt struct {
+	Attempt    int    `json:"attempt"`
+	At         string `json:"at"`
+	StatusCode int    `json:"statusCode,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+}
@@ -0,0 +1,13 @@
+package services
+
+import (
+	"os"
+	"testing"
+)
+
+// TestMain sets the webhook secret before the first LoadConfig, which reads
+// the environment once.
+func TestMain(m *testing.M) {
+	os.Setenv("WEBHOOK_SECRET", "test-secret")
+	os.Exit(m.Run())
+}
@@ -4,14 +4,42 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"payment-processor/config"
 	"payment-processor/core/models"
 	usecases "payment-processor/use_cases"
+	"strings"
 	"time"
 )
 
+// ProcessorStatusError is a payment the processor answered with a status
+// other than 200 OK.
+type ProcessorStatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *ProcessorStatusError) Error() string {
+	return fmt.Sprintf("payment processing failed with status: %s", e.Status)
+}
+
+// IsProcessorFault reports whether err says the processor itself is in
+// trouble: the call failed or was answered with a 5xx. Other statuses are
+// about the payment, and calls cut short by shutdown about nobody.
+func IsProcessorFault(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var statusErr *ProcessorStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= http.StatusInternalServerError
+	}
+	return err != nil
+}
+
 type ProcessPaymentService struct {
 	QueueUseCase *usecases.QueuePaymentsUseCase
 	httpClient   *http.Client
@@ -26,8 +54,8 @@ func NewProcessPaymentService(
 		DisableCompression: true,
 	}
 
+	// Calls are bounded by each processor's TIMEOUT_MS instead.
 	client := &http.Client{
-		Timeout:   800 * time.Millisecond,
 		Transport: transport,
 	}
 	return &ProcessPaymentService{
@@ -40,38 +68,53 @@ func (ps *ProcessPaymentService) ProcessPayment(
 	paymentProcessorType string,
 	payload models.Payment,
 	ctx context.Context,
-) bool {
-	config := config.LoadConfig()
-	var url string
-	switch paymentProcessorType {
-	case "default":
-		url = config.Services.DefaultProcessPaymentURL
-		payload.Type = "default"
-	case "fallback":
-		url = config.Services.FallbackProcessPaymentURL
-		payload.Type = "fallback"
+) error {
+	processor, ok := config.LoadConfig().Processor(paymentProcessorType)
+	if !ok {
+		return fmt.Errorf("unknown payment processor %q", paymentProcessorType)
 	}
+	payload.Type = processor.Name
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(processor.Timeout)*time.Millisecond)
+	defer cancel()
 
+	// The callback is ours to call, processors must not see it.
+	payload.CallbackURL = ""
 	jsonPayload, err := json.Marshal(payload)
 	if err != nil {
-		fmt.Printf("failed to marshal payment payload: %v", err)
-		return false
+		return fmt.Errorf("failed to marshal payment payload: %v", err)
 	}
-	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonPayload))
+	req, err := http.NewRequestWithContext(ctx, "POST", processor.ProcessPaymentURL, bytes.NewBuffer(jsonPayload))
 	if err != nil {
-		fmt.Printf("failed to create HTTP request: %v", err)
-		return false
+		return fmt.Errorf("failed to create HTTP request: %v", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 	resp, err := ps.httpClient.Do(req)
 	if err != nil {
-		fmt.Printf("HTTP request failed: %v", err)
-		return false
+		return fmt.Errorf("HTTP request failed: %w", err)
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnprocessableEntity && ps.accepted(ctx, processor, payload.CorrelationID) {
+		// An earlier call timed out after the processor took the payment.
+		return nil
+	}
 	if resp.StatusCode != http.StatusOK {
-		fmt.Printf("Payment processing failed with status: %s and correlationId: %s", resp.Status, payload.CorrelationID)
+		return &ProcessorStatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	return nil
+}
+
+// accepted reports whether the processor already holds a payment, which is
+// why it refuses the same correlationId with 422. Any other answer, or none,
+// counts as not accepted.
+func (ps *ProcessPaymentService) accepted(ctx context.Context, processor config.ProcessorConfig, correlationID string) bool {
+	req, err := http.NewRequestWithContext(ctx, "GET", strings.TrimSuffix(processor.ProcessPaymentURL, "/")+"/"+url.PathEscape(correlationID), nil)
+	if err != nil {
+		return false
+	}
+	resp, err := ps.httpClient.Do(req)
+	if err != nil {
 		return false
 	}
-	return true
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
 }
@@ -0,0 +1,56 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"payment-processor/config"
+	"testing"
+)
+
+func TestProcessPaymentAccepted(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" || r.URL.Path != "/payments/known" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `{"correlationId":"known","amount":19.90}`)
+	}))
+	defer server.Close()
+
+	ps := NewProcessPaymentService(nil)
+	processor := config.ProcessorConfig{Name: "default", ProcessPaymentURL: server.URL + "/payments"}
+	if !ps.accepted(context.Background(), processor, "known") {
+		t.Error("payment the processor holds is not accepted")
+	}
+	if ps.accepted(context.Background(), processor, "unknown") {
+		t.Error("payment the processor does not know is accepted")
+	}
+
+	server.Close()
+	if ps.accepted(context.Background(), processor, "known") {
+		t.Error("unreachable processor counts as accepted")
+	}
+}
+
+func TestIsProcessorFault(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{context.Canceled, false},
+		{fmt.Errorf("HTTP request failed: %w", context.DeadlineExceeded), true},
+		{errors.New("connection refused"), true},
+		{&ProcessorStatusError{StatusCode: 500, Status: "500 Internal Server Error"}, true},
+		{&ProcessorStatusError{StatusCode: 422, Status: "422 Unprocessable Entity"}, false},
+		{&ProcessorStatusError{StatusCode: 400, Status: "400 Bad Request"}, false},
+	}
+	for _, tt := range tests {
+		if got := IsProcessorFault(tt.err); got != tt.want {
+			t.Errorf("IsProcessorFault(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"payment-processor/config"
+	usecases "payment-processor/use_cases"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+type WebhookService struct {
+	httpClient *http.Client
+}
+
+// NewWebhookService builds a client that never follows redirects and checks
+// every address it dials against the callback policy, after DNS resolution,
+// so a callback host cannot point it at an internal service.
+func NewWebhookService() *WebhookService {
+	config := config.LoadConfig()
+	dialer := &net.Dialer{
+		Timeout: time.Duration(config.Webhooks.TimeoutMs) * time.Millisecond,
+		Control: checkDialedAddress,
+	}
+	return &WebhookService{
+		httpClient: &http.Client{
+			Timeout: time.Duration(config.Webhooks.TimeoutMs) * time.Millisecond,
+			Transport: &http.Transport{
+				DialContext:       dialer.DialContext,
+				IdleConnTimeout:   30 * time.Second,
+				DisableKeepAlives: false,
+			},
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+func checkDialedAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("%w: unresolved address %s", usecases.ErrCallbackForbidden, address)
+	}
+	return usecases.CheckCallbackIP(ip)
+}
+
+// Send POSTs payload to url and returns the response status code. Any non-2xx
+// response, redirects included, is reported as an error so callers can retry
+// it; a forbidden callback host wraps usecases.ErrCallbackForbidden.
+//
+// Receivers verify the request with X-Webhook-Signature, the hex HMAC-SHA256
+// of "<X-Webhook-Timestamp>.<body>" keyed by WEBHOOK_SECRET.
+func (ws *WebhookService) Send(ctx context.Context, url, correlationID string, payload []byte) (int, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(payload))
+	if err != nil {
+		return 0, fmt.Errorf("error creating request: %v", err)
+	}
+	if err := usecases.CheckCallbackHost(req.URL.Hostname()); err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Id", correlationID)
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", "sha256="+SignWebhook(timestamp, payload))
+
+	resp, err := ws.httpClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("error making request: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook receiver responded with status code: %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+func SignWebhook(timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(config.LoadConfig().Webhooks.Secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,21 @@
+package services
+
+import "testing"
+
+func TestSignWebhook(t *testing.T) {
+	// Computed independently, as a receiver would:
+	// HMAC-SHA256("test-secret", "<timestamp>.<body>") in hex.
+	payload := []byte(`{"correlationId":"4a7e2c1e-3f0e-4bd6-9c8e-1b2d3c4d5e6f","status":"processed-by-default"}`)
+	tests := []struct {
+		timestamp string
+		want      string
+	}{
+		{"1752582896", "a407c67f1fc1fbf64c782322ec5af2b2a768a2f94c1116881a1fdd3123f6d0aa"},
+		{"1752582897", "fd347d0d7c25eb4b215fedabc71f70d232bcf38798918e6ad8f30714255d5f69"},
+	}
+	for _, tt := range tests {
+		if got := SignWebhook(tt.timestamp, payload); got != tt.want {
+			t.Errorf("SignWebhook(%s) = %s, want %s", tt.timestamp, got, tt.want)
+		}
+	}
+}
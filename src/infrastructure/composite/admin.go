@@ -0,0 +1,16 @@
+package composite
+
+import (
+	"payment-processor/controllers"
+	"payment-processor/infrastructure/repositories"
+	"payment-processor/interfaces"
+	usecases "payment-processor/use_cases"
+)
+
+func AdminComposer(store interfaces.Store, queue interfaces.Queue, conn interfaces.DatabaseConnection) *controllers.AdminController {
+	paymentRepository := repositories.NewPaymentRepository(conn)
+	purgeUseCase := usecases.NewPurgePaymentsUseCase(store, queue, paymentRepository)
+	webhookUseCase := usecases.NewWebhookUseCase(store)
+	deadLetterUseCase := usecases.NewDeadLetterUseCase(queue, usecases.NewPaymentStatusUseCase(store))
+	return controllers.NewAdminController(purgeUseCase, webhookUseCase, deadLetterUseCase)
+}
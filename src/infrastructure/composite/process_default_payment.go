@@ -2,15 +2,15 @@ package composite
 
 import (
 	"payment-processor/controllers"
-	"payment-processor/infrastructure"
+	"payment-processor/interfaces"
 	usecases "payment-processor/use_cases"
 )
 
-func ProcessDefaultPaymentComposer() *controllers.PaymentController {
+func ProcessDefaultPaymentComposer(store interfaces.Store, queue interfaces.Queue) *controllers.PaymentController {
 
-	redisClient := infrastructure.NewRedis()
-	enqueueUseCase := usecases.NewQueuePaymentsUseCase(redisClient)
-	getSummaryUseCase := usecases.NewGetPaymentsSummaryUseCase(redisClient)
-	controller := controllers.NewPaymentController(enqueueUseCase, getSummaryUseCase)
+	statusUseCase := usecases.NewPaymentStatusUseCase(store)
+	enqueueUseCase := usecases.NewQueuePaymentsUseCase(store, queue, statusUseCase)
+	getSummaryUseCase := usecases.NewGetPaymentsSummaryUseCase(store)
+	controller := controllers.NewPaymentController(enqueueUseCase, getSummaryUseCase, statusUseCase)
 	return controller
 }
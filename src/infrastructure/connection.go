@@ -3,6 +3,7 @@ package infrastructure
 import (
 	"context"
 	"database/sql"
+	"log"
 	"payment-processor/config"
 	"payment-processor/interfaces"
 )
@@ -18,13 +19,24 @@ func (p *PostgresConnection) Execute(ctx context.Context, query string, args ...
 	}
 	return result, nil
 }
-func NewPostgresConnection() interfaces.DatabaseConnection {
-	config := config.LoadConfig()
-	connString := config.Database.ConnectionString()
-	db, _ := sql.Open("postgres", connString)
+func NewPostgresConnection(db *sql.DB) interfaces.DatabaseConnection {
 	return &PostgresConnection{Conn: db}
 }
 
+// OpenDatabase opens the Postgres pool the whole process shares. Nothing is
+// dialed until the first query.
+func OpenDatabase() *sql.DB {
+	db, err := sql.Open("postgres", config.LoadConfig().Database.ConnectionString())
+	if err != nil {
+		log.Fatal("Failed to open database:", err)
+	}
+	return db
+}
+
+func (p *PostgresConnection) Begin(ctx context.Context) (*sql.Tx, error) {
+	return p.Conn.BeginTx(ctx, nil)
+}
+
 func (p *PostgresConnection) Query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
 	rows, err := p.Conn.QueryContext(ctx, query, args...)
 	if err != nil {
@@ -3,32 +3,116 @@ package migrations
 import (
 	"database/sql"
 	"log"
-	"payment-processor/config"
 
 	_ "github.com/lib/pq"
 )
 
-func CreateRinhaTable() {
-	config := config.LoadConfig()
-	connStr := config.Database.ConnectionString()
-
-	db, err := sql.Open("postgres", connStr)
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer db.Close()
-
-	_, err = db.Exec(`
+func CreateRinhaTable(db *sql.DB) {
+	_, err := db.Exec(`
         CREATE TABLE IF NOT EXISTS rinha (
             id SERIAL PRIMARY KEY NOT NULL,
             uuid UUID UNIQUE NOT NULL,
             amount DECIMAL(10,5) NOT NULL,
-			type SMALLINT NOT NULL DEFAULT 1,
+			type TEXT NOT NULL DEFAULT 'default',
 			created_at TIMESTAMPTZ NOT NULL     
 		);
+        DO $$
+        BEGIN
+            IF EXISTS (
+                SELECT 1 FROM information_schema.columns
+                WHERE table_name = 'rinha' AND column_name = 'type' AND data_type = 'smallint'
+            ) THEN
+                ALTER TABLE rinha ALTER COLUMN type DROP DEFAULT;
+                ALTER TABLE rinha ALTER COLUMN type TYPE TEXT
+                    USING CASE type WHEN 1 THEN 'default' ELSE 'fallback' END;
+                ALTER TABLE rinha ALTER COLUMN type SET DEFAULT 'default';
+            END IF;
+        END $$;
     `)
 	if err != nil {
 		log.Fatal(err)
 	}
 	log.Println("Migration ran successfully")
 }
+
+// QueueTables backs the postgres queue backend. Message ids are the serial
+// ids, so they stay ordered across retries and replays like stream ids.
+// payment_queue_lengths counts the rows of each lane so the cap is checked
+// against one locked row instead of counting the queue; it is seeded from
+// the queue the first time it is created.
+const QueueTables = `
+        CREATE TABLE IF NOT EXISTS payment_queue (
+            id BIGSERIAL PRIMARY KEY,
+            payload JSONB NOT NULL,
+            available_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+            leased_by TEXT,
+            leased_at TIMESTAMPTZ
+        );
+        ALTER TABLE payment_queue ADD COLUMN IF NOT EXISTS lane TEXT NOT NULL DEFAULT 'normal';
+        DROP INDEX IF EXISTS payment_queue_available_idx;
+        CREATE INDEX IF NOT EXISTS payment_queue_lane_available_idx
+            ON payment_queue (lane, available_at, id) WHERE leased_at IS NULL;
+        CREATE INDEX IF NOT EXISTS payment_queue_leased_idx
+            ON payment_queue (leased_at) WHERE leased_at IS NOT NULL;
+        CREATE TABLE IF NOT EXISTS payment_queue_keys (
+            key TEXT PRIMARY KEY,
+            fingerprint TEXT NOT NULL,
+            expires_at TIMESTAMPTZ NOT NULL
+        );
+        CREATE TABLE IF NOT EXISTS payment_dead_letters (
+            id BIGSERIAL PRIMARY KEY,
+            payload JSONB NOT NULL,
+            created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+        );
+        CREATE TABLE IF NOT EXISTS payment_queue_lengths (
+            lane TEXT PRIMARY KEY,
+            length BIGINT NOT NULL DEFAULT 0
+        );
+        INSERT INTO payment_queue_lengths (lane, length)
+            SELECT lane, count(*) FROM payment_queue GROUP BY lane
+            ON CONFLICT (lane) DO NOTHING;
+`
+
+// StoreTables back the postgres store, which keeps the state Redis holds
+// otherwise. Keys, hashes and lists expire at expires_at (never when NULL);
+// reads skip expired rows and the store's Trim deletes them.
+const StoreTables = `
+        CREATE TABLE IF NOT EXISTS store_keys (
+            key TEXT PRIMARY KEY,
+            value TEXT NOT NULL,
+            expires_at TIMESTAMPTZ
+        );
+        CREATE TABLE IF NOT EXISTS store_hashes (
+            key TEXT PRIMARY KEY,
+            fields JSONB NOT NULL,
+            expires_at TIMESTAMPTZ
+        );
+        CREATE TABLE IF NOT EXISTS store_lists (
+            key TEXT NOT NULL,
+            id BIGSERIAL,
+            value TEXT NOT NULL,
+            expires_at TIMESTAMPTZ,
+            PRIMARY KEY (key, id)
+        );
+        CREATE TABLE IF NOT EXISTS store_sorted_sets (
+            key TEXT NOT NULL,
+            member TEXT NOT NULL,
+            score DOUBLE PRECISION NOT NULL,
+            PRIMARY KEY (key, member)
+        );
+        CREATE INDEX IF NOT EXISTS store_sorted_sets_score_idx ON store_sorted_sets (key, score);
+`
+
+func CreateQueueTables(db *sql.DB) {
+	if _, err := db.Exec(QueueTables); err != nil {
+		log.Fatal(err)
+	}
+	log.Println("Queue migration ran successfully")
+}
+
+func CreateStoreTables(db *sql.DB) {
+	if _, err := db.Exec(StoreTables); err != nil {
+		log.Fatal(err)
+	}
+	log.Println("Store migration ran successfully")
+}
@@ -0,0 +1,534 @@
+package infrastructure
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"payment-processor/core/models"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// live matches rows that have not expired.
+const live = "(expires_at IS NULL OR expires_at > now())"
+
+// PostgresStore keeps the state Redis holds otherwise in Postgres tables (see
+// migrations.StoreTables), for deployments that run without Redis. Publishing
+// is NOTIFY and subscriptions LISTEN on a connection of their own.
+//
+// Postgres has no memory ceiling to stay under, so processed payments are
+// never compacted and MemoryUsage reports no limit.
+type PostgresStore struct {
+	db *sql.DB
+	// connStr opens the connections subscriptions listen on.
+	connStr string
+}
+
+func NewPostgresStore(db *sql.DB, connStr string) *PostgresStore {
+	return &PostgresStore{db: db, connStr: connStr}
+}
+
+func (s *PostgresStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// Close leaves the database open: it is shared with the queue and the
+// repositories.
+func (s *PostgresStore) Close() error {
+	return nil
+}
+
+func (s *PostgresStore) Set(ctx context.Context, key string, value string, expirationInSeconds ...int) error {
+	ttl := 5 * time.Second
+	if len(expirationInSeconds) > 0 {
+		ttl = time.Duration(expirationInSeconds[0]) * time.Second
+	}
+	if err := setKey(ctx, s.db, key, value, ttl); err != nil {
+		return fmt.Errorf("failed to set key: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) Get(ctx context.Context, key string) (string, error) {
+	var value string
+	err := s.db.QueryRowContext(ctx, `SELECT value FROM store_keys WHERE key = $1 AND `+live, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get key: %w", err)
+	}
+	return value, nil
+}
+
+// Incr keeps the expiry of a live key, like INCR.
+func (s *PostgresStore) Incr(ctx context.Context, key string) (int64, error) {
+	var value int64
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO store_keys (key, value) VALUES ($1, '1')
+		ON CONFLICT (key) DO UPDATE SET
+			value = CASE WHEN store_keys.expires_at <= now() THEN 1 ELSE store_keys.value::bigint + 1 END::text,
+			expires_at = CASE WHEN store_keys.expires_at <= now() THEN NULL ELSE store_keys.expires_at END
+		RETURNING value::bigint`, key).Scan(&value)
+	if err != nil {
+		return 0, fmt.Errorf("failed to increment key: %w", err)
+	}
+	return value, nil
+}
+
+// SetPublish notifies in the same transaction, so subscribers are only told
+// once readers of key can see value.
+func (s *PostgresStore) SetPublish(ctx context.Context, key, channel, value string, ttl time.Duration) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to set and publish: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := setKey(ctx, tx, key, value, ttl); err != nil {
+		return fmt.Errorf("failed to set and publish: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `SELECT pg_notify($1, $2)`, channel, value); err != nil {
+		return fmt.Errorf("failed to set and publish: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to set and publish: %w", err)
+	}
+	return nil
+}
+
+// Subscribe listens on channel with a connection of its own, which
+// reconnects on its own.
+func (s *PostgresStore) Subscribe(ctx context.Context, channel string) <-chan string {
+	listener := pq.NewListener(s.connStr, time.Second, 10*time.Second,
+		func(event pq.ListenerEventType, err error) {
+			if err != nil {
+				log.Printf("Postgres store: subscription to %s: %v", channel, err)
+			}
+		})
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	payloads := make(chan string)
+	go func() {
+		defer close(payloads)
+		// Listen waits for the listener to connect.
+		if err := listener.Listen(channel); err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Postgres store: failed to listen on %s: %v", channel, err)
+			}
+			return
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case notification, ok := <-listener.Notify:
+				if !ok {
+					return
+				}
+				// nil after a reconnect, when notifications may have been lost.
+				if notification == nil {
+					continue
+				}
+				select {
+				case payloads <- notification.Extra:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return payloads
+}
+
+func (s *PostgresStore) AcquireLease(ctx context.Context, key, owner string, ttl time.Duration) (bool, error) {
+	var held bool
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO store_keys (key, value, expires_at)
+		VALUES ($1, $2, now() + $3 * interval '1 millisecond')
+		ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, expires_at = EXCLUDED.expires_at
+			WHERE store_keys.value = EXCLUDED.value OR store_keys.expires_at <= now()
+		RETURNING true`, key, owner, ttl.Milliseconds()).Scan(&held)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire lease: %w", err)
+	}
+	return held, nil
+}
+
+func (s *PostgresStore) HUpdate(ctx context.Context, key string, values map[string]interface{}, increments map[string]int64, ttl time.Duration) error {
+	if err := updateHash(ctx, s.db, key, values, increments, ttl); err != nil {
+		return fmt.Errorf("failed to update hash: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) HUpdateMany(ctx context.Context, updates []models.HashUpdate, ttl time.Duration) error {
+	if len(updates) == 0 {
+		return nil
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to update hashes: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, update := range updates {
+		if err := updateHash(ctx, tx, update.Key, update.Values, nil, ttl); err != nil {
+			return fmt.Errorf("failed to update hashes: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to update hashes: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	var fields []byte
+	err := s.db.QueryRowContext(ctx, `SELECT fields FROM store_hashes WHERE key = $1 AND `+live, key).Scan(&fields)
+	if err == sql.ErrNoRows {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hash: %w", err)
+	}
+	values := make(map[string]string)
+	if err := json.Unmarshal(fields, &values); err != nil {
+		return nil, fmt.Errorf("failed to decode hash %s: %w", key, err)
+	}
+	return values, nil
+}
+
+func (s *PostgresStore) LPushTrim(ctx context.Context, key string, value string, maxLen int64, ttl time.Duration) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to push to list: %w", err)
+	}
+	defer tx.Rollback()
+
+	// A list that expired starts over.
+	if _, err := tx.ExecContext(ctx, `DELETE FROM store_lists WHERE key = $1 AND expires_at <= now()`, key); err != nil {
+		return fmt.Errorf("failed to push to list: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO store_lists (key, value) VALUES ($1, $2)`, key, value); err != nil {
+		return fmt.Errorf("failed to push to list: %w", err)
+	}
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM store_lists WHERE key = $1 AND id IN (
+			SELECT id FROM store_lists WHERE key = $1 ORDER BY id DESC OFFSET $2
+		)`, key, maxLen)
+	if err != nil {
+		return fmt.Errorf("failed to trim list: %w", err)
+	}
+	if ttl > 0 {
+		_, err := tx.ExecContext(ctx, `UPDATE store_lists SET expires_at = now() + $2 * interval '1 millisecond' WHERE key = $1`, key, ttl.Milliseconds())
+		if err != nil {
+			return fmt.Errorf("failed to push to list: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to push to list: %w", err)
+	}
+	return nil
+}
+
+// LRange returns the values from start to stop, newest first; a negative
+// stop means the end of the list.
+func (s *PostgresStore) LRange(ctx context.Context, key string, start, stop int64) ([]string, error) {
+	limit := sql.NullInt64{Int64: stop - start + 1, Valid: stop >= 0}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT value FROM store_lists WHERE key = $1 AND `+live+`
+		ORDER BY id DESC OFFSET $2 LIMIT $3`, key, start, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to range list: %w", err)
+	}
+	values, err := scanStrings(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to range list: %w", err)
+	}
+	return values, nil
+}
+
+func (s *PostgresStore) ZAdd(ctx context.Context, key string, score float64, member string) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO store_sorted_sets (key, member, score) VALUES ($1, $2, $3)
+		ON CONFLICT (key, member) DO UPDATE SET score = EXCLUDED.score`, key, member, score)
+	if err != nil {
+		return fmt.Errorf("failed to add to sorted set: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) ZRangeByScore(ctx context.Context, key string, min, max time.Time) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT member FROM store_sorted_sets
+		WHERE key = $1 AND score BETWEEN $2 AND $3
+		ORDER BY score, member`, key, timeScore(min), timeScore(max))
+	if err != nil {
+		return nil, fmt.Errorf("failed to range by score: %w", err)
+	}
+	members, err := scanStrings(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to range by score: %w", err)
+	}
+	return members, nil
+}
+
+func (s *PostgresStore) ZRem(ctx context.Context, key string, members ...string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM store_sorted_sets WHERE key = $1 AND member = ANY($2)`, key, pq.Array(members))
+	if err != nil {
+		return fmt.Errorf("failed to remove from sorted set: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) ZRemRangeBefore(ctx context.Context, key string, before time.Time) (int64, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM store_sorted_sets WHERE key = $1 AND score < $2`, key, timeScore(before))
+	if err != nil {
+		return 0, fmt.Errorf("failed to remove from sorted set: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// ZClaimDue skips members another claimer has locked, so concurrent pollers
+// never claim the same member.
+func (s *PostgresStore) ZClaimDue(ctx context.Context, key string, now time.Time, lease time.Duration, count int64) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		UPDATE store_sorted_sets SET score = $3
+		WHERE key = $1 AND member IN (
+			SELECT member FROM store_sorted_sets
+			WHERE key = $1 AND score <= $2
+			ORDER BY score LIMIT $4
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING member`, key, timeScore(now), timeScore(now.Add(lease)), count)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pop due members: %w", err)
+	}
+	members, err := scanStrings(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pop due members: %w", err)
+	}
+	return members, nil
+}
+
+func (s *PostgresStore) ZHeartbeat(ctx context.Context, key, member string, now time.Time, ttl time.Duration) ([]string, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to heartbeat: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO store_sorted_sets (key, member, score) VALUES ($1, $2, $3)
+		ON CONFLICT (key, member) DO UPDATE SET score = EXCLUDED.score`, key, member, timeScore(now))
+	if err != nil {
+		return nil, fmt.Errorf("failed to heartbeat: %w", err)
+	}
+	rows, err := tx.QueryContext(ctx, `
+		WITH expired AS (
+			DELETE FROM store_sorted_sets WHERE key = $1 AND score < $2 RETURNING member
+		)
+		SELECT member FROM store_sorted_sets
+		WHERE key = $1 AND member NOT IN (SELECT member FROM expired)
+		ORDER BY score`, key, timeScore(now.Add(-ttl)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to heartbeat: %w", err)
+	}
+	members, err := scanStrings(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to heartbeat: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to heartbeat: %w", err)
+	}
+	return members, nil
+}
+
+// ZCompact folds nothing: compaction only keeps Redis under maxmemory.
+func (s *PostgresStore) ZCompact(ctx context.Context, key, watermarkKey string, before time.Time, limit int64) (int64, error) {
+	return 0, nil
+}
+
+func (s *PostgresStore) PurgeSet(ctx context.Context, set string, keys ...string) (int64, int64, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to purge: %w", err)
+	}
+	defer tx.Rollback()
+
+	var members int64
+	err = tx.QueryRowContext(ctx, `
+		WITH purged AS (DELETE FROM store_sorted_sets WHERE key = $1 RETURNING 1)
+		SELECT count(*) FROM purged`, set).Scan(&members)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to purge: %w", err)
+	}
+	deleted, err := deleteKeys(ctx, tx, "key = ANY($1)", pq.Array(keys))
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to purge: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, 0, fmt.Errorf("failed to purge: %w", err)
+	}
+	return members, deleted, nil
+}
+
+func (s *PostgresStore) DeleteByPattern(ctx context.Context, pattern string) (int64, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete keys: %w", err)
+	}
+	defer tx.Rollback()
+
+	deleted, err := deleteKeys(ctx, tx, "key LIKE $1", globToLike(pattern))
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete keys: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to delete keys: %w", err)
+	}
+	return deleted, nil
+}
+
+func (s *PostgresStore) Trim(ctx context.Context) error {
+	for _, table := range []string{"store_keys", "store_hashes", "store_lists"} {
+		if _, err := s.db.ExecContext(ctx, `DELETE FROM `+table+` WHERE expires_at <= now()`); err != nil {
+			return fmt.Errorf("failed to trim %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+func (s *PostgresStore) MemoryUsage(ctx context.Context) (int64, int64, error) {
+	return 0, 0, nil
+}
+
+// execer is what the statements shared by transactions and the pool need.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func setKey(ctx context.Context, db execer, key, value string, ttl time.Duration) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO store_keys (key, value, expires_at)
+		VALUES ($1, $2, now() + $3 * interval '1 millisecond')
+		ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, expires_at = EXCLUDED.expires_at`,
+		key, value, ttl.Milliseconds())
+	return err
+}
+
+// hashUpdate sets the fields in $2 and adds the increments in $3 to the hash
+// $1, starting from an empty hash when it expired. The expiry becomes $4
+// milliseconds from now, or stays as it was when $4 is NULL.
+var hashUpdate = `
+	INSERT INTO store_hashes (key, fields, expires_at)
+	VALUES ($1, ` + incrementedFields(`$2::jsonb`) + `, now() + $4::bigint * interval '1 millisecond')
+	ON CONFLICT (key) DO UPDATE SET
+		fields = ` + incrementedFields(`(CASE WHEN store_hashes.expires_at <= now() THEN '{}'::jsonb ELSE store_hashes.fields END || $2::jsonb)`) + `,
+		expires_at = COALESCE(EXCLUDED.expires_at,
+			CASE WHEN store_hashes.expires_at <= now() THEN NULL ELSE store_hashes.expires_at END)`
+
+// incrementedFields is fields with the increments in $3 added to their
+// values. Values are kept as strings, the way Redis hands them back.
+func incrementedFields(fields string) string {
+	return fields + ` || COALESCE((
+		SELECT jsonb_object_agg(i.key, (COALESCE((` + fields + `)->>i.key, '0')::bigint + i.value::bigint)::text)
+		FROM jsonb_each_text($3::jsonb) AS i
+	), '{}'::jsonb)`
+}
+
+func updateHash(ctx context.Context, db execer, key string, values map[string]interface{}, increments map[string]int64, ttl time.Duration) error {
+	fields := make(map[string]string, len(values))
+	for field, value := range values {
+		fields[field] = fmt.Sprint(value)
+	}
+	encodedFields, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	if increments == nil {
+		increments = map[string]int64{}
+	}
+	encodedIncrements, err := json.Marshal(increments)
+	if err != nil {
+		return err
+	}
+	expiry := sql.NullInt64{Int64: ttl.Milliseconds(), Valid: ttl > 0}
+	_, err = db.ExecContext(ctx, hashUpdate, key, string(encodedFields), string(encodedIncrements), expiry)
+	return err
+}
+
+// deleteKeys deletes the keys, hashes, lists and sorted sets whose key
+// matches where and returns how many distinct keys it deleted.
+func deleteKeys(ctx context.Context, db execer, where string, arg interface{}) (int64, error) {
+	var deleted int64
+	err := db.QueryRowContext(ctx, `
+		WITH k AS (DELETE FROM store_keys WHERE `+where+` RETURNING key),
+		h AS (DELETE FROM store_hashes WHERE `+where+` RETURNING key),
+		l AS (DELETE FROM store_lists WHERE `+where+` RETURNING key),
+		z AS (DELETE FROM store_sorted_sets WHERE `+where+` RETURNING key)
+		SELECT count(DISTINCT key) FROM (
+			SELECT key FROM k UNION ALL SELECT key FROM h
+			UNION ALL SELECT key FROM l UNION ALL SELECT key FROM z
+		) AS deleted`, arg).Scan(&deleted)
+	return deleted, err
+}
+
+// globToLike turns a Redis glob pattern into a LIKE pattern. Character
+// classes are not supported.
+func globToLike(pattern string) string {
+	var like strings.Builder
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			escaped = false
+			if r == '%' || r == '_' || r == '\\' {
+				like.WriteRune('\\')
+			}
+			like.WriteRune(r)
+		case r == '\\':
+			escaped = true
+		case r == '*':
+			like.WriteRune('%')
+		case r == '?':
+			like.WriteRune('_')
+		case r == '%' || r == '_':
+			like.WriteRune('\\')
+			like.WriteRune(r)
+		default:
+			like.WriteRune(r)
+		}
+	}
+	return like.String()
+}
+
+func timeScore(t time.Time) float64 {
+	return float64(t.UnixNano()) / 1e9
+}
+
+func scanStrings(rows *sql.Rows) ([]string, error) {
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
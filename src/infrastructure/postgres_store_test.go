@@ -0,0 +1,261 @@
+package infrastructure
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"payment-processor/core/models"
+	"payment-processor/infrastructure/migrations"
+	"slices"
+	"testing"
+	"time"
+)
+
+// testPostgresStore returns a store over the empty store tables of the
+// database at TEST_POSTGRES_URL, and skips the test when it is unset.
+func testPostgresStore(t *testing.T) *PostgresStore {
+	t.Helper()
+	url := os.Getenv("TEST_POSTGRES_URL")
+	if url == "" {
+		t.Skip("TEST_POSTGRES_URL is not set")
+	}
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Exec(migrations.StoreTables); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`TRUNCATE store_keys, store_hashes, store_lists, store_sorted_sets`); err != nil {
+		t.Fatal(err)
+	}
+	return NewPostgresStore(db, url)
+}
+
+func TestGlobToLike(t *testing.T) {
+	tests := []struct {
+		glob, want string
+	}{
+		{"payment:status:*", "payment:status:%"},
+		{"key?", "key_"},
+		{"100%_done*", `100\%\_done%`},
+		{`literal\*star`, "literal*star"},
+		{`back\\slash`, `back\\slash`},
+	}
+	for _, tt := range tests {
+		if got := globToLike(tt.glob); got != tt.want {
+			t.Errorf("globToLike(%q) = %q, want %q", tt.glob, got, tt.want)
+		}
+	}
+}
+
+func TestPostgresStoreKeys(t *testing.T) {
+	ctx := context.Background()
+	s := testPostgresStore(t)
+
+	if value, err := s.Get(ctx, "missing"); err != nil || value != "" {
+		t.Fatalf("Get of a missing key = %q, %v", value, err)
+	}
+	if err := s.Set(ctx, "a", "1", 60); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := s.Get(ctx, "a"); value != "1" {
+		t.Errorf("Get = %q, want 1", value)
+	}
+	if err := s.Set(ctx, "expired", "1", 0); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := s.Get(ctx, "expired"); value != "" {
+		t.Errorf("expired key = %q, want none", value)
+	}
+
+	for want := int64(1); want <= 2; want++ {
+		if got, err := s.Incr(ctx, "counter"); err != nil || got != want {
+			t.Fatalf("Incr = %d, %v, want %d", got, err, want)
+		}
+	}
+	// An expired value counts from zero again.
+	if got, _ := s.Incr(ctx, "expired"); got != 1 {
+		t.Errorf("Incr of an expired key = %d, want 1", got)
+	}
+}
+
+func TestPostgresStoreLease(t *testing.T) {
+	ctx := context.Background()
+	s := testPostgresStore(t)
+
+	if held, err := s.AcquireLease(ctx, "lease", "a", time.Minute); err != nil || !held {
+		t.Fatalf("first AcquireLease = %v, %v", held, err)
+	}
+	if held, _ := s.AcquireLease(ctx, "lease", "b", time.Minute); held {
+		t.Error("another owner took a live lease")
+	}
+	if held, _ := s.AcquireLease(ctx, "lease", "a", time.Minute); !held {
+		t.Error("owner could not renew its lease")
+	}
+	if held, _ := s.AcquireLease(ctx, "lease", "a", 0); !held {
+		t.Fatal("owner could not shorten its lease")
+	}
+	if held, _ := s.AcquireLease(ctx, "lease", "b", time.Minute); !held {
+		t.Error("expired lease was not taken over")
+	}
+}
+
+func TestPostgresStoreHashes(t *testing.T) {
+	ctx := context.Background()
+	s := testPostgresStore(t)
+
+	if values, err := s.HGetAll(ctx, "missing"); err != nil || len(values) != 0 {
+		t.Fatalf("HGetAll of a missing hash = %v, %v", values, err)
+	}
+	err := s.HUpdate(ctx, "h", map[string]interface{}{"state": "queued", "attempts": 0}, map[string]int64{"dispatches": 1}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.HUpdate(ctx, "h", map[string]interface{}{"state": "processed"}, map[string]int64{"dispatches": 2, "attempts": 1}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := s.HGetAll(ctx, "h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"state": "processed", "attempts": "1", "dispatches": "3"}
+	for field, value := range want {
+		if values[field] != value {
+			t.Errorf("%s = %q, want %q", field, values[field], value)
+		}
+	}
+
+	err = s.HUpdateMany(ctx, []models.HashUpdate{
+		{Key: "h1", Values: map[string]interface{}{"state": "queued"}},
+		{Key: "h2", Values: map[string]interface{}{"state": "queued"}},
+	}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values, _ := s.HGetAll(ctx, "h2"); values["state"] != "queued" {
+		t.Errorf("HUpdateMany left %v", values)
+	}
+}
+
+func TestPostgresStoreLists(t *testing.T) {
+	ctx := context.Background()
+	s := testPostgresStore(t)
+
+	for _, value := range []string{"1", "2", "3", "4"} {
+		if err := s.LPushTrim(ctx, "l", value, 3, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+	values, err := s.LRange(ctx, "l", 0, -1)
+	if err != nil || !slices.Equal(values, []string{"4", "3", "2"}) {
+		t.Fatalf("LRange = %v, %v, want the newest three first", values, err)
+	}
+	if values, _ := s.LRange(ctx, "l", 1, 1); !slices.Equal(values, []string{"3"}) {
+		t.Errorf("LRange 1..1 = %v", values)
+	}
+}
+
+func TestPostgresStoreSortedSets(t *testing.T) {
+	ctx := context.Background()
+	s := testPostgresStore(t)
+	now := time.Now()
+
+	for i, member := range []string{"a", "b", "c"} {
+		if err := s.ZAdd(ctx, "z", timeScore(now.Add(time.Duration(i)*time.Second)), member); err != nil {
+			t.Fatal(err)
+		}
+	}
+	members, err := s.ZRangeByScore(ctx, "z", now, now.Add(time.Second))
+	if err != nil || !slices.Equal(members, []string{"a", "b"}) {
+		t.Fatalf("ZRangeByScore = %v, %v", members, err)
+	}
+
+	claimed, err := s.ZClaimDue(ctx, "z", now.Add(time.Second), time.Minute, 10)
+	slices.Sort(claimed)
+	if err != nil || !slices.Equal(claimed, []string{"a", "b"}) {
+		t.Fatalf("ZClaimDue = %v, %v", claimed, err)
+	}
+	if claimed, _ := s.ZClaimDue(ctx, "z", now.Add(time.Second), time.Minute, 10); len(claimed) != 0 {
+		t.Errorf("claimed %v again within the lease", claimed)
+	}
+
+	if err := s.ZRem(ctx, "z", "a", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if removed, _ := s.ZRemRangeBefore(ctx, "z", now.Add(time.Hour)); removed != 1 {
+		t.Errorf("ZRemRangeBefore removed %d, want 1", removed)
+	}
+}
+
+func TestPostgresStoreHeartbeat(t *testing.T) {
+	ctx := context.Background()
+	s := testPostgresStore(t)
+	now := time.Now()
+
+	s.ZHeartbeat(ctx, "members", "stale", now.Add(-time.Minute), time.Second)
+	s.ZHeartbeat(ctx, "members", "b", now, time.Second)
+	members, err := s.ZHeartbeat(ctx, "members", "a", now, time.Second)
+	slices.Sort(members)
+	if err != nil || !slices.Equal(members, []string{"a", "b"}) {
+		t.Errorf("ZHeartbeat = %v, %v, want the stale member dropped", members, err)
+	}
+}
+
+func TestPostgresStorePurge(t *testing.T) {
+	ctx := context.Background()
+	s := testPostgresStore(t)
+
+	s.ZAdd(ctx, "processed", 1, "a")
+	s.ZAdd(ctx, "processed", 2, "b")
+	s.Set(ctx, "score", "1", 60)
+	s.HUpdate(ctx, "status:a", map[string]interface{}{"state": "queued"}, nil, time.Minute)
+	s.HUpdate(ctx, "status:b", map[string]interface{}{"state": "queued"}, nil, time.Minute)
+	s.LPushTrim(ctx, "status_log", "1", 10, time.Minute)
+
+	members, keys, err := s.PurgeSet(ctx, "processed", "score", "missing")
+	if err != nil || members != 2 || keys != 1 {
+		t.Fatalf("PurgeSet = %d, %d, %v, want 2, 1", members, keys, err)
+	}
+	if deleted, err := s.DeleteByPattern(ctx, "status:*"); err != nil || deleted != 2 {
+		t.Errorf("DeleteByPattern = %d, %v, want the two hashes but not the list", deleted, err)
+	}
+}
+
+func TestPostgresStorePublish(t *testing.T) {
+	s := testPostgresStore(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	messages := s.Subscribe(ctx, "status_channel")
+	// The subscription listens once its connection is up, so publish until
+	// it hears one.
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	timeout := time.After(5 * time.Second)
+	for received := false; !received; {
+		if err := s.SetPublish(ctx, "status", "status_channel", "v1", time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case payload := <-messages:
+			if payload != "v1" {
+				t.Errorf("received %q, want v1", payload)
+			}
+			received = true
+		case <-ticker.C:
+		case <-timeout:
+			t.Fatal("no notification received")
+		}
+	}
+	if value, _ := s.Get(ctx, "status"); value != "v1" {
+		t.Errorf("published value not stored: %q", value)
+	}
+
+	// Ending the context closes the subscription.
+	cancel()
+	for range messages {
+	}
+}
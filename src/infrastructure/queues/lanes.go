@@ -0,0 +1,327 @@
+package queues
+
+import (
+	"context"
+	"fmt"
+	"payment-processor/core/models"
+	"payment-processor/interfaces"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultLane holds messages that name no lane, and every message when lanes
+// are disabled.
+const defaultLane = string(models.PriorityNormal)
+
+// blockSlice bounds how long a composite queue blocks on one of its queues
+// while all of them are empty, so a message arriving on another waits at most
+// this long per queue.
+const blockSlice = 50 * time.Millisecond
+
+// LaneQueue spreads messages over one queue per priority lane, routed by
+// their models.QueueLaneField, and consumes them with smooth weighted
+// round-robin: each lane gets batches in proportion to its weight while it
+// has messages, so higher lanes are served first without starving the
+// others. Ids of lanes other than the default one are prefixed with
+// "<lane>:" so deliveries can be routed back.
+type LaneQueue struct {
+	lanes  []*lane
+	byName map[string]*lane
+
+	mu sync.Mutex
+}
+
+type lane struct {
+	name    string
+	weight  int
+	current int
+	queue   interfaces.Queue
+}
+
+// ParseLanes reads a PRIORITY_LANES spec such as "high:4,normal:2,low:1".
+// The normal lane is added with weight 1 when the spec leaves it out. A spec
+// naming a lane twice, or none at all, is invalid.
+func ParseLanes(spec string) ([]string, []int, error) {
+	var (
+		names   []string
+		weights []int
+		normal  bool
+	)
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, rawWeight, _ := strings.Cut(entry, ":")
+		weight, err := strconv.Atoi(rawWeight)
+		if !models.Priority(name).Valid() || name == "" || err != nil || weight < 1 {
+			return nil, nil, fmt.Errorf("invalid priority lane %q, expected <high|normal|low>:<weight>", entry)
+		}
+		if seen[name] {
+			return nil, nil, fmt.Errorf("priority lane %q is listed more than once", name)
+		}
+		seen[name] = true
+		normal = normal || name == defaultLane
+		names = append(names, name)
+		weights = append(weights, weight)
+	}
+	if len(names) == 0 {
+		return nil, nil, fmt.Errorf("priority lanes %q name no lane, expected <high|normal|low>:<weight>", spec)
+	}
+	if !normal {
+		names = append(names, defaultLane)
+		weights = append(weights, 1)
+	}
+	return names, weights, nil
+}
+
+// NewLaneQueue orders the lanes by descending weight, keeping the given order
+// between equal weights, so an empty lane falls through to the heaviest of the
+// others.
+func NewLaneQueue(names []string, weights []int, newQueue func(lane string) interfaces.Queue) *LaneQueue {
+	q := &LaneQueue{byName: make(map[string]*lane, len(names))}
+	for i, name := range names {
+		l := &lane{name: name, weight: weights[i], queue: newQueue(name)}
+		q.lanes = append(q.lanes, l)
+		q.byName[name] = l
+	}
+	sort.SliceStable(q.lanes, func(i, j int) bool {
+		return q.lanes[i].weight > q.lanes[j].weight
+	})
+	return q
+}
+
+func (q *LaneQueue) Setup(ctx context.Context) error {
+	for _, l := range q.lanes {
+		if err := l.queue.Setup(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (q *LaneQueue) Ping(ctx context.Context) error {
+	return q.lanes[0].queue.Ping(ctx)
+}
+
+func (q *LaneQueue) Enqueue(ctx context.Context, window time.Duration, maxLen int64, items []models.QueueItem) ([]models.QueueAddResult, []error) {
+	results := make([]models.QueueAddResult, len(items))
+	errs := make([]error, len(items))
+
+	// Each lane gets an even share of the cap, rounded up like partitions.
+	if maxLen > 0 {
+		lanes := int64(len(q.lanes))
+		maxLen = max(1, (maxLen+lanes-1)/lanes)
+	}
+	batches := make(map[*lane][]int)
+	for i, item := range items {
+		l := q.laneOf(item.Values)
+		batches[l] = append(batches[l], i)
+	}
+	for l, indexes := range batches {
+		laneItems := make([]models.QueueItem, len(indexes))
+		for j, i := range indexes {
+			laneItems[j] = items[i]
+		}
+		laneResults, laneErrs := l.queue.Enqueue(ctx, window, maxLen, laneItems)
+		for j, i := range indexes {
+			results[i], errs[i] = laneResults[j], laneErrs[j]
+		}
+	}
+	return results, errs
+}
+
+// Consume takes a batch from the lanes in weighted round-robin order, falling
+// through to the next lane while one is empty. When all are empty it blocks
+// on each lane in turn for at most blockSlice until block has passed.
+func (q *LaneQueue) Consume(ctx context.Context, consumer string, count int64, block time.Duration) ([]models.QueueMessage, error) {
+	deadline := time.Now().Add(block)
+	for {
+		order := q.schedule()
+		for _, l := range order {
+			messages, err := l.queue.Consume(ctx, consumer, count, 0)
+			if err != nil || len(messages) > 0 {
+				return q.tag(l, messages), err
+			}
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil, nil
+		}
+		messages, err := order[0].queue.Consume(ctx, consumer, count, min(remaining, blockSlice))
+		if err != nil || len(messages) > 0 {
+			return q.tag(order[0], messages), err
+		}
+	}
+}
+
+// schedule picks the next lane by smooth weighted round-robin and returns
+// it first, followed by the other lanes by descending weight.
+func (q *LaneQueue) schedule() []*lane {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	total := 0
+	var next *lane
+	for _, l := range q.lanes {
+		l.current += l.weight
+		total += l.weight
+		if next == nil || l.current > next.current {
+			next = l
+		}
+	}
+	next.current -= total
+
+	order := []*lane{next}
+	for _, l := range q.lanes {
+		if l != next {
+			order = append(order, l)
+		}
+	}
+	return order
+}
+
+func (q *LaneQueue) Reclaim(ctx context.Context, consumer string, minIdle time.Duration, count int64) ([]models.QueueMessage, error) {
+	var claimed []models.QueueMessage
+	for _, l := range q.lanes {
+		if int64(len(claimed)) >= count {
+			break
+		}
+		messages, err := l.queue.Reclaim(ctx, consumer, minIdle, count-int64(len(claimed)))
+		claimed = append(claimed, q.tag(l, messages)...)
+		if err != nil {
+			return claimed, err
+		}
+	}
+	return claimed, nil
+}
+
+func (q *LaneQueue) Ack(ctx context.Context, id string) error {
+	l, id := q.route(id)
+	return l.queue.Ack(ctx, id)
+}
+
+func (q *LaneQueue) Backlog(ctx context.Context) (int64, int64, error) {
+	var lag, pending int64
+	for _, l := range q.lanes {
+		laneLag, lanePending, err := l.queue.Backlog(ctx)
+		if err != nil {
+			return 0, 0, err
+		}
+		lag += laneLag
+		pending += lanePending
+	}
+	return lag, pending, nil
+}
+
+func (q *LaneQueue) OldestUnacked(ctx context.Context) (time.Time, error) {
+	var oldest time.Time
+	for _, l := range q.lanes {
+		laneOldest, err := l.queue.OldestUnacked(ctx)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if !laneOldest.IsZero() && (oldest.IsZero() || laneOldest.Before(oldest)) {
+			oldest = laneOldest
+		}
+	}
+	return oldest, nil
+}
+
+// Retry keeps the message in its lane.
+func (q *LaneQueue) Retry(ctx context.Context, id string, values map[string]interface{}, at time.Time) error {
+	l, id := q.route(id)
+	return l.queue.Retry(ctx, id, values, at)
+}
+
+func (q *LaneQueue) ReleaseDue(ctx context.Context, now time.Time, count int64) (int64, error) {
+	var released int64
+	for _, l := range q.lanes {
+		laneReleased, err := l.queue.ReleaseDue(ctx, now, count)
+		released += laneReleased
+		if err != nil {
+			return released, err
+		}
+	}
+	return released, nil
+}
+
+func (q *LaneQueue) DeadLetter(ctx context.Context, id string, values map[string]interface{}) error {
+	l, id := q.route(id)
+	return l.queue.DeadLetter(ctx, id, values)
+}
+
+// Dead letters are shared by the lanes, any of them can list them.
+func (q *LaneQueue) DeadLetters(ctx context.Context, start string, count int64) ([]models.QueueMessage, int64, error) {
+	return q.lanes[0].queue.DeadLetters(ctx, start, count)
+}
+
+// ReplayDeadLetter queues the dead letter in the lane named by values.
+func (q *LaneQueue) ReplayDeadLetter(ctx context.Context, id string, values map[string]interface{}) (string, bool, error) {
+	l := q.laneOf(values)
+	newID, found, err := l.queue.ReplayDeadLetter(ctx, id, values)
+	if found && l.name != defaultLane {
+		newID = l.name + ":" + newID
+	}
+	return newID, found, err
+}
+
+func (q *LaneQueue) DiscardDeadLetter(ctx context.Context, id string) (bool, error) {
+	return q.lanes[0].queue.DiscardDeadLetter(ctx, id)
+}
+
+func (q *LaneQueue) Trim(ctx context.Context, maxDeadLetters int64) error {
+	for _, l := range q.lanes {
+		if err := l.queue.Trim(ctx, maxDeadLetters); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (q *LaneQueue) Purge(ctx context.Context) (int64, error) {
+	var purged int64
+	for _, l := range q.lanes {
+		lanePurged, err := l.queue.Purge(ctx)
+		purged += lanePurged
+		if err != nil {
+			return purged, err
+		}
+	}
+	return purged, nil
+}
+
+// laneOf returns the lane named by values, or the default lane when it names
+// none or one that is not configured.
+func (q *LaneQueue) laneOf(values map[string]interface{}) *lane {
+	name, _ := values[models.QueueLaneField].(string)
+	if l, ok := q.byName[name]; ok {
+		return l
+	}
+	return q.byName[defaultLane]
+}
+
+// route returns the lane of a tagged id and the id within that lane.
+func (q *LaneQueue) route(id string) (*lane, string) {
+	if name, laneID, ok := strings.Cut(id, ":"); ok {
+		if l, ok := q.byName[name]; ok {
+			return l, laneID
+		}
+	}
+	return q.byName[defaultLane], id
+}
+
+func (q *LaneQueue) tag(l *lane, messages []models.QueueMessage) []models.QueueMessage {
+	if l.name == defaultLane {
+		return messages
+	}
+	for i := range messages {
+		messages[i].ID = l.name + ":" + messages[i].ID
+	}
+	return messages
+}
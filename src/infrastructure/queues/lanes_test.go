@@ -0,0 +1,168 @@
+package queues
+
+import (
+	"context"
+	"fmt"
+	"payment-processor/core/models"
+	"payment-processor/interfaces"
+	"reflect"
+	"testing"
+)
+
+func TestParseLanes(t *testing.T) {
+	tests := []struct {
+		spec    string
+		names   []string
+		weights []int
+	}{
+		{"high:4,normal:2,low:1", []string{"high", "normal", "low"}, []int{4, 2, 1}},
+		{"high:3", []string{"high", "normal"}, []int{3, 1}},
+		{" low:1 , high:5 ,", []string{"low", "high", "normal"}, []int{1, 5, 1}},
+	}
+	for _, tt := range tests {
+		names, weights, err := ParseLanes(tt.spec)
+		if err != nil || !reflect.DeepEqual(names, tt.names) || !reflect.DeepEqual(weights, tt.weights) {
+			t.Errorf("ParseLanes(%q) = %v, %v, %v, want %v, %v", tt.spec, names, weights, err, tt.names, tt.weights)
+		}
+	}
+
+	for _, spec := range []string{"", " , ", "urgent:1", "high", "high:0", "high:x", ":2", "high:2,high:1", "normal:1,low:1,normal:2"} {
+		if names, _, err := ParseLanes(spec); err == nil {
+			t.Errorf("ParseLanes(%q) = %v, want an error", spec, names)
+		}
+	}
+}
+
+func newMemoryLanes(spec string) *LaneQueue {
+	names, weights, err := ParseLanes(spec)
+	if err != nil {
+		panic(err)
+	}
+	store := newMemoryStore()
+	return NewLaneQueue(names, weights, func(lane string) interfaces.Queue {
+		return store.lane(lane)
+	})
+}
+
+func laneNames(lanes []*lane) []string {
+	names := make([]string, len(lanes))
+	for i, l := range lanes {
+		names[i] = l.name
+	}
+	return names
+}
+
+func TestLaneQueueFallsThroughByWeight(t *testing.T) {
+	q := newMemoryLanes("low:1,normal:2,high:4")
+	if got := laneNames(q.lanes); !reflect.DeepEqual(got, []string{"high", "normal", "low"}) {
+		t.Fatalf("lanes = %v, want them by descending weight", got)
+	}
+	for i := 0; i < 7; i++ {
+		order := laneNames(q.schedule())
+		rest := make([]string, 0, 2)
+		for _, name := range []string{"high", "normal", "low"} {
+			if name != order[0] {
+				rest = append(rest, name)
+			}
+		}
+		if !reflect.DeepEqual(order[1:], rest) {
+			t.Errorf("schedule = %v, want the others by descending weight", order)
+		}
+	}
+}
+
+func TestLaneQueueWeightedRoundRobin(t *testing.T) {
+	ctx := context.Background()
+	q := newMemoryLanes("high:4,normal:2,low:1")
+	var items []models.QueueItem
+	for _, priority := range []string{"high", "normal", "low"} {
+		for i := 0; i < 20; i++ {
+			item := queueItem(fmt.Sprintf("%s-%d", priority, i), "1")
+			item.Values[models.QueueLaneField] = priority
+			items = append(items, item)
+		}
+	}
+	enqueue(t, q, 0, items...)
+
+	batches := make(map[string]int)
+	for i := 0; i < 7; i++ {
+		messages, err := q.Consume(ctx, "worker", 1, 0)
+		if err != nil || len(messages) != 1 {
+			t.Fatalf("Consume = %v, %v", messages, err)
+		}
+		batches[messages[0].Values[models.QueueLaneField].(string)]++
+		if err := q.Ack(ctx, messages[0].ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := map[string]int{"high": 4, "normal": 2, "low": 1}; !reflect.DeepEqual(batches, want) {
+		t.Errorf("7 batches came from %v, want %v", batches, want)
+	}
+	if waiting, pending, _ := q.Backlog(ctx); waiting != 53 || pending != 0 {
+		t.Errorf("Backlog = %d, %d, want 53, 0", waiting, pending)
+	}
+}
+
+func TestLaneQueueRoutesIDs(t *testing.T) {
+	ctx := context.Background()
+	q := newMemoryLanes("high:2")
+	high := queueItem("a", "1")
+	high.Values[models.QueueLaneField] = "high"
+	unknown := queueItem("b", "1")
+	unknown.Values[models.QueueLaneField] = "urgent"
+	enqueue(t, q, 0, high, unknown)
+
+	messages, _ := q.Consume(ctx, "worker", 10, 0)
+	more, _ := q.Consume(ctx, "worker", 10, 0)
+	messages = append(messages, more...)
+	if len(messages) != 2 {
+		t.Fatalf("consumed %v", messages)
+	}
+	for _, message := range messages {
+		l, _ := q.route(message.ID)
+		want := defaultLane
+		if message.Values["correlationId"] == "a" {
+			want = "high"
+		}
+		if l.name != want {
+			t.Errorf("%s routed to lane %s, want %s", message.ID, l.name, want)
+		}
+		if err := q.Ack(ctx, message.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, pending, _ := q.Backlog(ctx); pending != 0 {
+		t.Errorf("%d deliveries still pending after acking them", pending)
+	}
+}
+
+func TestLaneQueueMaxLenShare(t *testing.T) {
+	tests := []struct {
+		spec   string
+		maxLen int64
+		want   int64
+	}{
+		{"high:4,low:1", 2, 1},
+		{"high:4,low:1", 6, 2},
+		{"high:4,low:1", 7, 3},
+		{"high:1", 3, 2},
+	}
+	for _, tt := range tests {
+		q := newMemoryLanes(tt.spec)
+		accepted := make(map[string]int64)
+		for _, l := range q.lanes {
+			for i := 0; i < 10; i++ {
+				item := queueItem(fmt.Sprintf("%s-%d", l.name, i), "1")
+				item.Values[models.QueueLaneField] = l.name
+				if results := enqueue(t, q, tt.maxLen, item); results[0] == models.QueueAddAccepted {
+					accepted[l.name]++
+				}
+			}
+		}
+		for _, l := range q.lanes {
+			if accepted[l.name] != tt.want {
+				t.Errorf("%s, maxLen %d: lane %s took %d, want %d", tt.spec, tt.maxLen, l.name, accepted[l.name], tt.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,356 @@
+package queues
+
+import (
+	"context"
+	"payment-processor/core/models"
+	"payment-processor/infrastructure"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MemoryQueue is an in-process queue for single-node deployments and tests.
+// It follows the Redis backend's semantics, ids included, but nothing
+// survives a restart and other instances cannot see it. Each priority lane is
+// a MemoryQueue of its own sharing one store, so ids, dead letters and
+// idempotency keys are common to all lanes.
+type MemoryQueue struct {
+	*memoryStore
+	wake     chan struct{}
+	ready    []models.QueueMessage
+	inflight map[string]*memoryDelivery
+	retries  []memoryRetry
+}
+
+// memoryStore is the state shared by the lanes; its mutex guards the lanes'
+// state too.
+type memoryStore struct {
+	mu      sync.Mutex
+	lastMs  int64
+	lastSeq int64
+	dead    []models.QueueMessage
+	keys    map[string]memoryKey
+	lanes   map[string]*MemoryQueue
+}
+
+type memoryDelivery struct {
+	message   models.QueueMessage
+	consumer  string
+	delivered time.Time
+}
+
+type memoryRetry struct {
+	at     time.Time
+	values map[string]interface{}
+}
+
+type memoryKey struct {
+	fingerprint string
+	expires     time.Time
+}
+
+var (
+	memoryQueues     *memoryStore
+	memoryQueuesOnce sync.Once
+)
+
+// GetMemoryQueue returns the process-wide queue of lane.
+func GetMemoryQueue(lane string) *MemoryQueue {
+	memoryQueuesOnce.Do(func() {
+		memoryQueues = newMemoryStore()
+	})
+	return memoryQueues.lane(lane)
+}
+
+// NewMemoryQueue returns a standalone single-lane queue.
+func NewMemoryQueue() *MemoryQueue {
+	return newMemoryStore().lane(defaultLane)
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		keys:  make(map[string]memoryKey),
+		lanes: make(map[string]*MemoryQueue),
+	}
+}
+
+func (s *memoryStore) lane(name string) *MemoryQueue {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if q, ok := s.lanes[name]; ok {
+		return q
+	}
+	q := &MemoryQueue{
+		memoryStore: s,
+		wake:        make(chan struct{}),
+		inflight:    make(map[string]*memoryDelivery),
+	}
+	s.lanes[name] = q
+	return q
+}
+
+func (q *MemoryQueue) Setup(ctx context.Context) error {
+	return nil
+}
+
+func (q *MemoryQueue) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (q *MemoryQueue) Enqueue(ctx context.Context, window time.Duration, maxLen int64, items []models.QueueItem) ([]models.QueueAddResult, []error) {
+	results := make([]models.QueueAddResult, len(items))
+	errs := make([]error, len(items))
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := time.Now()
+	for i, item := range items {
+		if key, ok := q.keys[item.Key]; ok && now.Before(key.expires) {
+			if key.fingerprint == item.Fingerprint {
+				results[i] = models.QueueAddDuplicate
+			} else {
+				results[i] = models.QueueAddConflict
+			}
+			continue
+		}
+		if maxLen > 0 && int64(len(q.ready)+len(q.inflight)) >= maxLen {
+			results[i] = models.QueueAddFull
+			continue
+		}
+		q.keys[item.Key] = memoryKey{fingerprint: item.Fingerprint, expires: now.Add(window)}
+		q.push(item.Values)
+	}
+	return results, errs
+}
+
+func (q *MemoryQueue) Consume(ctx context.Context, consumer string, count int64, block time.Duration) ([]models.QueueMessage, error) {
+	timer := time.NewTimer(block)
+	defer timer.Stop()
+	for {
+		q.mu.Lock()
+		if len(q.ready) > 0 {
+			messages := q.deliver(consumer, count)
+			q.mu.Unlock()
+			return messages, nil
+		}
+		wake := q.wake
+		q.mu.Unlock()
+
+		select {
+		case <-wake:
+		case <-timer.C:
+			return nil, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (q *MemoryQueue) Reclaim(ctx context.Context, consumer string, minIdle time.Duration, count int64) ([]models.QueueMessage, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	var messages []models.QueueMessage
+	for _, delivery := range q.inflight {
+		if int64(len(messages)) >= count {
+			break
+		}
+		if now.Sub(delivery.delivered) < minIdle {
+			continue
+		}
+		delivery.consumer = consumer
+		delivery.delivered = now
+		messages = append(messages, copyMessage(delivery.message))
+	}
+	sortMessages(messages)
+	return messages, nil
+}
+
+func (q *MemoryQueue) Ack(ctx context.Context, id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.inflight, id)
+	return nil
+}
+
+func (q *MemoryQueue) Backlog(ctx context.Context) (int64, int64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return int64(len(q.ready)), int64(len(q.inflight)), nil
+}
+
+func (q *MemoryQueue) OldestUnacked(ctx context.Context) (time.Time, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	oldest := ""
+	if len(q.ready) > 0 {
+		oldest = q.ready[0].ID
+	}
+	for id := range q.inflight {
+		if oldest == "" || infrastructure.CompareStreamIDs(id, oldest) < 0 {
+			oldest = id
+		}
+	}
+	if oldest == "" {
+		return time.Time{}, nil
+	}
+	return infrastructure.StreamIDTime(oldest), nil
+}
+
+func (q *MemoryQueue) Retry(ctx context.Context, id string, values map[string]interface{}, at time.Time) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.inflight, id)
+	q.retries = append(q.retries, memoryRetry{at: at, values: values})
+	return nil
+}
+
+func (q *MemoryQueue) ReleaseDue(ctx context.Context, now time.Time, count int64) (int64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var released int64
+	pending := q.retries[:0]
+	for _, retry := range q.retries {
+		if released < count && !retry.at.After(now) {
+			q.push(retry.values)
+			released++
+			continue
+		}
+		pending = append(pending, retry)
+	}
+	q.retries = pending
+	return released, nil
+}
+
+func (q *MemoryQueue) DeadLetter(ctx context.Context, id string, values map[string]interface{}) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.inflight, id)
+	q.dead = append(q.dead, models.QueueMessage{ID: q.nextID(), Values: messageValues(stringValues(values))})
+	return nil
+}
+
+func (q *MemoryQueue) DeadLetters(ctx context.Context, start string, count int64) ([]models.QueueMessage, int64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	from := 0
+	if start != "" {
+		from = sort.Search(len(q.dead), func(i int) bool {
+			return infrastructure.CompareStreamIDs(q.dead[i].ID, start) >= 0
+		})
+	}
+	var messages []models.QueueMessage
+	for i := from; i < len(q.dead) && int64(len(messages)) < count; i++ {
+		messages = append(messages, copyMessage(q.dead[i]))
+	}
+	return messages, int64(len(q.dead)), nil
+}
+
+func (q *MemoryQueue) ReplayDeadLetter(ctx context.Context, id string, values map[string]interface{}) (string, bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	i := q.deadLetterIndex(id)
+	if i < 0 {
+		return "", false, nil
+	}
+	q.dead = append(q.dead[:i], q.dead[i+1:]...)
+	return q.push(values), true, nil
+}
+
+func (q *MemoryQueue) DiscardDeadLetter(ctx context.Context, id string) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	i := q.deadLetterIndex(id)
+	if i < 0 {
+		return false, nil
+	}
+	q.dead = append(q.dead[:i], q.dead[i+1:]...)
+	return true, nil
+}
+
+// Trim forgets expired idempotency keys and drops the oldest dead letters;
+// acked messages are released as soon as they are acked.
+func (q *MemoryQueue) Trim(ctx context.Context, maxDeadLetters int64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	for key, value := range q.keys {
+		if !now.Before(value.expires) {
+			delete(q.keys, key)
+		}
+	}
+	if maxDeadLetters > 0 && int64(len(q.dead)) > maxDeadLetters {
+		q.dead = append([]models.QueueMessage(nil), q.dead[int64(len(q.dead))-maxDeadLetters:]...)
+	}
+	return nil
+}
+
+func (q *MemoryQueue) Purge(ctx context.Context) (int64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	queued := int64(len(q.ready) + len(q.inflight))
+	q.ready = nil
+	q.inflight = make(map[string]*memoryDelivery)
+	q.retries = nil
+	q.dead = nil
+	q.keys = make(map[string]memoryKey)
+	return queued, nil
+}
+
+// push appends values as a new message and wakes every waiting consumer.
+// Callers hold q.mu.
+func (q *MemoryQueue) push(values map[string]interface{}) string {
+	id := q.nextID()
+	q.ready = append(q.ready, models.QueueMessage{ID: id, Values: messageValues(stringValues(values))})
+	close(q.wake)
+	q.wake = make(chan struct{})
+	return id
+}
+
+// deliver moves up to count ready messages in flight for consumer. Callers
+// hold q.mu.
+func (q *MemoryQueue) deliver(consumer string, count int64) []models.QueueMessage {
+	n := len(q.ready)
+	if int64(n) > count {
+		n = int(count)
+	}
+	now := time.Now()
+	messages := make([]models.QueueMessage, n)
+	for i, message := range q.ready[:n] {
+		q.inflight[message.ID] = &memoryDelivery{message: message, consumer: consumer, delivered: now}
+		messages[i] = copyMessage(message)
+	}
+	q.ready = append(q.ready[:0:0], q.ready[n:]...)
+	return messages
+}
+
+func (q *MemoryQueue) deadLetterIndex(id string) int {
+	i := sort.Search(len(q.dead), func(i int) bool {
+		return infrastructure.CompareStreamIDs(q.dead[i].ID, id) >= 0
+	})
+	if i < len(q.dead) && q.dead[i].ID == id {
+		return i
+	}
+	return -1
+}
+
+// nextID returns a Redis-style "<ms>-<seq>" id greater than every previous
+// one of any lane. Callers hold s.mu.
+func (s *memoryStore) nextID() string {
+	ms := time.Now().UnixMilli()
+	if ms > s.lastMs {
+		s.lastMs, s.lastSeq = ms, 0
+	} else {
+		s.lastSeq++
+	}
+	return strconv.FormatInt(s.lastMs, 10) + "-" + strconv.FormatInt(s.lastSeq, 10)
+}
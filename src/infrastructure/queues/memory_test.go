@@ -0,0 +1,207 @@
+package queues
+
+import (
+	"context"
+	"payment-processor/core/models"
+	"payment-processor/infrastructure"
+	"payment-processor/interfaces"
+	"testing"
+	"time"
+)
+
+func queueItem(key, fingerprint string) models.QueueItem {
+	return models.QueueItem{Key: key, Fingerprint: fingerprint, Values: map[string]interface{}{"correlationId": key, "amount": 1990}}
+}
+
+func enqueue(t *testing.T, q interfaces.Queue, maxLen int64, items ...models.QueueItem) []models.QueueAddResult {
+	t.Helper()
+	results, errs := q.Enqueue(context.Background(), time.Minute, maxLen, items)
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("Enqueue item %d: %v", i, err)
+		}
+	}
+	return results
+}
+
+func TestMemoryQueueEnqueueIdempotency(t *testing.T) {
+	q := NewMemoryQueue()
+	results := enqueue(t, q, 0,
+		queueItem("a", "1"),
+		queueItem("a", "1"),
+		queueItem("a", "2"),
+		queueItem("b", "1"),
+	)
+	want := []models.QueueAddResult{models.QueueAddAccepted, models.QueueAddDuplicate, models.QueueAddConflict, models.QueueAddAccepted}
+	for i := range want {
+		if results[i] != want[i] {
+			t.Errorf("item %d = %v, want %v", i, results[i], want[i])
+		}
+	}
+	if waiting, pending, _ := q.Backlog(context.Background()); waiting != 2 || pending != 0 {
+		t.Errorf("Backlog = %d, %d, want 2, 0", waiting, pending)
+	}
+}
+
+func TestMemoryQueueMaxLen(t *testing.T) {
+	q := NewMemoryQueue()
+	results := enqueue(t, q, 2, queueItem("a", "1"), queueItem("b", "1"), queueItem("c", "1"))
+	if results[2] != models.QueueAddFull {
+		t.Errorf("third item = %v, want full", results[2])
+	}
+	// Unacked deliveries still count; an acked one frees its slot, and the
+	// item refused as full was not remembered, so it can be sent again.
+	messages, err := q.Consume(context.Background(), "worker", 1, 0)
+	if err != nil || len(messages) != 1 {
+		t.Fatalf("Consume = %v, %v", messages, err)
+	}
+	if results := enqueue(t, q, 2, queueItem("c", "1")); results[0] != models.QueueAddFull {
+		t.Errorf("item with a delivery pending = %v, want full", results[0])
+	}
+	q.Ack(context.Background(), messages[0].ID)
+	if results := enqueue(t, q, 2, queueItem("c", "1")); results[0] != models.QueueAddAccepted {
+		t.Errorf("retried item = %v, want accepted", results[0])
+	}
+}
+
+func TestMemoryQueueDeliveryLifecycle(t *testing.T) {
+	ctx := context.Background()
+	q := NewMemoryQueue()
+	enqueue(t, q, 0, queueItem("a", "1"), queueItem("b", "1"), queueItem("c", "1"))
+
+	messages, err := q.Consume(ctx, "worker-1", 2, 0)
+	if err != nil || len(messages) != 2 || messages[0].Values["correlationId"] != "a" || messages[0].Values["amount"] != "1990" {
+		t.Fatalf("Consume = %v, %v", messages, err)
+	}
+	if waiting, pending, _ := q.Backlog(ctx); waiting != 1 || pending != 2 {
+		t.Errorf("Backlog = %d, %d, want 1, 2", waiting, pending)
+	}
+	if oldest, _ := q.OldestUnacked(ctx); oldest.IsZero() {
+		t.Error("OldestUnacked is zero with messages pending")
+	}
+
+	if err := q.Ack(ctx, messages[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	// The unacked delivery goes to another consumer once idle long enough.
+	if reclaimed, _ := q.Reclaim(ctx, "worker-2", time.Hour, 10); len(reclaimed) != 0 {
+		t.Errorf("reclaimed %d fresh deliveries", len(reclaimed))
+	}
+	reclaimed, err := q.Reclaim(ctx, "worker-2", 0, 10)
+	if err != nil || len(reclaimed) != 1 || reclaimed[0].ID != messages[1].ID {
+		t.Fatalf("Reclaim = %v, %v", reclaimed, err)
+	}
+
+	// A retry is consumable again only once due.
+	at := time.Now().Add(time.Minute)
+	if err := q.Retry(ctx, reclaimed[0].ID, reclaimed[0].Values, at); err != nil {
+		t.Fatal(err)
+	}
+	if released, _ := q.ReleaseDue(ctx, time.Now(), 10); released != 0 {
+		t.Errorf("released %d retries early", released)
+	}
+	if released, _ := q.ReleaseDue(ctx, at, 10); released != 1 {
+		t.Errorf("released %d retries, want 1", released)
+	}
+	if waiting, pending, _ := q.Backlog(ctx); waiting != 2 || pending != 0 {
+		t.Errorf("Backlog = %d, %d, want 2, 0", waiting, pending)
+	}
+}
+
+func TestMemoryQueueConsumeWaits(t *testing.T) {
+	q := NewMemoryQueue()
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		q.Enqueue(context.Background(), time.Minute, 0, []models.QueueItem{queueItem("a", "1")})
+	}()
+	messages, err := q.Consume(context.Background(), "worker", 1, time.Second)
+	if err != nil || len(messages) != 1 {
+		t.Fatalf("Consume = %v, %v, want the message enqueued while waiting", messages, err)
+	}
+
+	start := time.Now()
+	if messages, _ := q.Consume(context.Background(), "worker", 1, 20*time.Millisecond); len(messages) != 0 || time.Since(start) < 20*time.Millisecond {
+		t.Errorf("Consume on an empty queue returned %v after %v", messages, time.Since(start))
+	}
+}
+
+func TestMemoryQueueDeadLetters(t *testing.T) {
+	ctx := context.Background()
+	q := NewMemoryQueue()
+	enqueue(t, q, 0, queueItem("a", "1"), queueItem("b", "1"), queueItem("c", "1"))
+	messages, _ := q.Consume(ctx, "worker", 3, 0)
+	for _, message := range messages {
+		if err := q.DeadLetter(ctx, message.ID, message.Values); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dead, total, err := q.DeadLetters(ctx, "", 2)
+	if err != nil || total != 3 || len(dead) != 2 {
+		t.Fatalf("DeadLetters = %v, %d, %v", dead, total, err)
+	}
+	rest, _, _ := q.DeadLetters(ctx, dead[1].ID, 10)
+	if len(rest) != 2 || rest[0].ID != dead[1].ID {
+		t.Errorf("DeadLetters from %s = %v, want it inclusive", dead[1].ID, rest)
+	}
+
+	if _, ok, _ := q.ReplayDeadLetter(ctx, dead[0].ID, dead[0].Values); !ok {
+		t.Error("ReplayDeadLetter did not find the dead letter")
+	}
+	if _, ok, _ := q.ReplayDeadLetter(ctx, dead[0].ID, dead[0].Values); ok {
+		t.Error("a dead letter was replayed twice")
+	}
+	if ok, _ := q.DiscardDeadLetter(ctx, dead[1].ID); !ok {
+		t.Error("DiscardDeadLetter did not find the dead letter")
+	}
+	if waiting, _, _ := q.Backlog(ctx); waiting != 1 {
+		t.Errorf("%d messages waiting after a replay, want 1", waiting)
+	}
+
+	enqueue(t, q, 0, queueItem("d", "1"))
+	messages, _ = q.Consume(ctx, "worker", 10, 0)
+	for _, message := range messages {
+		q.DeadLetter(ctx, message.ID, message.Values)
+	}
+	if err := q.Trim(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, total, _ := q.DeadLetters(ctx, "", 10); total != 1 {
+		t.Errorf("%d dead letters after Trim, want 1", total)
+	}
+}
+
+func TestMemoryQueuePurge(t *testing.T) {
+	ctx := context.Background()
+	q := NewMemoryQueue()
+	enqueue(t, q, 0, queueItem("a", "1"), queueItem("b", "1"))
+	q.Consume(ctx, "worker", 1, 0)
+
+	queued, err := q.Purge(ctx)
+	if err != nil || queued != 2 {
+		t.Fatalf("Purge = %d, %v, want 2", queued, err)
+	}
+	if waiting, pending, _ := q.Backlog(ctx); waiting != 0 || pending != 0 {
+		t.Errorf("Backlog after Purge = %d, %d", waiting, pending)
+	}
+	// Idempotency keys go too.
+	if results := enqueue(t, q, 0, queueItem("a", "1")); results[0] != models.QueueAddAccepted {
+		t.Errorf("re-enqueue after Purge = %v, want accepted", results[0])
+	}
+}
+
+func TestMemoryQueueLanesShareKeysAndIDs(t *testing.T) {
+	store := newMemoryStore()
+	high, low := store.lane("high"), store.lane("low")
+	enqueue(t, high, 0, queueItem("a", "1"))
+	if results := enqueue(t, low, 0, queueItem("a", "1")); results[0] != models.QueueAddDuplicate {
+		t.Errorf("same key on another lane = %v, want duplicate", results[0])
+	}
+	enqueue(t, low, 0, queueItem("b", "1"))
+
+	first, _ := high.Consume(context.Background(), "worker", 1, 0)
+	second, _ := low.Consume(context.Background(), "worker", 1, 0)
+	if len(first) != 1 || len(second) != 1 || infrastructure.CompareStreamIDs(first[0].ID, second[0].ID) >= 0 {
+		t.Errorf("lane ids are not ordered across lanes: %v, %v", first, second)
+	}
+}
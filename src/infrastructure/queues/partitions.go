@@ -0,0 +1,348 @@
+package queues
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os"
+	"payment-processor/config"
+	"payment-processor/core/models"
+	"payment-processor/interfaces"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// PartitionedQueue shards payments over several queues by a hash of their
+// correlationId, each capped at an even share of the queue length. Consume,
+// Reclaim and ReleaseDue only touch the partitions assigned to this instance
+// by GetPartitionAssignment; everything else covers all of them. Ids are
+// prefixed with "<partition>:" so deliveries can be routed back.
+type PartitionedQueue struct {
+	partitions []interfaces.Queue
+	next       atomic.Uint64
+}
+
+func NewPartitionedQueue(partitions int, newQueue func(partition int) interfaces.Queue) *PartitionedQueue {
+	q := &PartitionedQueue{partitions: make([]interfaces.Queue, partitions)}
+	for p := range q.partitions {
+		q.partitions[p] = newQueue(p)
+	}
+	return q
+}
+
+func (q *PartitionedQueue) Setup(ctx context.Context) error {
+	for _, partition := range q.partitions {
+		if err := partition.Setup(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (q *PartitionedQueue) Ping(ctx context.Context) error {
+	return q.partitions[0].Ping(ctx)
+}
+
+func (q *PartitionedQueue) Enqueue(ctx context.Context, window time.Duration, maxLen int64, items []models.QueueItem) ([]models.QueueAddResult, []error) {
+	results := make([]models.QueueAddResult, len(items))
+	errs := make([]error, len(items))
+
+	// Round the share up: truncating would cap a queue shorter than the
+	// partition count at 0, which means unbounded.
+	if maxLen > 0 {
+		partitions := int64(len(q.partitions))
+		maxLen = max(1, (maxLen+partitions-1)/partitions)
+	}
+	batches := make(map[int][]int)
+	for i, item := range items {
+		p := q.partitionOf(item.Values)
+		batches[p] = append(batches[p], i)
+	}
+	for p, indexes := range batches {
+		partitionItems := make([]models.QueueItem, len(indexes))
+		for j, i := range indexes {
+			partitionItems[j] = items[i]
+		}
+		partitionResults, partitionErrs := q.partitions[p].Enqueue(ctx, window, maxLen, partitionItems)
+		for j, i := range indexes {
+			results[i], errs[i] = partitionResults[j], partitionErrs[j]
+		}
+	}
+	return results, errs
+}
+
+// Consume takes a batch from the owned partitions, starting from a different
+// one on every call. When all are empty it blocks on each in turn for at most
+// blockSlice until block has passed.
+func (q *PartitionedQueue) Consume(ctx context.Context, consumer string, count int64, block time.Duration) ([]models.QueueMessage, error) {
+	deadline := time.Now().Add(block)
+	for {
+		owned := q.owned()
+		start := int(q.next.Add(1) % uint64(len(owned)))
+		for i := range owned {
+			p := owned[(start+i)%len(owned)]
+			messages, err := q.partitions[p].Consume(ctx, consumer, count, 0)
+			if err != nil || len(messages) > 0 {
+				return tagPartition(p, messages), err
+			}
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil, nil
+		}
+		p := owned[start]
+		messages, err := q.partitions[p].Consume(ctx, consumer, count, min(remaining, blockSlice))
+		if err != nil || len(messages) > 0 {
+			return tagPartition(p, messages), err
+		}
+	}
+}
+
+// Reclaim also picks up entries left pending by the previous owner of a
+// partition that left without acking them.
+func (q *PartitionedQueue) Reclaim(ctx context.Context, consumer string, minIdle time.Duration, count int64) ([]models.QueueMessage, error) {
+	var claimed []models.QueueMessage
+	for _, p := range q.owned() {
+		if int64(len(claimed)) >= count {
+			break
+		}
+		messages, err := q.partitions[p].Reclaim(ctx, consumer, minIdle, count-int64(len(claimed)))
+		claimed = append(claimed, tagPartition(p, messages)...)
+		if err != nil {
+			return claimed, err
+		}
+	}
+	return claimed, nil
+}
+
+func (q *PartitionedQueue) Ack(ctx context.Context, id string) error {
+	p, id := q.route(id)
+	return q.partitions[p].Ack(ctx, id)
+}
+
+func (q *PartitionedQueue) Backlog(ctx context.Context) (int64, int64, error) {
+	var lag, pending int64
+	for _, partition := range q.partitions {
+		partitionLag, partitionPending, err := partition.Backlog(ctx)
+		if err != nil {
+			return 0, 0, err
+		}
+		lag += partitionLag
+		pending += partitionPending
+	}
+	return lag, pending, nil
+}
+
+func (q *PartitionedQueue) OldestUnacked(ctx context.Context) (time.Time, error) {
+	var oldest time.Time
+	for _, partition := range q.partitions {
+		partitionOldest, err := partition.OldestUnacked(ctx)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if !partitionOldest.IsZero() && (oldest.IsZero() || partitionOldest.Before(oldest)) {
+			oldest = partitionOldest
+		}
+	}
+	return oldest, nil
+}
+
+func (q *PartitionedQueue) Retry(ctx context.Context, id string, values map[string]interface{}, at time.Time) error {
+	p, id := q.route(id)
+	return q.partitions[p].Retry(ctx, id, values, at)
+}
+
+func (q *PartitionedQueue) ReleaseDue(ctx context.Context, now time.Time, count int64) (int64, error) {
+	var released int64
+	for _, p := range q.owned() {
+		partitionReleased, err := q.partitions[p].ReleaseDue(ctx, now, count)
+		released += partitionReleased
+		if err != nil {
+			return released, err
+		}
+	}
+	return released, nil
+}
+
+func (q *PartitionedQueue) DeadLetter(ctx context.Context, id string, values map[string]interface{}) error {
+	p, id := q.route(id)
+	return q.partitions[p].DeadLetter(ctx, id, values)
+}
+
+// Dead letters are shared by the partitions, any of them can list them.
+func (q *PartitionedQueue) DeadLetters(ctx context.Context, start string, count int64) ([]models.QueueMessage, int64, error) {
+	return q.partitions[0].DeadLetters(ctx, start, count)
+}
+
+func (q *PartitionedQueue) ReplayDeadLetter(ctx context.Context, id string, values map[string]interface{}) (string, bool, error) {
+	p := q.partitionOf(values)
+	newID, found, err := q.partitions[p].ReplayDeadLetter(ctx, id, values)
+	if found {
+		newID = strconv.Itoa(p) + ":" + newID
+	}
+	return newID, found, err
+}
+
+func (q *PartitionedQueue) DiscardDeadLetter(ctx context.Context, id string) (bool, error) {
+	return q.partitions[0].DiscardDeadLetter(ctx, id)
+}
+
+func (q *PartitionedQueue) Trim(ctx context.Context, maxDeadLetters int64) error {
+	for _, partition := range q.partitions {
+		if err := partition.Trim(ctx, maxDeadLetters); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (q *PartitionedQueue) Purge(ctx context.Context) (int64, error) {
+	var purged int64
+	for _, partition := range q.partitions {
+		partitionPurged, err := partition.Purge(ctx)
+		purged += partitionPurged
+		if err != nil {
+			return purged, err
+		}
+	}
+	return purged, nil
+}
+
+func (q *PartitionedQueue) owned() []int {
+	return partitionAssignment.Owned(len(q.partitions))
+}
+
+func (q *PartitionedQueue) partitionOf(values map[string]interface{}) int {
+	correlationID, _ := values["correlationId"].(string)
+	hash := fnv.New32a()
+	hash.Write([]byte(correlationID))
+	return int(hash.Sum32() % uint32(len(q.partitions)))
+}
+
+// route returns the partition of a tagged id and the id within it.
+func (q *PartitionedQueue) route(id string) (int, string) {
+	if prefix, partitionID, ok := strings.Cut(id, ":"); ok {
+		if p, err := strconv.Atoi(prefix); err == nil && p >= 0 && p < len(q.partitions) {
+			return p, partitionID
+		}
+	}
+	return 0, id
+}
+
+func tagPartition(p int, messages []models.QueueMessage) []models.QueueMessage {
+	for i := range messages {
+		messages[i].ID = strconv.Itoa(p) + ":" + messages[i].ID
+	}
+	return messages
+}
+
+// PartitionAssignment tracks the instances consuming the shared queue and
+// which partitions this one owns. Every instance heartbeats into a shared
+// sorted set; the live members, in order, split the partitions round-robin,
+// so partitions move as soon as members join or leave. The autoscaler sizes
+// each instance for its share of the backlog from the member count.
+type PartitionAssignment struct {
+	member  string
+	members atomic.Pointer[[]string]
+}
+
+var partitionAssignment = newPartitionAssignment()
+
+func GetPartitionAssignment() *PartitionAssignment {
+	return partitionAssignment
+}
+
+func newPartitionAssignment() *PartitionAssignment {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return &PartitionAssignment{member: fmt.Sprintf("%s-%d", hostname, os.Getpid())}
+}
+
+// Owned returns the partitions of partitions this instance consumes. Until the
+// first heartbeat, or when it is missing from the members, it owns them all.
+func (a *PartitionAssignment) Owned(partitions int) []int {
+	var members []string
+	if loaded := a.members.Load(); loaded != nil {
+		members = *loaded
+	}
+	index := slices.Index(members, a.member)
+
+	var owned []int
+	for p := 0; p < partitions; p++ {
+		if index < 0 || p%len(members) == index {
+			owned = append(owned, p)
+		}
+	}
+	if len(owned) == 0 {
+		// More members than partitions: the extra ones share a partition
+		// with its owner rather than sit idle with nothing to block on.
+		owned = append(owned, index%partitions)
+	}
+	return owned
+}
+
+// Members returns how many instances consume the queue, this one included.
+// Until the first heartbeat it is 1.
+func (a *PartitionAssignment) Members() int {
+	loaded := a.members.Load()
+	if loaded == nil {
+		return 1
+	}
+	if !slices.Contains(*loaded, a.member) {
+		return len(*loaded) + 1
+	}
+	return len(*loaded)
+}
+
+// Watch heartbeats every PARTITION_HEARTBEAT_MS and leaves the members on
+// shutdown so the others take over its partitions right away. The memory
+// backend is not shared, so there is nothing to track.
+func (a *PartitionAssignment) Watch(ctx context.Context, store interfaces.Store) {
+	config := config.LoadConfig()
+	if config.QueueBackend == "memory" {
+		return
+	}
+	ttl := time.Duration(config.PartitionMemberTTL) * time.Millisecond
+
+	a.heartbeat(ctx, store, ttl)
+	ticker := time.NewTicker(time.Duration(config.PartitionHeartbeat) * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			leaveCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			if err := store.ZRem(leaveCtx, config.PartitionMembersKey, a.member); err != nil {
+				log.Println("Partition assignment: failed to leave members:", err)
+			}
+			return
+		case <-ticker.C:
+			a.heartbeat(ctx, store, ttl)
+		}
+	}
+}
+
+func (a *PartitionAssignment) heartbeat(ctx context.Context, store interfaces.Store, ttl time.Duration) {
+	members, err := store.ZHeartbeat(ctx, config.LoadConfig().PartitionMembersKey, a.member, time.Now(), ttl)
+	if err != nil {
+		log.Println("Partition assignment: heartbeat failed, keeping current partitions:", err)
+		return
+	}
+	slices.Sort(members)
+
+	previous := a.members.Swap(&members)
+	if previous == nil || !slices.Equal(*previous, members) {
+		if partitions := config.LoadConfig().QueuePartitions; partitions > 1 {
+			log.Printf("Partition assignment: %d members, owning partitions %v", len(members), a.Owned(partitions))
+		} else {
+			log.Printf("Partition assignment: %d members", len(members))
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package queues
+
+import (
+	"context"
+	"fmt"
+	"payment-processor/core/models"
+	"payment-processor/interfaces"
+	"reflect"
+	"testing"
+)
+
+func newMemoryPartitions(partitions int) *PartitionedQueue {
+	return NewPartitionedQueue(partitions, func(partition int) interfaces.Queue {
+		return NewMemoryQueue()
+	})
+}
+
+func TestPartitionedQueueMaxLenShare(t *testing.T) {
+	tests := []struct {
+		partitions int
+		maxLen     int64
+		want       int64
+	}{
+		{4, 3, 1},
+		{4, 8, 2},
+		{4, 9, 3},
+		{1, 5, 5},
+	}
+	for _, tt := range tests {
+		q := newMemoryPartitions(tt.partitions)
+		accepted := make(map[int]int64)
+		for i := 0; i < 200; i++ {
+			item := queueItem(fmt.Sprintf("payment-%d", i), "1")
+			if results := enqueue(t, q, tt.maxLen, item); results[0] == models.QueueAddAccepted {
+				accepted[q.partitionOf(item.Values)]++
+			}
+		}
+		for p := 0; p < tt.partitions; p++ {
+			if accepted[p] != tt.want {
+				t.Errorf("%d partitions, maxLen %d: partition %d took %d, want %d", tt.partitions, tt.maxLen, p, accepted[p], tt.want)
+			}
+		}
+	}
+
+	// Without a cap every item goes in.
+	q := newMemoryPartitions(4)
+	for i := 0; i < 50; i++ {
+		enqueue(t, q, 0, queueItem(fmt.Sprintf("payment-%d", i), "1"))
+	}
+	if waiting, _, _ := q.Backlog(context.Background()); waiting != 50 {
+		t.Errorf("%d messages waiting, want 50", waiting)
+	}
+}
+
+func TestPartitionedQueueRoutesIDs(t *testing.T) {
+	ctx := context.Background()
+	q := newMemoryPartitions(3)
+	for i := 0; i < 10; i++ {
+		enqueue(t, q, 0, queueItem(fmt.Sprintf("payment-%d", i), "1"))
+	}
+	messages, err := q.Consume(ctx, "worker", 100, 0)
+	for len(messages) > 0 && err == nil {
+		for _, message := range messages {
+			if p, _ := q.route(message.ID); p != q.partitionOf(message.Values) {
+				t.Errorf("%s was tagged with partition %d", message.ID, p)
+			}
+			if err := q.Ack(ctx, message.ID); err != nil {
+				t.Fatal(err)
+			}
+		}
+		messages, err = q.Consume(ctx, "worker", 100, 0)
+	}
+	if waiting, pending, _ := q.Backlog(ctx); waiting != 0 || pending != 0 {
+		t.Errorf("Backlog = %d, %d after acking everything", waiting, pending)
+	}
+}
+
+func TestPartitionAssignmentOwned(t *testing.T) {
+	assignment := &PartitionAssignment{member: "b"}
+	if got := assignment.Owned(4); !reflect.DeepEqual(got, []int{0, 1, 2, 3}) {
+		t.Errorf("before the first heartbeat Owned = %v, want every partition", got)
+	}
+
+	members := []string{"a", "b", "c"}
+	assignment.members.Store(&members)
+	if got := assignment.Owned(7); !reflect.DeepEqual(got, []int{1, 4}) {
+		t.Errorf("Owned(7) = %v, want [1 4]", got)
+	}
+	if got := assignment.Owned(2); !reflect.DeepEqual(got, []int{1}) {
+		t.Errorf("Owned(2) = %v, want [1]", got)
+	}
+	extra := &PartitionAssignment{member: "c"}
+	extra.members.Store(&members)
+	if got := extra.Owned(2); !reflect.DeepEqual(got, []int{0}) {
+		t.Errorf("extra member Owned(2) = %v, want to share partition 0", got)
+	}
+}
+
+func TestPartitionAssignmentMembers(t *testing.T) {
+	assignment := &PartitionAssignment{member: "b"}
+	if got := assignment.Members(); got != 1 {
+		t.Errorf("before the first heartbeat Members = %d, want 1", got)
+	}
+	members := []string{"a", "b", "c"}
+	assignment.members.Store(&members)
+	if got := assignment.Members(); got != 3 {
+		t.Errorf("Members = %d, want 3", got)
+	}
+	others := []string{"a", "c"}
+	assignment.members.Store(&others)
+	if got := assignment.Members(); got != 3 {
+		t.Errorf("Members without this instance = %d, want it counted too", got)
+	}
+}
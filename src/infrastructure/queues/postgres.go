@@ -0,0 +1,375 @@
+package queues
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"payment-processor/core/models"
+	"payment-processor/infrastructure/migrations"
+	"strconv"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// pollInterval is how often Consume looks for new rows while blocking;
+// Postgres has no blocking read to wait on.
+const pollInterval = 100 * time.Millisecond
+
+// PostgresQueue keeps the queue in Postgres tables (see
+// migrations.QueueTables). Deliveries are leases on rows taken with
+// FOR UPDATE SKIP LOCKED, retries are rows whose available_at lies ahead.
+// Each priority lane is a PostgresQueue over the rows of its lane; dead
+// letters and idempotency keys are shared.
+type PostgresQueue struct {
+	db   *sql.DB
+	lane string
+}
+
+func NewPostgresQueue(db *sql.DB, lane string) *PostgresQueue {
+	return &PostgresQueue{db: db, lane: lane}
+}
+
+func (q *PostgresQueue) Setup(ctx context.Context) error {
+	if _, err := q.db.ExecContext(ctx, migrations.QueueTables); err != nil {
+		return fmt.Errorf("failed to create queue tables: %w", err)
+	}
+	return nil
+}
+
+func (q *PostgresQueue) Ping(ctx context.Context) error {
+	return q.db.PingContext(ctx)
+}
+
+func (q *PostgresQueue) Enqueue(ctx context.Context, window time.Duration, maxLen int64, items []models.QueueItem) ([]models.QueueAddResult, []error) {
+	results := make([]models.QueueAddResult, len(items))
+	errs := make([]error, len(items))
+	for i, item := range items {
+		results[i], errs[i] = q.enqueue(ctx, window, maxLen, item)
+	}
+	return results, errs
+}
+
+func (q *PostgresQueue) enqueue(ctx context.Context, window time.Duration, maxLen int64, item models.QueueItem) (models.QueueAddResult, error) {
+	payload, err := json.Marshal(stringValues(item.Values))
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode queue item: %w", err)
+	}
+
+	tx, err := q.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin enqueue: %w", err)
+	}
+	defer tx.Rollback()
+
+	var key string
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO payment_queue_keys (key, fingerprint, expires_at)
+		VALUES ($1, $2, now() + $3 * interval '1 millisecond')
+		ON CONFLICT (key) DO UPDATE
+			SET fingerprint = EXCLUDED.fingerprint, expires_at = EXCLUDED.expires_at
+			WHERE payment_queue_keys.expires_at < now()
+		RETURNING key`, item.Key, item.Fingerprint, window.Milliseconds()).Scan(&key)
+	if err == sql.ErrNoRows {
+		var fingerprint string
+		if err := tx.QueryRowContext(ctx, `SELECT fingerprint FROM payment_queue_keys WHERE key = $1`, item.Key).Scan(&fingerprint); err != nil {
+			return 0, fmt.Errorf("failed to read idempotency key: %w", err)
+		}
+		if fingerprint == item.Fingerprint {
+			return models.QueueAddDuplicate, nil
+		}
+		return models.QueueAddConflict, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim idempotency key: %w", err)
+	}
+
+	// The lane's length row is locked until commit, so concurrent enqueues
+	// take the last slots one at a time. A full lane rolls the key claim back.
+	counted, err := q.countEnqueue(ctx, tx, maxLen)
+	if err != nil {
+		return 0, err
+	}
+	if !counted {
+		return models.QueueAddFull, nil
+	}
+
+	if _, err := tx.ExecContext(ctx, `INSERT INTO payment_queue (lane, payload) VALUES ($1, $2)`, q.lane, payload); err != nil {
+		return 0, fmt.Errorf("failed to enqueue: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit enqueue: %w", err)
+	}
+	return models.QueueAddAccepted, nil
+}
+
+// countEnqueue adds one to the lane's length unless that would take it past
+// maxLen, and reports whether it did. maxLen 0 or below means no cap.
+func (q *PostgresQueue) countEnqueue(ctx context.Context, tx *sql.Tx, maxLen int64) (bool, error) {
+	query := `
+		INSERT INTO payment_queue_lengths (lane, length) VALUES ($1, 1)
+		ON CONFLICT (lane) DO UPDATE SET length = payment_queue_lengths.length + 1`
+	args := []interface{}{q.lane}
+	if maxLen > 0 {
+		query += ` WHERE payment_queue_lengths.length < $2`
+		args = append(args, maxLen)
+	}
+	var length int64
+	err := tx.QueryRowContext(ctx, query+` RETURNING length`, args...).Scan(&length)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to count enqueue: %w", err)
+	}
+	return true, nil
+}
+
+func (q *PostgresQueue) Consume(ctx context.Context, consumer string, count int64, block time.Duration) ([]models.QueueMessage, error) {
+	deadline := time.Now().Add(block)
+	for {
+		messages, err := q.lease(ctx, `
+			UPDATE payment_queue SET leased_by = $1, leased_at = now()
+			WHERE id IN (
+				SELECT id FROM payment_queue
+				WHERE lane = $3 AND leased_at IS NULL AND available_at <= now()
+				ORDER BY id LIMIT $2
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING id, payload`, consumer, count, q.lane)
+		if err != nil || len(messages) > 0 || !time.Now().Before(deadline) {
+			return messages, err
+		}
+
+		select {
+		case <-time.After(pollInterval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (q *PostgresQueue) Reclaim(ctx context.Context, consumer string, minIdle time.Duration, count int64) ([]models.QueueMessage, error) {
+	return q.lease(ctx, `
+		UPDATE payment_queue SET leased_by = $1, leased_at = now()
+		WHERE id IN (
+			SELECT id FROM payment_queue
+			WHERE lane = $4 AND leased_at < now() - $3 * interval '1 millisecond'
+			ORDER BY id LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, payload`, consumer, count, minIdle.Milliseconds(), q.lane)
+}
+
+func (q *PostgresQueue) Ack(ctx context.Context, id string) error {
+	_, err := q.db.ExecContext(ctx, `
+		WITH acked AS (DELETE FROM payment_queue WHERE id = $1 RETURNING lane)
+		UPDATE payment_queue_lengths SET length = length - 1
+		WHERE lane IN (SELECT lane FROM acked)`, id)
+	if err != nil {
+		return fmt.Errorf("failed to ack message: %w", err)
+	}
+	return nil
+}
+
+func (q *PostgresQueue) Backlog(ctx context.Context) (int64, int64, error) {
+	var lag, pending int64
+	err := q.db.QueryRowContext(ctx, `
+		SELECT
+			count(*) FILTER (WHERE leased_at IS NULL AND available_at <= now()),
+			count(*) FILTER (WHERE leased_at IS NOT NULL)
+		FROM payment_queue WHERE lane = $1`, q.lane).Scan(&lag, &pending)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read queue backlog: %w", err)
+	}
+	return lag, pending, nil
+}
+
+// OldestUnacked uses available_at, which is the enqueue time for new messages
+// and the due time for retries.
+func (q *PostgresQueue) OldestUnacked(ctx context.Context) (time.Time, error) {
+	var oldest sql.NullTime
+	err := q.db.QueryRowContext(ctx, `SELECT min(available_at) FROM payment_queue WHERE lane = $1 AND available_at <= now()`, q.lane).Scan(&oldest)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read oldest message: %w", err)
+	}
+	return oldest.Time, nil
+}
+
+func (q *PostgresQueue) Retry(ctx context.Context, id string, values map[string]interface{}, at time.Time) error {
+	payload, err := json.Marshal(stringValues(values))
+	if err != nil {
+		return fmt.Errorf("failed to encode retry: %w", err)
+	}
+	_, err = q.db.ExecContext(ctx, `
+		UPDATE payment_queue
+		SET payload = $2, available_at = $3, leased_by = NULL, leased_at = NULL
+		WHERE id = $1`, id, payload, at)
+	if err != nil {
+		return fmt.Errorf("failed to schedule retry: %w", err)
+	}
+	return nil
+}
+
+// ReleaseDue is a no-op: retries become consumable once available_at passes.
+func (q *PostgresQueue) ReleaseDue(ctx context.Context, now time.Time, count int64) (int64, error) {
+	return 0, nil
+}
+
+func (q *PostgresQueue) DeadLetter(ctx context.Context, id string, values map[string]interface{}) error {
+	payload, err := json.Marshal(stringValues(values))
+	if err != nil {
+		return fmt.Errorf("failed to encode dead letter: %w", err)
+	}
+	_, err = q.db.ExecContext(ctx, `
+		WITH moved AS (DELETE FROM payment_queue WHERE id = $1 RETURNING lane),
+		counted AS (
+			UPDATE payment_queue_lengths SET length = length - 1
+			WHERE lane IN (SELECT lane FROM moved)
+		)
+		INSERT INTO payment_dead_letters (payload) SELECT $2 FROM moved`, id, payload)
+	if err != nil {
+		return fmt.Errorf("failed to dead-letter message: %w", err)
+	}
+	return nil
+}
+
+func (q *PostgresQueue) DeadLetters(ctx context.Context, start string, count int64) ([]models.QueueMessage, int64, error) {
+	var from int64
+	if start != "" {
+		var err error
+		if from, err = strconv.ParseInt(start, 10, 64); err != nil {
+			return nil, 0, nil
+		}
+	}
+
+	var total int64
+	if err := q.db.QueryRowContext(ctx, `SELECT count(*) FROM payment_dead_letters`).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count dead letters: %w", err)
+	}
+	rows, err := q.db.QueryContext(ctx, `
+		SELECT id, payload FROM payment_dead_letters
+		WHERE id >= $1 ORDER BY id LIMIT $2`, from, count)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read dead letters: %w", err)
+	}
+	messages, err := scanMessages(rows)
+	return messages, total, err
+}
+
+func (q *PostgresQueue) ReplayDeadLetter(ctx context.Context, id string, values map[string]interface{}) (string, bool, error) {
+	if _, err := strconv.ParseInt(id, 10, 64); err != nil {
+		return "", false, nil
+	}
+	payload, err := json.Marshal(stringValues(values))
+	if err != nil {
+		return "", false, fmt.Errorf("failed to encode replay: %w", err)
+	}
+
+	var newID int64
+	err = q.db.QueryRowContext(ctx, `
+		WITH moved AS (DELETE FROM payment_dead_letters WHERE id = $1 RETURNING id),
+		counted AS (
+			INSERT INTO payment_queue_lengths (lane, length) SELECT $3, 1 FROM moved
+			ON CONFLICT (lane) DO UPDATE SET length = payment_queue_lengths.length + 1
+		)
+		INSERT INTO payment_queue (lane, payload) SELECT $3, $2 FROM moved
+		RETURNING id`, id, payload, q.lane).Scan(&newID)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to replay dead letter: %w", err)
+	}
+	return strconv.FormatInt(newID, 10), true, nil
+}
+
+func (q *PostgresQueue) DiscardDeadLetter(ctx context.Context, id string) (bool, error) {
+	if _, err := strconv.ParseInt(id, 10, 64); err != nil {
+		return false, nil
+	}
+	result, err := q.db.ExecContext(ctx, `DELETE FROM payment_dead_letters WHERE id = $1`, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to discard dead letter: %w", err)
+	}
+	deleted, err := result.RowsAffected()
+	return deleted > 0, err
+}
+
+// Trim drops expired idempotency keys and the oldest dead letters; acked
+// rows are deleted as soon as they are acked.
+func (q *PostgresQueue) Trim(ctx context.Context, maxDeadLetters int64) error {
+	if _, err := q.db.ExecContext(ctx, `DELETE FROM payment_queue_keys WHERE expires_at < now()`); err != nil {
+		return fmt.Errorf("failed to trim idempotency keys: %w", err)
+	}
+	if maxDeadLetters <= 0 {
+		return nil
+	}
+	_, err := q.db.ExecContext(ctx, `
+		DELETE FROM payment_dead_letters
+		WHERE id < (SELECT id FROM payment_dead_letters ORDER BY id DESC OFFSET $1 - 1 LIMIT 1)`, maxDeadLetters)
+	if err != nil {
+		return fmt.Errorf("failed to trim dead letters: %w", err)
+	}
+	return nil
+}
+
+func (q *PostgresQueue) Purge(ctx context.Context) (int64, error) {
+	tx, err := q.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin purge: %w", err)
+	}
+	defer tx.Rollback()
+
+	var queued int64
+	err = tx.QueryRowContext(ctx, `
+		WITH purged AS (DELETE FROM payment_queue WHERE lane = $1 RETURNING 1)
+		SELECT count(*) FROM purged`, q.lane).Scan(&queued)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge queue: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE payment_queue_lengths SET length = 0 WHERE lane = $1`, q.lane); err != nil {
+		return 0, fmt.Errorf("failed to purge queue: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `TRUNCATE payment_queue_keys, payment_dead_letters`); err != nil {
+		return 0, fmt.Errorf("failed to purge queue: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit purge: %w", err)
+	}
+	return queued, nil
+}
+
+func (q *PostgresQueue) lease(ctx context.Context, query string, args ...interface{}) ([]models.QueueMessage, error) {
+	rows, err := q.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lease messages: %w", err)
+	}
+	messages, err := scanMessages(rows)
+	if err != nil {
+		return nil, err
+	}
+	// UPDATE ... RETURNING does not keep the subquery's order.
+	sortMessages(messages)
+	return messages, nil
+}
+
+func scanMessages(rows *sql.Rows) ([]models.QueueMessage, error) {
+	defer rows.Close()
+
+	var messages []models.QueueMessage
+	for rows.Next() {
+		var id int64
+		var payload []byte
+		if err := rows.Scan(&id, &payload); err != nil {
+			return nil, fmt.Errorf("failed to scan message: %w", err)
+		}
+		var values map[string]string
+		if err := json.Unmarshal(payload, &values); err != nil {
+			return nil, fmt.Errorf("failed to decode message %d: %w", id, err)
+		}
+		messages = append(messages, models.QueueMessage{ID: strconv.FormatInt(id, 10), Values: messageValues(values)})
+	}
+	return messages, rows.Err()
+}
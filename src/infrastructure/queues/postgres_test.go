@@ -0,0 +1,158 @@
+package queues
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"payment-processor/core/models"
+	"payment-processor/infrastructure/migrations"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testPostgresDB returns the database at TEST_POSTGRES_URL with empty queue
+// tables, and skips the test when it is unset.
+func testPostgresDB(t *testing.T) *sql.DB {
+	t.Helper()
+	url := os.Getenv("TEST_POSTGRES_URL")
+	if url == "" {
+		t.Skip("TEST_POSTGRES_URL is not set")
+	}
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Exec(migrations.QueueTables); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`TRUNCATE payment_queue, payment_queue_keys, payment_dead_letters, payment_queue_lengths`); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func queueLength(t *testing.T, db *sql.DB, lane string) int64 {
+	t.Helper()
+	var length int64
+	err := db.QueryRow(`SELECT length FROM payment_queue_lengths WHERE lane = $1`, lane).Scan(&length)
+	if err != nil && err != sql.ErrNoRows {
+		t.Fatal(err)
+	}
+	return length
+}
+
+func TestPostgresQueueEnqueueIdempotency(t *testing.T) {
+	q := NewPostgresQueue(testPostgresDB(t), defaultLane)
+	results := enqueue(t, q, 0,
+		queueItem("a", "1"),
+		queueItem("a", "1"),
+		queueItem("a", "2"),
+		queueItem("b", "1"),
+	)
+	want := []models.QueueAddResult{models.QueueAddAccepted, models.QueueAddDuplicate, models.QueueAddConflict, models.QueueAddAccepted}
+	for i := range want {
+		if results[i] != want[i] {
+			t.Errorf("item %d = %v, want %v", i, results[i], want[i])
+		}
+	}
+}
+
+func TestPostgresQueueMaxLen(t *testing.T) {
+	ctx := context.Background()
+	db := testPostgresDB(t)
+	q := NewPostgresQueue(db, defaultLane)
+	results := enqueue(t, q, 2, queueItem("a", "1"), queueItem("b", "1"), queueItem("c", "1"))
+	if results[2] != models.QueueAddFull {
+		t.Errorf("third item = %v, want full", results[2])
+	}
+	if length := queueLength(t, db, defaultLane); length != 2 {
+		t.Errorf("length = %d, want 2", length)
+	}
+
+	// The refused item's key was rolled back, and an ack frees its slot.
+	messages, err := q.Consume(ctx, "worker", 1, 0)
+	if err != nil || len(messages) != 1 {
+		t.Fatalf("Consume = %v, %v", messages, err)
+	}
+	if err := q.Ack(ctx, messages[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if results := enqueue(t, q, 2, queueItem("c", "1")); results[0] != models.QueueAddAccepted {
+		t.Errorf("retried item = %v, want accepted", results[0])
+	}
+}
+
+func TestPostgresQueueMaxLenConcurrent(t *testing.T) {
+	db := testPostgresDB(t)
+	q := NewPostgresQueue(db, defaultLane)
+
+	var wg sync.WaitGroup
+	accepted := make(chan struct{}, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results, errs := q.Enqueue(context.Background(), time.Minute, 5, []models.QueueItem{queueItem(fmt.Sprint(i), "1")})
+			if errs[0] != nil {
+				t.Error(errs[0])
+			}
+			if results[0] == models.QueueAddAccepted {
+				accepted <- struct{}{}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if len(accepted) != 5 {
+		t.Errorf("%d items accepted concurrently, want 5", len(accepted))
+	}
+	if length := queueLength(t, db, defaultLane); length != 5 {
+		t.Errorf("length = %d, want 5", length)
+	}
+}
+
+func TestPostgresQueueLengthFollowsDeadLetters(t *testing.T) {
+	ctx := context.Background()
+	db := testPostgresDB(t)
+	q := NewPostgresQueue(db, defaultLane)
+	enqueue(t, q, 0, queueItem("a", "1"), queueItem("b", "1"))
+
+	messages, _ := q.Consume(ctx, "worker", 2, 0)
+	for _, message := range messages {
+		if err := q.DeadLetter(ctx, message.ID, message.Values); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if length := queueLength(t, db, defaultLane); length != 0 {
+		t.Errorf("length after dead-lettering = %d, want 0", length)
+	}
+
+	dead, _, _ := q.DeadLetters(ctx, "", 10)
+	if _, ok, err := q.ReplayDeadLetter(ctx, dead[0].ID, dead[0].Values); err != nil || !ok {
+		t.Fatalf("ReplayDeadLetter = %v, %v", ok, err)
+	}
+	if length := queueLength(t, db, defaultLane); length != 1 {
+		t.Errorf("length after a replay = %d, want 1", length)
+	}
+
+	if queued, err := q.Purge(ctx); err != nil || queued != 1 {
+		t.Fatalf("Purge = %d, %v, want 1", queued, err)
+	}
+	if length := queueLength(t, db, defaultLane); length != 0 {
+		t.Errorf("length after Purge = %d, want 0", length)
+	}
+}
+
+func TestPostgresQueueLanesCountSeparately(t *testing.T) {
+	db := testPostgresDB(t)
+	high, low := NewPostgresQueue(db, "high"), NewPostgresQueue(db, "low")
+	enqueue(t, high, 1, queueItem("a", "1"))
+	if results := enqueue(t, low, 1, queueItem("b", "1")); results[0] != models.QueueAddAccepted {
+		t.Errorf("item on an empty lane = %v, want accepted", results[0])
+	}
+	if results := enqueue(t, high, 1, queueItem("c", "1")); results[0] != models.QueueAddFull {
+		t.Errorf("item on a full lane = %v, want full", results[0])
+	}
+}
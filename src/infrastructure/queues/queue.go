@@ -0,0 +1,95 @@
+package queues
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"payment-processor/config"
+	"payment-processor/core/models"
+	"payment-processor/infrastructure"
+	"payment-processor/interfaces"
+	"sort"
+)
+
+// NewQueue returns the backend selected by QUEUE_BACKEND: "redis" (default),
+// "memory" or "postgres". The memory backend is shared by the whole process,
+// the postgres backend uses db and the redis backend the Redis client store,
+// as returned by infrastructure.NewStore. With PRIORITY_LANES set it returns
+// a LaneQueue with one queue per lane, and on Redis with QUEUE_PARTITIONS
+// above 1 every lane is a PartitionedQueue.
+func NewQueue(store interfaces.Store, db *sql.DB) interfaces.Queue {
+	config := config.LoadConfig()
+	newQueue := laneConstructor(config.QueueBackend, store, db)
+	if config.PriorityLanes == "" {
+		return newQueue(defaultLane)
+	}
+	names, weights, err := ParseLanes(config.PriorityLanes)
+	if err != nil {
+		log.Fatal("Invalid PRIORITY_LANES:", err)
+	}
+	return NewLaneQueue(names, weights, newQueue)
+}
+
+func laneConstructor(backend string, store interfaces.Store, db *sql.DB) func(lane string) interfaces.Queue {
+	switch backend {
+	case "memory":
+		return func(lane string) interfaces.Queue {
+			return GetMemoryQueue(lane)
+		}
+	case "postgres":
+		return func(lane string) interfaces.Queue {
+			return NewPostgresQueue(db, lane)
+		}
+	case "redis", "":
+		redis, ok := store.(*infrastructure.Redis)
+		if !ok {
+			log.Fatalf("The redis queue backend needs a Redis store, got %T", store)
+		}
+		partitions := config.LoadConfig().QueuePartitions
+		if partitions > 1 {
+			return func(lane string) interfaces.Queue {
+				return NewPartitionedQueue(partitions, func(partition int) interfaces.Queue {
+					return NewRedisQueue(redis, lane, partition)
+				})
+			}
+		}
+		return func(lane string) interfaces.Queue {
+			return NewRedisQueue(redis, lane, -1)
+		}
+	default:
+		log.Fatalf("Unknown QUEUE_BACKEND %q, expected redis, memory or postgres", backend)
+		return nil
+	}
+}
+
+// stringValues normalises message values to strings, the only type Redis
+// streams hand back, so consumers see the same values on every backend.
+func stringValues(values map[string]interface{}) map[string]string {
+	normalised := make(map[string]string, len(values))
+	for field, value := range values {
+		normalised[field] = fmt.Sprint(value)
+	}
+	return normalised
+}
+
+func messageValues(values map[string]string) map[string]interface{} {
+	message := make(map[string]interface{}, len(values))
+	for field, value := range values {
+		message[field] = value
+	}
+	return message
+}
+
+func copyMessage(message models.QueueMessage) models.QueueMessage {
+	values := make(map[string]interface{}, len(message.Values))
+	for field, value := range message.Values {
+		values[field] = value
+	}
+	return models.QueueMessage{ID: message.ID, Values: values}
+}
+
+func sortMessages(messages []models.QueueMessage) {
+	sort.Slice(messages, func(i, j int) bool {
+		return infrastructure.CompareStreamIDs(messages[i].ID, messages[j].ID) < 0
+	})
+}
@@ -0,0 +1,210 @@
+package queues
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"payment-processor/config"
+	"payment-processor/core/models"
+	"payment-processor/infrastructure"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisQueue keeps payments in a Redis stream read through a consumer group,
+// retries in a sorted set scored by due time and dead letters in a second
+// stream. Each priority lane other than normal has a stream and retry set of
+// its own, suffixed with the lane name, and so does each partition, suffixed
+// with its number; dead letters and idempotency keys are shared.
+type RedisQueue struct {
+	redis   *infrastructure.Redis
+	stream  string
+	group   string
+	retries string
+	dead    string
+
+	mu      sync.Mutex
+	cursors map[string]string
+}
+
+// NewRedisQueue returns the queue of lane and partition; a negative partition
+// means the queue is not partitioned.
+func NewRedisQueue(redis *infrastructure.Redis, lane string, partition int) *RedisQueue {
+	config := config.LoadConfig()
+	q := &RedisQueue{
+		redis:   redis,
+		stream:  config.Queue,
+		group:   config.ConsumerGroup,
+		retries: config.RetryQueue,
+		dead:    config.DQLQueue,
+		cursors: make(map[string]string),
+	}
+	if lane != defaultLane {
+		q.stream += ":" + lane
+		q.retries += ":" + lane
+	}
+	if partition >= 0 {
+		q.stream += ":" + strconv.Itoa(partition)
+		q.retries += ":" + strconv.Itoa(partition)
+	}
+	return q
+}
+
+func (q *RedisQueue) Setup(ctx context.Context) error {
+	return q.redis.XGroupCreate(ctx, q.stream, q.group)
+}
+
+func (q *RedisQueue) Ping(ctx context.Context) error {
+	return q.redis.Ping(ctx)
+}
+
+func (q *RedisQueue) Enqueue(ctx context.Context, window time.Duration, maxLen int64, items []models.QueueItem) ([]models.QueueAddResult, []error) {
+	if len(items) == 1 {
+		result, err := q.redis.XAddIdempotent(ctx, items[0].Key, q.stream, items[0].Fingerprint, window, maxLen, items[0].Values)
+		return []models.QueueAddResult{result}, []error{err}
+	}
+	return q.redis.XAddIdempotentBatch(ctx, q.stream, window, maxLen, items)
+}
+
+func (q *RedisQueue) Consume(ctx context.Context, consumer string, count int64, block time.Duration) ([]models.QueueMessage, error) {
+	switch {
+	case block <= 0:
+		// go-redis sends BLOCK 0, wait forever, unless Block is negative.
+		block = -1
+	case block < time.Millisecond:
+		// BLOCK is in milliseconds, shorter waits would round down to 0.
+		block = time.Millisecond
+	}
+	streams, err := q.redis.MessagesConsumer(ctx, q.group, consumer, q.stream, count, block)
+	if err != nil {
+		if infrastructure.IsNoGroup(err) {
+			q.Setup(ctx)
+		}
+		return nil, err
+	}
+
+	var messages []models.QueueMessage
+	for _, stream := range streams {
+		messages = append(messages, toMessages(stream.Messages)...)
+	}
+	return messages, nil
+}
+
+// Reclaim resumes an XAUTOCLAIM scan per consumer and only starts a new scan
+// when XPENDING reports pending entries.
+func (q *RedisQueue) Reclaim(ctx context.Context, consumer string, minIdle time.Duration, count int64) ([]models.QueueMessage, error) {
+	q.mu.Lock()
+	cursor, ok := q.cursors[consumer]
+	q.mu.Unlock()
+	if !ok || cursor == "0-0" {
+		cursor = "0-0"
+		pending, err := q.redis.XPendingCount(ctx, q.stream, q.group)
+		if err != nil || pending == 0 {
+			return nil, err
+		}
+	}
+
+	claimed, next, err := q.redis.XAutoClaim(ctx, q.stream, q.group, consumer, minIdle, cursor, count)
+	if err != nil {
+		next = "0-0"
+	}
+	q.mu.Lock()
+	q.cursors[consumer] = next
+	q.mu.Unlock()
+
+	return toMessages(claimed), err
+}
+
+func (q *RedisQueue) Ack(ctx context.Context, id string) error {
+	return q.redis.XAck(ctx, q.stream, q.group, id)
+}
+
+func (q *RedisQueue) Backlog(ctx context.Context) (int64, int64, error) {
+	return q.redis.XGroupBacklog(ctx, q.stream, q.group)
+}
+
+func (q *RedisQueue) OldestUnacked(ctx context.Context) (time.Time, error) {
+	id, err := q.redis.XOldestUnacked(ctx, q.stream, q.group)
+	if err != nil || id == "" {
+		return time.Time{}, err
+	}
+	return infrastructure.StreamIDTime(id), nil
+}
+
+func (q *RedisQueue) Retry(ctx context.Context, id string, values map[string]interface{}, at time.Time) error {
+	member, err := json.Marshal(stringValues(values))
+	if err != nil {
+		return fmt.Errorf("failed to encode retry entry: %w", err)
+	}
+	return q.redis.ZAddAck(ctx, q.retries, at, string(member), q.stream, q.group, id)
+}
+
+func (q *RedisQueue) ReleaseDue(ctx context.Context, now time.Time, count int64) (int64, error) {
+	return q.redis.ZMoveDue(ctx, q.retries, q.stream, now, count)
+}
+
+func (q *RedisQueue) DeadLetter(ctx context.Context, id string, values map[string]interface{}) error {
+	return q.redis.XAddAck(ctx, q.dead, values, q.stream, q.group, id)
+}
+
+func (q *RedisQueue) DeadLetters(ctx context.Context, start string, count int64) ([]models.QueueMessage, int64, error) {
+	if start == "" {
+		start = "-"
+	}
+	entries, err := q.redis.XRange(ctx, q.dead, start, "+", count)
+	if err != nil {
+		return nil, 0, err
+	}
+	total, err := q.redis.XLen(ctx, q.dead)
+	if err != nil {
+		return nil, 0, err
+	}
+	return toMessages(entries), total, nil
+}
+
+func (q *RedisQueue) ReplayDeadLetter(ctx context.Context, id string, values map[string]interface{}) (string, bool, error) {
+	return q.redis.XDelAdd(ctx, q.dead, id, q.stream, values)
+}
+
+func (q *RedisQueue) DiscardDeadLetter(ctx context.Context, id string) (bool, error) {
+	deleted, err := q.redis.XDel(ctx, q.dead, id)
+	return deleted > 0, err
+}
+
+// Trim drops stream entries every consumer is done with; idempotency keys
+// expire on their own.
+func (q *RedisQueue) Trim(ctx context.Context, maxDeadLetters int64) error {
+	if _, err := q.redis.XTrimAcked(ctx, q.stream, q.group); err != nil {
+		return err
+	}
+	if maxDeadLetters > 0 {
+		if _, err := q.redis.XTrimMaxLen(ctx, q.dead, maxDeadLetters); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Purge drops the stream (recreating its consumer group), the retry schedule,
+// the dead letters and the idempotency keys.
+func (q *RedisQueue) Purge(ctx context.Context) (int64, error) {
+	streamEntries, _, _, err := q.redis.Purge(ctx, q.stream, q.group, q.retries, q.dead)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := q.redis.DeleteByPattern(ctx, config.LoadConfig().IdempotencyPrefix+"*"); err != nil {
+		return streamEntries, err
+	}
+	return streamEntries, nil
+}
+
+func toMessages(entries []redis.XMessage) []models.QueueMessage {
+	messages := make([]models.QueueMessage, len(entries))
+	for i, entry := range entries {
+		messages[i] = models.QueueMessage{ID: entry.ID, Values: entry.Values}
+	}
+	return messages
+}
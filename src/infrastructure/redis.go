@@ -3,7 +3,11 @@ package infrastructure
 import (
 	"context"
 	"fmt"
+	"log"
 	"payment-processor/config"
+	"payment-processor/core/models"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -13,6 +17,28 @@ type Redis struct {
 	client *redis.Client
 }
 
+// idempotentXAddScript claims the idempotency key and appends to the stream
+// atomically, so concurrent retries of the same request enqueue only once.
+// KEYS[1] = idempotency key, KEYS[2] = stream
+// ARGV[1] = fingerprint, ARGV[2] = window in seconds,
+// ARGV[3] = max stream length (0 = unbounded), ARGV[4..] = field/value pairs
+var idempotentXAddScript = redis.NewScript(`
+local existing = redis.call('GET', KEYS[1])
+if existing then
+	if existing == ARGV[1] then
+		return 1
+	end
+	return 2
+end
+local maxLen = tonumber(ARGV[3])
+if maxLen > 0 and redis.call('XLEN', KEYS[2]) >= maxLen then
+	return 3
+end
+redis.call('SET', KEYS[1], ARGV[1], 'EX', ARGV[2])
+redis.call('XADD', KEYS[2], '*', unpack(ARGV, 4))
+return 0
+`)
+
 func NewRedis() *Redis {
 	configs := config.LoadConfig()
 	r := redis.NewClient(&redis.Options{
@@ -28,9 +54,11 @@ func NewRedis() *Redis {
 		WriteTimeout: 500 * time.Millisecond, // Reduced from 1s
 
 	})
+	// Intake spools to disk and workers retry while Redis is down, so a failed
+	// ping is not fatal: the client reconnects on its own once Redis is back.
 	_, err := r.Ping(context.Background()).Result()
 	if err != nil {
-		panic("Failed to connect to Redis: " + err.Error())
+		log.Printf("Failed to connect to Redis, continuing in degraded mode: %v", err)
 	}
 
 	return &Redis{
@@ -62,6 +90,60 @@ func (r *Redis) Get(ctx context.Context, key string) (string, error) {
 	return value, nil
 }
 
+func (r *Redis) Incr(ctx context.Context, key string) (int64, error) {
+	value, err := r.client.Incr(ctx, key).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to increment key: %w", err)
+	}
+	return value, nil
+}
+
+// SetPublish stores value under key and publishes it on channel in one
+// transaction, so subscribers never see a value readers of key cannot.
+func (r *Redis) SetPublish(ctx context.Context, key, channel, value string, ttl time.Duration) error {
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, key, value, ttl)
+		pipe.Publish(ctx, channel, value)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set and publish: %w", err)
+	}
+	return nil
+}
+
+// Subscribe relays the payloads published on channel until ctx is done. The
+// subscription reconnects on its own.
+func (r *Redis) Subscribe(ctx context.Context, channel string) <-chan string {
+	subscription := r.client.Subscribe(ctx, channel)
+	payloads := make(chan string)
+	go func() {
+		defer close(payloads)
+		defer subscription.Close()
+		messages := subscription.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case message, ok := <-messages:
+				if !ok {
+					return
+				}
+				select {
+				case payloads <- message.Payload:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return payloads
+}
+
+func (r *Redis) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
+
 func (r *Redis) Close() error {
 	return r.client.Close()
 }
@@ -77,15 +159,14 @@ func (r *Redis) XAdd(ctx context.Context, stream string, values map[string]inter
 	return nil
 }
 
-func (r *Redis) MessagesConsumer(ctx context.Context, group, consumer, stream string, count int64) ([]redis.XStream, error) {
+func (r *Redis) MessagesConsumer(ctx context.Context, group, consumer, stream string, count int64, block time.Duration) ([]redis.XStream, error) {
 
 	streams, err := r.client.XReadGroup(ctx, &redis.XReadGroupArgs{
 		Group:    group,
 		Consumer: consumer,
 		Streams:  []string{stream, ">"},
-		Block:    4 * time.Second,
-		Count:    100,
-		NoAck:    true,
+		Block:    block,
+		Count:    count,
 	}).Result()
 
 	if err != nil {
@@ -98,6 +179,91 @@ func (r *Redis) MessagesConsumer(ctx context.Context, group, consumer, stream st
 	return streams, nil
 }
 
+// XAutoClaim transfers to consumer up to count pending entries that have been
+// idle for at least minIdle, scanning from start. It returns the claimed
+// entries and the cursor to resume from, "0-0" once the scan wrapped around.
+func (r *Redis) XAutoClaim(ctx context.Context, stream, group, consumer string, minIdle time.Duration, start string, count int64) ([]redis.XMessage, string, error) {
+	messages, next, err := r.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   stream,
+		Group:    group,
+		Consumer: consumer,
+		MinIdle:  minIdle,
+		Start:    start,
+		Count:    count,
+	}).Result()
+	if err != nil {
+		return nil, start, fmt.Errorf("failed to claim pending messages: %w", err)
+	}
+	return messages, next, nil
+}
+
+// XPendingCount returns how many entries of the group are delivered but not
+// yet acknowledged.
+func (r *Redis) XPendingCount(ctx context.Context, stream, group string) (int64, error) {
+	pending, err := r.client.XPending(ctx, stream, group).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read pending messages: %w", err)
+	}
+	return pending.Count, nil
+}
+
+// XGroupBacklog returns how many entries of stream the group has not read
+// yet (lag) and how many it read without acking (pending). When Redis cannot
+// tell the lag, after deletions inside the unread range, it is estimated
+// from the stream length, which retention keeps close to lag plus pending.
+func (r *Redis) XGroupBacklog(ctx context.Context, stream, group string) (int64, int64, error) {
+	groups, err := r.client.XInfoGroups(ctx, stream).Result()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read consumer groups: %w", err)
+	}
+	for _, info := range groups {
+		if info.Name != group {
+			continue
+		}
+		if info.Lag >= 0 {
+			return info.Lag, info.Pending, nil
+		}
+		length, err := r.client.XLen(ctx, stream).Result()
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to read stream length: %w", err)
+		}
+		return max(length-info.Pending, 0), info.Pending, nil
+	}
+	return 0, 0, nil
+}
+
+// XOldestUnacked returns the id of the oldest entry of stream the group has
+// not acked: the oldest pending one or, when older, the first one it has not
+// read yet. It returns "" when the group is caught up.
+func (r *Redis) XOldestUnacked(ctx context.Context, stream, group string) (string, error) {
+	pending, err := r.client.XPending(ctx, stream, group).Result()
+	if err != nil {
+		return "", fmt.Errorf("failed to read pending messages: %w", err)
+	}
+	oldest := ""
+	if pending.Count > 0 {
+		oldest = pending.Lower
+	}
+
+	groups, err := r.client.XInfoGroups(ctx, stream).Result()
+	if err != nil {
+		return "", fmt.Errorf("failed to read consumer groups: %w", err)
+	}
+	for _, info := range groups {
+		if info.Name != group {
+			continue
+		}
+		unread, err := r.client.XRangeN(ctx, stream, nextStreamID(info.LastDeliveredID), "+", 1).Result()
+		if err != nil {
+			return "", fmt.Errorf("failed to read stream: %w", err)
+		}
+		if len(unread) > 0 && (oldest == "" || CompareStreamIDs(unread[0].ID, oldest) < 0) {
+			oldest = unread[0].ID
+		}
+	}
+	return oldest, nil
+}
+
 func (r *Redis) XGroupCreate(ctx context.Context, stream, group string) error {
 	err := r.client.XGroupCreateMkStream(ctx, stream, group, "0").Err()
 	if err != nil && err.Error() != "BUSYGROUP Consumer Group name already exists" {
@@ -111,8 +277,8 @@ func (r *Redis) XAck(ctx context.Context, stream, group string, ids ...string) e
 	return err
 }
 
-func (r *Redis) ZAdd(ctx context.Context, key string, data redis.Z) error {
-	_, err := r.client.ZAdd(ctx, key, data).Result()
+func (r *Redis) ZAdd(ctx context.Context, key string, score float64, member string) error {
+	_, err := r.client.ZAdd(ctx, key, redis.Z{Score: score, Member: member}).Result()
 	if err != nil {
 		return fmt.Errorf("failed to add to sorted set: %w", err)
 	}
@@ -120,14 +286,653 @@ func (r *Redis) ZAdd(ctx context.Context, key string, data redis.Z) error {
 }
 
 func (r *Redis) ZRangeByScore(ctx context.Context, key string, min, max time.Time) ([]string, error) {
-	minFloat := fmt.Sprintf("%.6f", float64(min.Unix())+float64(min.Nanosecond())/1e9)
-	maxFloat := fmt.Sprintf("%.6f", float64(max.Unix())+float64(max.Nanosecond())/1e9)
 	values, err := r.client.ZRangeByScore(ctx, key, &redis.ZRangeBy{
-		Min: minFloat,
-		Max: maxFloat,
+		Min: unixScore(min),
+		Max: unixScore(max),
 	}).Result()
 	if err != nil {
 		return nil, fmt.Errorf("failed to range by score: %w", err)
 	}
 	return values, nil
 }
+
+// Purge atomically drops the stream (and with it every consumer group),
+// the given sorted set and plain keys, then recreates the consumer group so
+// running workers keep consuming. It returns how many stream entries, sorted
+// set members and keys were removed.
+func (r *Redis) Purge(ctx context.Context, stream, group, set string, keys ...string) (int64, int64, int64, error) {
+	var (
+		streamLen *redis.IntCmd
+		setLen    *redis.IntCmd
+		keysCount *redis.IntCmd
+	)
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		streamLen = pipe.XLen(ctx, stream)
+		setLen = pipe.ZCard(ctx, set)
+		if len(keys) > 0 {
+			keysCount = pipe.Exists(ctx, keys...)
+		}
+		pipe.Del(ctx, append([]string{stream, set}, keys...)...)
+		pipe.XGroupCreateMkStream(ctx, stream, group, "0")
+		return nil
+	})
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("failed to purge: %w", err)
+	}
+
+	var deletedKeys int64
+	if keysCount != nil {
+		deletedKeys = keysCount.Val()
+	}
+	return streamLen.Val(), setLen.Val(), deletedKeys, nil
+}
+
+// PurgeSet deletes a sorted set together with keys in one transaction and
+// returns how many members the set held and how many of keys existed.
+func (r *Redis) PurgeSet(ctx context.Context, set string, keys ...string) (int64, int64, error) {
+	var (
+		setLen    *redis.IntCmd
+		keysCount *redis.IntCmd
+	)
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		setLen = pipe.ZCard(ctx, set)
+		if len(keys) > 0 {
+			keysCount = pipe.Exists(ctx, keys...)
+		}
+		pipe.Del(ctx, append([]string{set}, keys...)...)
+		return nil
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to purge: %w", err)
+	}
+
+	var deletedKeys int64
+	if keysCount != nil {
+		deletedKeys = keysCount.Val()
+	}
+	return setLen.Val(), deletedKeys, nil
+}
+
+// HUpdate sets and increments hash fields and refreshes the key TTL in a
+// single round trip.
+func (r *Redis) HUpdate(ctx context.Context, key string, values map[string]interface{}, increments map[string]int64, ttl time.Duration) error {
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		if len(values) > 0 {
+			pipe.HSet(ctx, key, values)
+		}
+		for field, incr := range increments {
+			pipe.HIncrBy(ctx, key, field, incr)
+		}
+		if ttl > 0 {
+			pipe.Expire(ctx, key, ttl)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update hash: %w", err)
+	}
+	return nil
+}
+
+func (r *Redis) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	values, err := r.client.HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hash: %w", err)
+	}
+	return values, nil
+}
+
+// DeleteByPattern unlinks every key matching pattern, scanning incrementally
+// so large keyspaces do not block Redis.
+func (r *Redis) DeleteByPattern(ctx context.Context, pattern string) (int64, error) {
+	var (
+		cursor  uint64
+		deleted int64
+	)
+	for {
+		keys, next, err := r.client.Scan(ctx, cursor, pattern, 500).Result()
+		if err != nil {
+			return deleted, fmt.Errorf("failed to scan keys: %w", err)
+		}
+		if len(keys) > 0 {
+			n, err := r.client.Unlink(ctx, keys...).Result()
+			if err != nil {
+				return deleted, fmt.Errorf("failed to delete keys: %w", err)
+			}
+			deleted += n
+		}
+		cursor = next
+		if cursor == 0 {
+			return deleted, nil
+		}
+	}
+}
+
+// XAddIdempotent appends values to stream unless key was already claimed
+// within the window. A claim with the same fingerprint is reported as a
+// duplicate, a claim with a different one as a conflict. When maxLen is
+// positive and the stream already holds that many entries nothing is added.
+func (r *Redis) XAddIdempotent(ctx context.Context, key, stream, fingerprint string, window time.Duration, maxLen int64, values map[string]interface{}) (models.QueueAddResult, error) {
+	args := idempotentXAddArgs(fingerprint, window, maxLen, values)
+	result, err := idempotentXAddScript.Run(ctx, r.client, []string{key, stream}, args...).Int()
+	if err != nil {
+		return models.QueueAddAccepted, fmt.Errorf("failed to add to stream idempotently: %w", err)
+	}
+	return models.QueueAddResult(result), nil
+}
+
+// XAddIdempotentBatch runs XAddIdempotent for every item in one pipelined
+// round trip. Items are applied in order, so repeated keys inside the same
+// batch are reported as duplicates or conflicts of the first occurrence.
+//
+// Items call the script by its SHA. When Redis does not know it yet, the
+// script is loaded once and the items it refused are sent again.
+func (r *Redis) XAddIdempotentBatch(ctx context.Context, stream string, window time.Duration, maxLen int64, items []models.QueueItem) ([]models.QueueAddResult, []error) {
+	results := make([]models.QueueAddResult, len(items))
+	errs := make([]error, len(items))
+	if len(items) == 0 {
+		return results, errs
+	}
+
+	pending := make([]int, len(items))
+	for i := range items {
+		pending[i] = i
+	}
+	cmds := r.xAddIdempotentPipeline(ctx, stream, window, maxLen, items, pending)
+	var missing []int
+	for _, i := range pending {
+		if redis.HasErrorPrefix(cmds[i].Err(), "NOSCRIPT") {
+			missing = append(missing, i)
+		}
+	}
+	if len(missing) > 0 {
+		if err := idempotentXAddScript.Load(ctx, r.client).Err(); err != nil {
+			for _, i := range missing {
+				errs[i] = fmt.Errorf("failed to load idempotent add script: %w", err)
+			}
+		} else {
+			for i, cmd := range r.xAddIdempotentPipeline(ctx, stream, window, maxLen, items, missing) {
+				cmds[i] = cmd
+			}
+		}
+	}
+
+	for i, cmd := range cmds {
+		if errs[i] != nil {
+			continue
+		}
+		result, err := cmd.Int()
+		if err != nil {
+			errs[i] = fmt.Errorf("failed to add to stream idempotently: %w", err)
+			continue
+		}
+		results[i] = models.QueueAddResult(result)
+	}
+	return results, errs
+}
+
+// xAddIdempotentPipeline sends the items at indexes by EVALSHA in one
+// pipeline and returns their commands by index.
+func (r *Redis) xAddIdempotentPipeline(ctx context.Context, stream string, window time.Duration, maxLen int64, items []models.QueueItem, indexes []int) map[int]*redis.Cmd {
+	pipe := r.client.Pipeline()
+	cmds := make(map[int]*redis.Cmd, len(indexes))
+	for _, i := range indexes {
+		args := idempotentXAddArgs(items[i].Fingerprint, window, maxLen, items[i].Values)
+		cmds[i] = idempotentXAddScript.EvalSha(ctx, pipe, []string{items[i].Key, stream}, args...)
+	}
+	pipe.Exec(ctx)
+	return cmds
+}
+
+// HUpdateMany sets fields on many hashes and refreshes their TTL in one
+// pipelined round trip.
+func (r *Redis) HUpdateMany(ctx context.Context, updates []models.HashUpdate, ttl time.Duration) error {
+	if len(updates) == 0 {
+		return nil
+	}
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, update := range updates {
+			pipe.HSet(ctx, update.Key, update.Values)
+			if ttl > 0 {
+				pipe.Expire(ctx, update.Key, ttl)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update hashes: %w", err)
+	}
+	return nil
+}
+
+func idempotentXAddArgs(fingerprint string, window time.Duration, maxLen int64, values map[string]interface{}) []interface{} {
+	args := make([]interface{}, 0, 3+len(values)*2)
+	args = append(args, fingerprint, int64(window/time.Second), maxLen)
+	for field, value := range values {
+		args = append(args, field, value)
+	}
+	return args
+}
+
+// IsOutOfMemory reports whether err is Redis refusing a write because
+// maxmemory was reached under the noeviction policy.
+func IsOutOfMemory(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "OOM ")
+}
+
+// IsNoGroup reports whether err is Redis complaining that the stream or its
+// consumer group does not exist, e.g. after a purge or a Redis restart.
+func IsNoGroup(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "NOGROUP")
+}
+
+// zClaimDueScript atomically returns up to ARGV[3] members whose score is at
+// most ARGV[1] and pushes their score to ARGV[2], so concurrent pollers never
+// claim the same member and a claimer that dies leaves it due again later.
+var zClaimDueScript = redis.NewScript(`
+local members = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[3])
+for _, member in ipairs(members) do
+	redis.call('ZADD', KEYS[1], 'XX', ARGV[2], member)
+end
+return members
+`)
+
+// ZClaimDue claims up to count members of a schedule sorted set that are due
+// at or before now. Claimed members become due again after lease unless the
+// claimer removes or reschedules them first.
+func (r *Redis) ZClaimDue(ctx context.Context, key string, now time.Time, lease time.Duration, count int64) ([]string, error) {
+	members, err := zClaimDueScript.Run(ctx, r.client, []string{key}, unixScore(now), unixScore(now.Add(lease)), count).StringSlice()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to pop due members: %w", err)
+	}
+	return members, nil
+}
+
+// acquireLeaseScript gives KEYS[1] to owner ARGV[1] for ARGV[2] milliseconds
+// when it is free or already held by the same owner.
+var acquireLeaseScript = redis.NewScript(`
+local holder = redis.call('GET', KEYS[1])
+if holder == ARGV[1] then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+	return 1
+end
+if holder then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+return 1
+`)
+
+// AcquireLease takes or renews the lease key for owner until ttl from now and
+// reports whether owner holds it.
+func (r *Redis) AcquireLease(ctx context.Context, key, owner string, ttl time.Duration) (bool, error) {
+	held, err := acquireLeaseScript.Run(ctx, r.client, []string{key}, owner, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire lease: %w", err)
+	}
+	return held == 1, nil
+}
+
+// LPushTrim prepends value to a capped list and refreshes its TTL.
+func (r *Redis) LPushTrim(ctx context.Context, key string, value string, maxLen int64, ttl time.Duration) error {
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LPush(ctx, key, value)
+		pipe.LTrim(ctx, key, 0, maxLen-1)
+		if ttl > 0 {
+			pipe.Expire(ctx, key, ttl)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to push to list: %w", err)
+	}
+	return nil
+}
+
+func (r *Redis) LRange(ctx context.Context, key string, start, stop int64) ([]string, error) {
+	values, err := r.client.LRange(ctx, key, start, stop).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to range list: %w", err)
+	}
+	return values, nil
+}
+
+func (r *Redis) ZRem(ctx context.Context, key string, members ...string) error {
+	values := make([]interface{}, len(members))
+	for i, member := range members {
+		values[i] = member
+	}
+	if err := r.client.ZRem(ctx, key, values...).Err(); err != nil {
+		return fmt.Errorf("failed to remove from sorted set: %w", err)
+	}
+	return nil
+}
+
+// XAddAck adds values to stream and acks id on ackStream for group in one
+// transaction, so an entry is never both lost and left unacked.
+func (r *Redis) XAddAck(ctx context.Context, stream string, values map[string]interface{}, ackStream, group, id string) error {
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAdd(ctx, &redis.XAddArgs{Stream: stream, Values: values})
+		pipe.XAck(ctx, ackStream, group, id)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to move stream entry: %w", err)
+	}
+	return nil
+}
+
+// KEYS[1] = source stream, KEYS[2] = destination stream
+// ARGV[1] = source entry id, ARGV[2..] = field/value pairs
+var xDelAddScript = redis.NewScript(`
+if redis.call('XDEL', KEYS[1], ARGV[1]) == 0 then
+	return false
+end
+return redis.call('XADD', KEYS[2], '*', unpack(ARGV, 2))
+`)
+
+// XDelAdd deletes id from stream and, only if it was there, adds values to
+// destination. It reports false when id did not exist.
+func (r *Redis) XDelAdd(ctx context.Context, stream, id, destination string, values map[string]interface{}) (string, bool, error) {
+	args := []interface{}{id}
+	for field, value := range values {
+		args = append(args, field, value)
+	}
+	newID, err := xDelAddScript.Run(ctx, r.client, []string{stream, destination}, args...).Text()
+	if err == redis.Nil {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to move stream entry: %w", err)
+	}
+	return newID, true, nil
+}
+
+func (r *Redis) XRange(ctx context.Context, stream, start, end string, count int64) ([]redis.XMessage, error) {
+	messages, err := r.client.XRangeN(ctx, stream, start, end, count).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to range stream: %w", err)
+	}
+	return messages, nil
+}
+
+func (r *Redis) XDel(ctx context.Context, stream string, ids ...string) (int64, error) {
+	deleted, err := r.client.XDel(ctx, stream, ids...).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete stream entries: %w", err)
+	}
+	return deleted, nil
+}
+
+func (r *Redis) XLen(ctx context.Context, stream string) (int64, error) {
+	length, err := r.client.XLen(ctx, stream).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read stream length: %w", err)
+	}
+	return length, nil
+}
+
+// ZAddAck schedules member in the sorted set key and acks id on stream for
+// group in one transaction.
+func (r *Redis) ZAddAck(ctx context.Context, key string, score time.Time, member string, stream, group, id string) error {
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, key, redis.Z{Score: float64(score.UnixNano()) / 1e9, Member: member})
+		pipe.XAck(ctx, stream, group, id)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to schedule stream entry: %w", err)
+	}
+	return nil
+}
+
+// KEYS[1] = schedule sorted set, KEYS[2] = stream
+// ARGV[1] = now, ARGV[2] = max members to move
+// Members are JSON objects of string fields, added to the stream as is.
+var zMoveDueScript = redis.NewScript(`
+local members = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+for _, member in ipairs(members) do
+	local args = {}
+	for field, value in pairs(cjson.decode(member)) do
+		table.insert(args, field)
+		table.insert(args, value)
+	end
+	redis.call('XADD', KEYS[2], '*', unpack(args))
+	redis.call('ZREM', KEYS[1], member)
+end
+return #members
+`)
+
+// ZMoveDue moves up to count members of the schedule key that are due at or
+// before now to stream, atomically, and returns how many were moved.
+func (r *Redis) ZMoveDue(ctx context.Context, key, stream string, now time.Time, count int64) (int64, error) {
+	moved, err := zMoveDueScript.Run(ctx, r.client, []string{key, stream}, unixScore(now), count).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("failed to release due entries: %w", err)
+	}
+	return moved, nil
+}
+
+// XTrimAcked trims entries of stream that every reader of group is done
+// with: entries older than both the oldest pending entry and the group's last
+// delivered id. Trimming is approximate (MINID ~), so Redis may keep a few
+// more entries to trim whole macro nodes.
+func (r *Redis) XTrimAcked(ctx context.Context, stream, group string) (int64, error) {
+	groups, err := r.client.XInfoGroups(ctx, stream).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read consumer groups: %w", err)
+	}
+	var boundary string
+	for _, info := range groups {
+		if info.Name == group {
+			boundary = nextStreamID(info.LastDeliveredID)
+		}
+	}
+	if boundary == "" {
+		return 0, nil
+	}
+
+	pending, err := r.client.XPending(ctx, stream, group).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read pending messages: %w", err)
+	}
+	if pending.Count > 0 && CompareStreamIDs(pending.Lower, boundary) < 0 {
+		boundary = pending.Lower
+	}
+
+	trimmed, err := r.client.XTrimMinIDApprox(ctx, stream, boundary, 0).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to trim stream: %w", err)
+	}
+	return trimmed, nil
+}
+
+// XTrimMaxLen approximately caps stream to maxLen entries, dropping the oldest.
+func (r *Redis) XTrimMaxLen(ctx context.Context, stream string, maxLen int64) (int64, error) {
+	trimmed, err := r.client.XTrimMaxLenApprox(ctx, stream, maxLen, 0).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to trim stream: %w", err)
+	}
+	return trimmed, nil
+}
+
+// KEYS[1] = processed payments sorted set, KEYS[2] = compaction watermark
+// ARGV[1] = compact members scored before this unix second, ARGV[2] = max
+// members per run, ARGV[3] = nonce keeping bucket members unique
+//
+// Members are JSON payments scored by their requestedAt second. Members of
+// the same second and processor are replaced by one bucket member carrying
+// "count" and the summed "amount". Existing buckets are merged like payments.
+var zCompactScript = redis.NewScript(`
+local from = redis.call('GET', KEYS[2]) or '-inf'
+local limit = tonumber(ARGV[2])
+local members = redis.call('ZRANGEBYSCORE', KEYS[1], from, '(' .. ARGV[1], 'WITHSCORES', 'LIMIT', 0, limit)
+local fetched = #members / 2
+if fetched == 0 then
+	return 0
+end
+
+local stop = tonumber(ARGV[1])
+local watermark = stop
+if fetched >= limit then
+	-- Only compact whole seconds; the last one may continue past the limit.
+	local first = math.floor(tonumber(members[2]))
+	local last = math.floor(tonumber(members[#members]))
+	watermark = last
+	if last > first then
+		stop = last
+	else
+		stop = last + 1
+	end
+end
+
+local buckets, order, removed = {}, {}, {}
+for i = 1, #members, 2 do
+	local second = math.floor(tonumber(members[i + 1]))
+	if second < stop then
+		local ok, payment = pcall(cjson.decode, members[i])
+		if ok and type(payment) == 'table' and type(payment.type) == 'string' and payment.type ~= '' then
+			local key = second .. ':' .. payment.type
+			local bucket = buckets[key]
+			if not bucket then
+				bucket = { second = second, type = payment.type, requestedAt = payment.requestedAt, count = 0, cents = 0 }
+				buckets[key] = bucket
+				table.insert(order, key)
+			end
+			bucket.count = bucket.count + (tonumber(payment.count) or 1)
+			bucket.cents = bucket.cents + math.floor((tonumber(payment.amount) or 0) * 100 + 0.5)
+			table.insert(removed, members[i])
+		end
+	end
+end
+if #removed == 0 then
+	redis.call('SET', KEYS[2], watermark)
+	return 0
+end
+
+redis.call('ZREM', KEYS[1], unpack(removed))
+for _, key in ipairs(order) do
+	local bucket = buckets[key]
+	redis.call('ZADD', KEYS[1], bucket.second, cjson.encode({
+		type = bucket.type,
+		requestedAt = bucket.requestedAt,
+		count = bucket.count,
+		amount = string.format('%d.%02d', math.floor(bucket.cents / 100), bucket.cents % 100),
+		compactedAt = ARGV[3],
+	}))
+end
+redis.call('SET', KEYS[2], watermark)
+return #removed
+`)
+
+// ZCompact folds processed payments scored before the given time into one
+// member per second and processor, resuming where the previous call stopped,
+// and returns how many members were folded.
+func (r *Redis) ZCompact(ctx context.Context, key, watermarkKey string, before time.Time, limit int64) (int64, error) {
+	folded, err := zCompactScript.Run(ctx, r.client, []string{key, watermarkKey}, before.Unix(), limit, time.Now().UnixNano()).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("failed to compact sorted set: %w", err)
+	}
+	return folded, nil
+}
+
+func (r *Redis) ZRemRangeBefore(ctx context.Context, key string, before time.Time) (int64, error) {
+	removed, err := r.client.ZRemRangeByScore(ctx, key, "-inf", "("+unixScore(before)).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to remove from sorted set: %w", err)
+	}
+	return removed, nil
+}
+
+// ZHeartbeat scores member with now, drops members not seen within ttl and
+// returns the remaining ones, in one transaction.
+func (r *Redis) ZHeartbeat(ctx context.Context, key, member string, now time.Time, ttl time.Duration) ([]string, error) {
+	var members *redis.StringSliceCmd
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, key, redis.Z{Score: float64(now.UnixNano()) / 1e9, Member: member})
+		pipe.ZRemRangeByScore(ctx, key, "-inf", "("+unixScore(now.Add(-ttl)))
+		members = pipe.ZRange(ctx, key, 0, -1)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to heartbeat: %w", err)
+	}
+	return members.Val(), nil
+}
+
+// Trim is a no-op: Redis expires keys itself.
+func (r *Redis) Trim(ctx context.Context) error {
+	return nil
+}
+
+// MemoryUsage returns used_memory and maxmemory from INFO memory. max is 0
+// when Redis runs without a memory limit.
+func (r *Redis) MemoryUsage(ctx context.Context) (int64, int64, error) {
+	info, err := r.client.Info(ctx, "memory").Result()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read memory info: %w", err)
+	}
+
+	var used, max int64
+	for _, line := range strings.Split(info, "\n") {
+		field, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok {
+			continue
+		}
+		switch field {
+		case "used_memory":
+			used, _ = strconv.ParseInt(value, 10, 64)
+		case "maxmemory":
+			max, _ = strconv.ParseInt(value, 10, 64)
+		}
+	}
+	return used, max, nil
+}
+
+// nextStreamID returns the smallest stream id greater than id.
+func nextStreamID(id string) string {
+	ms, seq, ok := strings.Cut(id, "-")
+	if !ok {
+		return id
+	}
+	sequence, err := strconv.ParseUint(seq, 10, 64)
+	if err != nil {
+		return id
+	}
+	return ms + "-" + strconv.FormatUint(sequence+1, 10)
+}
+
+// CompareStreamIDs orders "<ms>-<seq>" ids as Redis does; a missing sequence
+// is 0. The queue backends order their own ids the same way.
+func CompareStreamIDs(a, b string) int {
+	aMs, aSeq := splitStreamID(a)
+	bMs, bSeq := splitStreamID(b)
+	switch {
+	case aMs < bMs, aMs == bMs && aSeq < bSeq:
+		return -1
+	case aMs == bMs && aSeq == bSeq:
+		return 0
+	default:
+		return 1
+	}
+}
+
+// StreamIDTime returns when a "<ms>-<seq>" id was generated.
+func StreamIDTime(id string) time.Time {
+	ms, _ := splitStreamID(id)
+	return time.UnixMilli(int64(ms))
+}
+
+func splitStreamID(id string) (uint64, uint64) {
+	ms, seq, _ := strings.Cut(id, "-")
+	msValue, _ := strconv.ParseUint(ms, 10, 64)
+	seqValue, _ := strconv.ParseUint(seq, 10, 64)
+	return msValue, seqValue
+}
+
+func unixScore(t time.Time) string {
+	return fmt.Sprintf("%.6f", float64(t.Unix())+float64(t.Nanosecond())/1e9)
+}
@@ -0,0 +1,32 @@
+package infrastructure
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCompareStreamIDs(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1-0", "1-0", 0},
+		{"1-0", "2-0", -1},
+		{"2-0", "1-0", 1},
+		{"1-2", "1-10", -1},
+		{"9-0", "10-0", -1},
+		{"1752582896101-3", "1752582896101-12", -1},
+		{"1", "1-0", 0},
+	}
+	for _, tt := range tests {
+		if got := CompareStreamIDs(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareStreamIDs(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestStreamIDTime(t *testing.T) {
+	if got := StreamIDTime("1752582896101-3"); !got.Equal(time.UnixMilli(1752582896101)) {
+		t.Errorf("StreamIDTime = %v", got)
+	}
+}
@@ -58,20 +58,13 @@ func (r *PaymentRepository) BatchCreatePayments(ctx context.Context, payments []
 	placeholders := []string{}
 
 	for i, payment := range payments {
-		var Type int
-		if payment.Type == "default" {
-			Type = 1
-		} else {
-			Type = 2
-		}
-
 		createdAt, err := time.Parse(time.RFC3339, payment.RequestedAt)
 		if err != nil {
 			createdAt = time.Now().UTC()
 		}
 
 		placeholders = append(placeholders, fmt.Sprintf("($%d, $%d, $%d, $%d)", i*4+1, i*4+2, i*4+3, i*4+4))
-		values = append(values, payment.CorrelationID, payment.Amount, Type, createdAt)
+		values = append(values, payment.CorrelationID, payment.Amount, payment.Type, createdAt)
 	}
 
 	query += strings.Join(placeholders, ", ")
@@ -84,3 +77,33 @@ func (r *PaymentRepository) BatchCreatePayments(ctx context.Context, payments []
 
 	return nil
 }
+
+// DeleteAllPayments empties the rinha table in a transaction that commits only
+// once purge, which clears the matching state elsewhere, succeeded. The table
+// stays locked against inserts meanwhile, so no batch lands in between.
+func (r *PaymentRepository) DeleteAllPayments(ctx context.Context, purge func() error) (int64, error) {
+	tx, err := r.conn.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin purge: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `LOCK TABLE rinha IN EXCLUSIVE MODE`); err != nil {
+		return 0, fmt.Errorf("failed to lock payments: %w", err)
+	}
+	result, err := tx.ExecContext(ctx, `DELETE FROM rinha`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete payments: %w", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count deleted payments: %w", err)
+	}
+	if err := purge(); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit purge: %w", err)
+	}
+	return deleted, nil
+}
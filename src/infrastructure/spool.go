@@ -0,0 +1,237 @@
+package infrastructure
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"payment-processor/config"
+	"payment-processor/core/models"
+	"strconv"
+	"sync"
+)
+
+// Spool is an append-only write-ahead log on local disk. Intake writes
+// payments to it when Redis cannot be reached, and a replayer drains it back
+// into the stream, in order, once Redis recovers.
+//
+// Records are JSON lines; the byte offset of the first record not yet
+// replayed is kept in a sidecar file so a restart resumes where it stopped.
+type Spool struct {
+	// replayMu serialises replays; mu guards the file and offsets and is never
+	// held while a replayed record is being enqueued.
+	replayMu   sync.Mutex
+	mu         sync.Mutex
+	path       string
+	offsetPath string
+	file       *os.File
+	offset     int64
+	size       int64
+}
+
+type SpoolRecord struct {
+	Queue    string          `json:"queue"`
+	Payment  models.Payment  `json:"payment"`
+	Priority models.Priority `json:"priority,omitempty"`
+}
+
+var (
+	spool     *Spool
+	spoolOnce sync.Once
+)
+
+// GetSpool returns the process-wide spool, or nil when spooling is disabled
+// or the spool directory cannot be used.
+func GetSpool() *Spool {
+	spoolOnce.Do(func() {
+		configs := config.LoadConfig()
+		if !configs.SpoolEnabled {
+			return
+		}
+		s, err := openSpool(configs.SpoolDir)
+		if err != nil {
+			log.Printf("Spool disabled: %v", err)
+			return
+		}
+		spool = s
+	})
+	return spool
+}
+
+func openSpool(dir string) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create spool dir: %w", err)
+	}
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "local"
+	}
+
+	path := filepath.Join(dir, hostname+".wal")
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open spool: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to stat spool: %w", err)
+	}
+	// A crash mid-append leaves a record without its newline, which the next
+	// append would run into. Drop it so later records stay intact.
+	size, err := completeRecordsEnd(file, info.Size())
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read spool: %w", err)
+	}
+	if size < info.Size() {
+		log.Printf("Spool: dropping %d bytes of a torn record at the end of %s", info.Size()-size, path)
+		if err := file.Truncate(size); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to truncate spool: %w", err)
+		}
+	}
+
+	s := &Spool{
+		path:       path,
+		offsetPath: path + ".offset",
+		file:       file,
+		size:       size,
+	}
+	if data, err := os.ReadFile(s.offsetPath); err == nil {
+		s.offset, _ = strconv.ParseInt(string(data), 10, 64)
+	}
+	if s.offset > s.size {
+		s.offset = 0
+	}
+	return s, nil
+}
+
+// completeRecordsEnd returns the offset just past the last newline of the
+// first size bytes of file, which is where its last complete record ends.
+func completeRecordsEnd(file *os.File, size int64) (int64, error) {
+	buf := make([]byte, 4096)
+	for end := size; end > 0; {
+		start := max(end-int64(len(buf)), 0)
+		chunk := buf[:end-start]
+		if _, err := file.ReadAt(chunk, start); err != nil {
+			return 0, err
+		}
+		if i := bytes.LastIndexByte(chunk, '\n'); i >= 0 {
+			return start + int64(i) + 1, nil
+		}
+		end = start
+	}
+	return 0, nil
+}
+
+// Append durably writes record to the end of the spool.
+func (s *Spool) Append(record SpoolRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode spool record: %w", err)
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.file.Write(line); err != nil {
+		return fmt.Errorf("failed to append to spool: %w", err)
+	}
+	if err := s.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync spool: %w", err)
+	}
+	s.size += int64(len(line))
+	return nil
+}
+
+// Pending reports whether there are records waiting to be replayed. Intake
+// keeps appending to the spool while it is not empty so replayed and new
+// payments reach the stream in arrival order.
+func (s *Spool) Pending() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.offset < s.size
+}
+
+// Replay hands every pending record to fn in order. It stops at the first
+// error, keeping that record for the next replay, and compacts the file once
+// everything has been replayed. Appends go on while fn runs; records appended
+// during a replay are left for the next one.
+func (s *Spool) Replay(fn func(SpoolRecord) error) (int, error) {
+	s.replayMu.Lock()
+	defer s.replayMu.Unlock()
+
+	s.mu.Lock()
+	offset, end := s.offset, s.size
+	s.mu.Unlock()
+	if offset >= end {
+		return 0, nil
+	}
+
+	reader, err := os.Open(s.path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open spool for replay: %w", err)
+	}
+	defer reader.Close()
+
+	replayed := 0
+	buffered := bufio.NewReader(io.NewSectionReader(reader, offset, end-offset))
+	for offset < end {
+		line, err := buffered.ReadBytes('\n')
+		if err != nil {
+			// A torn write at the tail: leave it for the next attempt.
+			break
+		}
+
+		var record SpoolRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			log.Printf("Skipping corrupt spool record at offset %d: %v", offset, err)
+		} else if err := fn(record); err != nil {
+			s.advance(offset)
+			return replayed, err
+		} else {
+			replayed++
+		}
+		offset += int64(len(line))
+	}
+	return replayed, s.advance(offset)
+}
+
+// advance records that everything before offset was replayed, and compacts
+// the file when nothing was appended in the meantime.
+func (s *Spool) advance(offset int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.offset = offset
+	if s.offset >= s.size {
+		return s.truncate()
+	}
+	s.saveOffset()
+	return nil
+}
+
+func (s *Spool) truncate() error {
+	if err := s.file.Truncate(0); err != nil {
+		return fmt.Errorf("failed to truncate spool: %w", err)
+	}
+	s.offset = 0
+	s.size = 0
+	s.saveOffset()
+	return nil
+}
+
+func (s *Spool) saveOffset() {
+	tmp := s.offsetPath + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strconv.FormatInt(s.offset, 10)), 0o644); err != nil {
+		log.Printf("Failed to save spool offset: %v", err)
+		return
+	}
+	if err := os.Rename(tmp, s.offsetPath); err != nil {
+		log.Printf("Failed to save spool offset: %v", err)
+	}
+}
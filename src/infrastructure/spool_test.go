@@ -0,0 +1,178 @@
+package infrastructure
+
+import (
+	"errors"
+	"os"
+	"payment-processor/core/models"
+	"testing"
+)
+
+func spoolRecord(id string) SpoolRecord {
+	return SpoolRecord{Queue: "payments", Payment: models.Payment{CorrelationID: id, Amount: 1990}}
+}
+
+func appendRecords(t *testing.T, s *Spool, ids ...string) {
+	t.Helper()
+	for _, id := range ids {
+		if err := s.Append(spoolRecord(id)); err != nil {
+			t.Fatalf("Append(%s): %v", id, err)
+		}
+	}
+}
+
+func replayIDs(t *testing.T, s *Spool) []string {
+	t.Helper()
+	var ids []string
+	if _, err := s.Replay(func(record SpoolRecord) error {
+		ids = append(ids, record.Payment.CorrelationID)
+		return nil
+	}); err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	return ids
+}
+
+func equalIDs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSpoolReplaysInOrderAndCompacts(t *testing.T) {
+	s, err := openSpool(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.file.Close()
+	if s.Pending() {
+		t.Fatal("new spool has pending records")
+	}
+	appendRecords(t, s, "a", "b", "c")
+	if !s.Pending() {
+		t.Fatal("spool has no pending records after Append")
+	}
+
+	if got := replayIDs(t, s); !equalIDs(got, []string{"a", "b", "c"}) {
+		t.Errorf("replayed %v", got)
+	}
+	if s.Pending() {
+		t.Error("spool still pending after a full replay")
+	}
+	if info, err := os.Stat(s.path); err != nil || info.Size() != 0 {
+		t.Errorf("spool file was not truncated: %v, %v", info, err)
+	}
+}
+
+func TestSpoolReplayStopsAtErrorAndResumes(t *testing.T) {
+	dir := t.TempDir()
+	s, err := openSpool(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendRecords(t, s, "a", "b", "c")
+
+	queueFull := errors.New("queue is full")
+	var seen []string
+	replayed, err := s.Replay(func(record SpoolRecord) error {
+		if record.Payment.CorrelationID == "b" {
+			return queueFull
+		}
+		seen = append(seen, record.Payment.CorrelationID)
+		return nil
+	})
+	if !errors.Is(err, queueFull) || replayed != 1 || !equalIDs(seen, []string{"a"}) {
+		t.Fatalf("Replay = %d, %v after %v", replayed, err, seen)
+	}
+
+	// The failed record is kept, and the offset survives a restart.
+	s.file.Close()
+	reopened, err := openSpool(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.file.Close()
+	if got := replayIDs(t, reopened); !equalIDs(got, []string{"b", "c"}) {
+		t.Errorf("resumed replay gave %v", got)
+	}
+}
+
+func TestSpoolAppendDuringReplay(t *testing.T) {
+	s, err := openSpool(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.file.Close()
+	appendRecords(t, s, "a", "b")
+
+	var seen []string
+	if _, err := s.Replay(func(record SpoolRecord) error {
+		seen = append(seen, record.Payment.CorrelationID)
+		if record.Payment.CorrelationID == "a" {
+			// Would deadlock if Replay held the spool lock around fn.
+			appendRecords(t, s, "c")
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !equalIDs(seen, []string{"a", "b"}) {
+		t.Errorf("first replay gave %v, want records appended during it left for later", seen)
+	}
+	if !s.Pending() {
+		t.Fatal("record appended during replay was lost")
+	}
+	if got := replayIDs(t, s); !equalIDs(got, []string{"c"}) {
+		t.Errorf("second replay gave %v", got)
+	}
+}
+
+func TestSpoolSkipsCorruptRecords(t *testing.T) {
+	s, err := openSpool(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.file.Close()
+	appendRecords(t, s, "a")
+	s.mu.Lock()
+	n, err := s.file.WriteString("{not json\n")
+	s.size += int64(n)
+	s.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendRecords(t, s, "b")
+
+	if got := replayIDs(t, s); !equalIDs(got, []string{"a", "b"}) {
+		t.Errorf("replayed %v", got)
+	}
+}
+
+func TestSpoolDropsTornTail(t *testing.T) {
+	dir := t.TempDir()
+	s, err := openSpool(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendRecords(t, s, "a")
+	// A crash halfway through appending "b".
+	if _, err := s.file.WriteString(`{"queue":"payments","payment":{"correla`); err != nil {
+		t.Fatal(err)
+	}
+	s.file.Close()
+
+	s, err = openSpool(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.file.Close()
+	appendRecords(t, s, "c")
+	if got := replayIDs(t, s); !equalIDs(got, []string{"a", "c"}) {
+		t.Errorf("replayed %v, want a and c", got)
+	}
+}
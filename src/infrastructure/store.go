@@ -0,0 +1,17 @@
+package infrastructure
+
+import (
+	"database/sql"
+	"payment-processor/config"
+	"payment-processor/interfaces"
+)
+
+// NewStore returns the store for QUEUE_BACKEND: the postgres backend keeps
+// everything in db so it runs without Redis, every other backend uses Redis.
+func NewStore(db *sql.DB) interfaces.Store {
+	config := config.LoadConfig()
+	if config.QueueBackend == "postgres" {
+		return NewPostgresStore(db, config.Database.ConnectionString())
+	}
+	return NewRedis()
+}
@@ -8,4 +8,5 @@ import (
 type DatabaseConnection interface {
 	Execute(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
 	Query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	Begin(ctx context.Context) (*sql.Tx, error)
 }
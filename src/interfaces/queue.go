@@ -0,0 +1,59 @@
+package interfaces
+
+import (
+	"context"
+	"payment-processor/core/models"
+	"time"
+)
+
+// Queue is the payments queue: intake enqueues, workers consume and ack,
+// failed deliveries are retried later or dead-lettered. Every delivery stays
+// pending until it is acked, retried or dead-lettered, so a consumer that dies
+// mid-batch loses nothing; Reclaim hands its deliveries to another consumer.
+type Queue interface {
+	// Setup creates whatever the backend needs before consuming. It is safe to
+	// call again, and Consume calls it itself after the backend lost it.
+	Setup(ctx context.Context) error
+	Ping(ctx context.Context) error
+
+	// Enqueue adds every item whose Key was not enqueued within window. A
+	// repeated Key with the same Fingerprint is a duplicate, with another one a
+	// conflict. When maxLen is positive and the queue already holds that many
+	// messages the item is not added. Results and errors are per item.
+	Enqueue(ctx context.Context, window time.Duration, maxLen int64, items []models.QueueItem) ([]models.QueueAddResult, []error)
+	// Consume returns up to count new messages for consumer, waiting up to
+	// block for the first one; with block <= 0 it does not wait.
+	Consume(ctx context.Context, consumer string, count int64, block time.Duration) ([]models.QueueMessage, error)
+	// Reclaim transfers to consumer up to count deliveries left unacked for at
+	// least minIdle.
+	Reclaim(ctx context.Context, consumer string, minIdle time.Duration, count int64) ([]models.QueueMessage, error)
+	Ack(ctx context.Context, id string) error
+	// Backlog returns how many messages wait to be consumed and how many are
+	// delivered but not acked yet. Scheduled retries count once due.
+	Backlog(ctx context.Context) (int64, int64, error)
+	// OldestUnacked returns when the oldest message still waiting or pending
+	// was queued, or the zero time when there is none.
+	OldestUnacked(ctx context.Context) (time.Time, error)
+	// Retry acks the delivery id and queues values again once at has passed.
+	Retry(ctx context.Context, id string, values map[string]interface{}, at time.Time) error
+	// ReleaseDue makes up to count retries that are due at now consumable and
+	// returns how many it released. Backends that schedule natively return 0.
+	ReleaseDue(ctx context.Context, now time.Time, count int64) (int64, error)
+
+	// DeadLetter acks the delivery id and moves values to the dead-letter queue.
+	DeadLetter(ctx context.Context, id string, values map[string]interface{}) error
+	// DeadLetters returns up to count dead letters from id start (inclusive,
+	// empty for the oldest) and how many there are in total.
+	DeadLetters(ctx context.Context, start string, count int64) ([]models.QueueMessage, int64, error)
+	// ReplayDeadLetter removes the dead letter id and queues values instead.
+	// It reports false when id does not exist.
+	ReplayDeadLetter(ctx context.Context, id string, values map[string]interface{}) (string, bool, error)
+	DiscardDeadLetter(ctx context.Context, id string) (bool, error)
+
+	// Trim releases storage held by acked messages and expired keys and caps
+	// the dead-letter queue at maxDeadLetters (0 = unbounded).
+	Trim(ctx context.Context, maxDeadLetters int64) error
+	// Purge drops every message, retry, dead letter and key and returns how
+	// many messages were still queued.
+	Purge(ctx context.Context) (int64, error)
+}
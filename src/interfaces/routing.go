@@ -0,0 +1,10 @@
+package interfaces
+
+import "payment-processor/core/models"
+
+// RoutingStrategy decides where a payment goes given the processors' state:
+// to one of them, held, or retried later.
+type RoutingStrategy interface {
+	Name() string
+	Route(payment models.Payment, state models.ProcessorState) models.RoutingDecision
+}
@@ -0,0 +1,75 @@
+package interfaces
+
+import (
+	"context"
+	"payment-processor/core/models"
+	"time"
+)
+
+// Store holds the state shared by every instance besides the queue: payment
+// statuses, the processed payments summary and its watermarks, processor
+// status, circuit breakers, webhook deliveries, leases and partition members.
+// Its operations are modelled on Redis, which implements them natively; other
+// stores emulate them. Sorted set scores of times are unix seconds.
+type Store interface {
+	Ping(ctx context.Context) error
+	Close() error
+
+	// Set stores value under key for expirationInSeconds, 5 by default.
+	Set(ctx context.Context, key string, value string, expirationInSeconds ...int) error
+	// Get returns the value under key, or "" when there is none.
+	Get(ctx context.Context, key string) (string, error)
+	Incr(ctx context.Context, key string) (int64, error)
+	// SetPublish stores value under key and publishes it on channel at once.
+	SetPublish(ctx context.Context, key, channel, value string, ttl time.Duration) error
+	// Subscribe delivers the values published on channel until ctx is done,
+	// then closes the returned channel. Values published while the
+	// subscription reconnects are lost.
+	Subscribe(ctx context.Context, channel string) <-chan string
+	// AcquireLease takes or renews the lease key for owner until ttl from now
+	// and reports whether owner holds it.
+	AcquireLease(ctx context.Context, key, owner string, ttl time.Duration) (bool, error)
+
+	// HUpdate sets and increments fields of the hash at key and, when ttl is
+	// positive, refreshes its expiry.
+	HUpdate(ctx context.Context, key string, values map[string]interface{}, increments map[string]int64, ttl time.Duration) error
+	HUpdateMany(ctx context.Context, updates []models.HashUpdate, ttl time.Duration) error
+	HGetAll(ctx context.Context, key string) (map[string]string, error)
+
+	// LPushTrim prepends value to the list at key, keeps its first maxLen
+	// values and refreshes its expiry.
+	LPushTrim(ctx context.Context, key string, value string, maxLen int64, ttl time.Duration) error
+	LRange(ctx context.Context, key string, start, stop int64) ([]string, error)
+
+	ZAdd(ctx context.Context, key string, score float64, member string) error
+	// ZRangeByScore returns the members scored from min to max, inclusive, by
+	// ascending score.
+	ZRangeByScore(ctx context.Context, key string, min, max time.Time) ([]string, error)
+	ZRem(ctx context.Context, key string, members ...string) error
+	// ZRemRangeBefore removes the members scored before before and returns
+	// how many it removed.
+	ZRemRangeBefore(ctx context.Context, key string, before time.Time) (int64, error)
+	// ZClaimDue claims up to count members scored at or before now. Claimed
+	// members become due again after lease unless the claimer removes or
+	// reschedules them first.
+	ZClaimDue(ctx context.Context, key string, now time.Time, lease time.Duration, count int64) ([]string, error)
+	// ZHeartbeat scores member with now, drops members not seen within ttl
+	// and returns the remaining ones.
+	ZHeartbeat(ctx context.Context, key, member string, now time.Time, ttl time.Duration) ([]string, error)
+	// ZCompact folds processed payments scored before the given time into one
+	// member per second and processor, resuming from watermarkKey, and
+	// returns how many members were folded.
+	ZCompact(ctx context.Context, key, watermarkKey string, before time.Time, limit int64) (int64, error)
+
+	// PurgeSet deletes the sorted set together with keys and returns how many
+	// members the set held and how many of keys existed.
+	PurgeSet(ctx context.Context, set string, keys ...string) (int64, int64, error)
+	// DeleteByPattern deletes every key matching the glob pattern and returns
+	// how many it deleted.
+	DeleteByPattern(ctx context.Context, pattern string) (int64, error)
+	// Trim releases storage held by expired keys. Redis expires keys itself.
+	Trim(ctx context.Context) error
+	// MemoryUsage returns the bytes used and the memory limit, 0 when the
+	// store has none.
+	MemoryUsage(ctx context.Context) (int64, int64, error)
+}
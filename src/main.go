@@ -2,64 +2,150 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log"
+	"net"
 	"net/http"
+	"os/signal"
 	"payment-processor/config"
 	"payment-processor/core/services"
 	"payment-processor/infrastructure"
 	"payment-processor/infrastructure/migrations"
+	"payment-processor/infrastructure/queues"
 	"payment-processor/infrastructure/repositories"
 	"payment-processor/routes"
+	"payment-processor/rpc"
 	usecases "payment-processor/use_cases"
 	"payment-processor/workers"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+// shutdownTimeout bounds how long in-flight requests get to finish once a
+// shutdown signal arrives.
+const shutdownTimeout = 10 * time.Second
+
 func main() {
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 	config := config.LoadConfig()
-	redis := infrastructure.NewRedis()
-	conn := infrastructure.NewPostgresConnection()
-	queueUseCase := usecases.NewQueuePaymentsUseCase(redis)
+	db := infrastructure.OpenDatabase()
+	migrations.CreateRinhaTable(db)
+	if config.QueueBackend == "postgres" {
+		migrations.CreateQueueTables(db)
+		migrations.CreateStoreTables(db)
+	}
+	store := infrastructure.NewStore(db)
+	conn := infrastructure.NewPostgresConnection(db)
+	queue := queues.NewQueue(store, db)
+	paymentStatusUseCase := usecases.NewPaymentStatusUseCase(store)
+	queueUseCase := usecases.NewQueuePaymentsUseCase(store, queue, paymentStatusUseCase)
 	paymentRepository := repositories.NewPaymentRepository(conn)
 	processPaymentService := services.NewProcessPaymentService(queueUseCase)
-	queuePaymentUseCase := usecases.NewQueuePaymentsUseCase(redis)
-	getPaymentUseCase := usecases.NewGetPaymentsSummaryUseCase(redis)
+	queuePaymentUseCase := usecases.NewQueuePaymentsUseCase(store, queue, paymentStatusUseCase)
+	getPaymentUseCase := usecases.NewGetPaymentsSummaryUseCase(store)
+	webhookUseCase := usecases.NewWebhookUseCase(store)
+	deadLetterUseCase := usecases.NewDeadLetterUseCase(queue, paymentStatusUseCase)
 
+	routing, err := usecases.NewRoutingStrategy(config.RoutingStrategy)
+	if err != nil {
+		log.Fatal("Invalid ROUTING_STRATEGY:", err)
+	}
 	streamWorkerPool := workers.NewStreamWorkerPool(
-		*redis,
-		config.Queue,
-		"payment-group",
-		12,
+		store,
+		queue,
+		routing,
+		config.WorkersMin,
+		config.WorkersMax,
 		*processPaymentService,
 		*queuePaymentUseCase,
+		*paymentStatusUseCase,
+		webhookUseCase,
+		deadLetterUseCase,
 	)
-	if err := streamWorkerPool.Start(ctx); err != nil {
+	// Workers and the dispatcher are ended by Stop, not by the signal, so
+	// calls in flight at shutdown finish and get recorded.
+	workerCtx := context.WithoutCancel(ctx)
+	if err := streamWorkerPool.Start(workerCtx); err != nil {
 		log.Fatal("Failed to start stream worker pool:", err)
 	}
-	defer streamWorkerPool.Stop()
 
-	log.Println("Starting Rinha de Backend 2025...")
-	migrations.CreateRinhaTable()
+	var webhookDispatcher *workers.WebhookDispatcher
+	if config.Webhooks.Enabled() {
+		webhookDispatcher = workers.NewWebhookDispatcher(webhookUseCase, services.NewWebhookService())
+		webhookDispatcher.Start(workerCtx)
+	} else {
+		log.Println("WEBHOOK_SECRET is not set, completion webhooks are disabled")
+	}
 
-	defer redis.Close()
+	log.Println("Starting Rinha de Backend 2025...")
 
 	processPaymentUseCase := usecases.NewProcessPaymentUseCase(
 		*paymentRepository,
 		*getPaymentUseCase,
-		*redis,
+		store,
 	)
 	if config.ShouldPersistInDB {
 		go processPaymentUseCase.Execute(ctx)
 	}
+	go queuePaymentUseCase.ReplaySpool(ctx)
+	go queuePaymentUseCase.ReleaseRetries(ctx)
+	go usecases.NewRetentionUseCase(store, queue).Execute(ctx)
+	go usecases.GetMemoryPressure().Watch(ctx, store)
+	go usecases.GetProcessorStatus().Watch(ctx, store)
+	go usecases.GetCircuitBreakers().Watch(ctx, store)
+	go usecases.GetAdmission().Watch(ctx, queue)
+	// Watch leaves the partition members on shutdown, so the store stays open
+	// until it is done.
+	assignmentDone := make(chan struct{})
+	go func() {
+		defer close(assignmentDone)
+		queues.GetPartitionAssignment().Watch(ctx, store)
+	}()
+
+	grpcListener, err := net.Listen("tcp", ":"+config.GRPCPort)
+	if err != nil {
+		log.Fatal("Failed to listen for gRPC:", err)
+	}
+	grpcServer := rpc.NewServer(rpc.NewPaymentService(queuePaymentUseCase, getPaymentUseCase, paymentStatusUseCase))
+	go func() {
+		if err := grpcServer.Serve(grpcListener); err != nil {
+			log.Println("gRPC server stopped:", err)
+			stop()
+		}
+	}()
 
 	router := gin.Default()
 	router.Use(corsMiddleware())
-	routes.RegisterprocessPaymentRoutes(router)
+	routes.RegisterprocessPaymentRoutes(router, store, queue)
+	routes.RegisterAdminRoutes(router, store, queue, conn)
+
+	server := &http.Server{Addr: ":8080", Handler: router}
+	go func() {
+		if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			log.Println("HTTP server stopped:", err)
+			stop()
+		}
+	}()
 
-	router.Run(":8080")
+	<-ctx.Done()
+	log.Println("Shutting down...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Println("HTTP server did not shut down cleanly:", err)
+	}
+	grpcServer.GracefulStop()
+	streamWorkerPool.Stop()
+	if webhookDispatcher != nil {
+		webhookDispatcher.Stop()
+	}
+	<-assignmentDone
+	store.Close()
+	db.Close()
+	log.Println("Shutdown complete")
 }
 
 func corsMiddleware() gin.HandlerFunc {
@@ -0,0 +1,32 @@
+package protocol
+
+import "fmt"
+
+// Codec is the gRPC codec for the hand-encoded messages of this package. It
+// registers as "proto", so standard protobuf clients generated from
+// payments.proto talk to it unchanged.
+type Codec struct{}
+
+type protoUnmarshaler interface {
+	UnmarshalProto([]byte) error
+}
+
+func (Codec) Marshal(v interface{}) ([]byte, error) {
+	message, ok := v.(protoMessage)
+	if !ok {
+		return nil, fmt.Errorf("protocol: cannot marshal %T", v)
+	}
+	return message.MarshalProto()
+}
+
+func (Codec) Unmarshal(data []byte, v interface{}) error {
+	message, ok := v.(protoUnmarshaler)
+	if !ok {
+		return fmt.Errorf("protocol: cannot unmarshal into %T", v)
+	}
+	return message.UnmarshalProto(data)
+}
+
+func (Codec) Name() string {
+	return "proto"
+}
@@ -0,0 +1,70 @@
+package protocol
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/ugorji/go/codec"
+)
+
+var msgpackHandle = func() *codec.MsgpackHandle {
+	h := &codec.MsgpackHandle{}
+	h.WriteExt = true
+	h.RawToString = true
+	return h
+}()
+
+// MsgpackPaymentRequest mirrors the JSON request; Amount is left untyped
+// because MessagePack clients send it as float, int or string.
+type MsgpackPaymentRequest struct {
+	CorrelationID string      `codec:"correlationId"`
+	Amount        interface{} `codec:"amount"`
+	CallbackURL   string      `codec:"callbackUrl"`
+	Priority      string      `codec:"priority"`
+}
+
+// MsgpackSummaryItem carries TotalAmount as decimal text with two decimal
+// places, e.g. "231437.00", so totals stay exact on the wire.
+type MsgpackSummaryItem struct {
+	TotalRequests int64  `codec:"totalRequests"`
+	TotalAmount   string `codec:"totalAmount"`
+}
+
+// MsgpackPaymentsSummary maps every registered processor to its totals, the
+// same shape as the JSON summary.
+type MsgpackPaymentsSummary map[string]*MsgpackSummaryItem
+
+func DecodeMsgpack(r io.Reader, v interface{}) error {
+	if err := codec.NewDecoder(r, msgpackHandle).Decode(v); err != nil {
+		return fmt.Errorf("malformed msgpack message: %w", err)
+	}
+	return nil
+}
+
+func EncodeMsgpack(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := codec.NewEncoder(&buf, msgpackHandle).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// AmountString renders a MessagePack amount as the decimal text the Money
+// parser accepts; floats use the shortest representation that round-trips.
+func (r *MsgpackPaymentRequest) AmountString() (string, error) {
+	switch v := r.Amount.(type) {
+	case string:
+		return v, nil
+	case float64:
+		return fmt.Sprint(v), nil
+	case float32:
+		return fmt.Sprint(v), nil
+	case int64:
+		return fmt.Sprint(v), nil
+	case uint64:
+		return fmt.Sprint(v), nil
+	default:
+		return "", fmt.Errorf("unsupported amount type %T", r.Amount)
+	}
+}
@@ -0,0 +1,246 @@
+// Package protocol holds the binary wire formats of the payment API. The
+// protobuf messages mirror payments.proto and are encoded by hand with
+// protowire, so no generated code or protoc toolchain is needed.
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeMsgpack  = "application/msgpack"
+	ContentTypeProtobuf = "application/x-protobuf"
+)
+
+var ErrMalformedMessage = errors.New("malformed protobuf message")
+
+type PaymentRequest struct {
+	CorrelationID string
+	AmountCents   int64
+	CallbackURL   string
+	Priority      string
+}
+
+type SummaryItem struct {
+	TotalRequests    int64
+	TotalAmountCents int64
+}
+
+// PaymentsSummary keeps the default and fallback fields for existing
+// clients; Processors holds every registered processor, those two included.
+type PaymentsSummary struct {
+	DefaultProcessor  *SummaryItem
+	FallbackProcessor *SummaryItem
+	Processors        map[string]*SummaryItem
+}
+
+// summaryEntry is one entry of the PaymentsSummary.processors map, which
+// protobuf encodes as a message with the key and value as fields 1 and 2.
+type summaryEntry struct {
+	Name string
+	Item *SummaryItem
+}
+
+func (m *PaymentRequest) MarshalProto() ([]byte, error) {
+	var b []byte
+	b = appendString(b, 1, m.CorrelationID)
+	b = appendInt64(b, 2, m.AmountCents)
+	b = appendString(b, 3, m.CallbackURL)
+	b = appendString(b, 4, m.Priority)
+	return b, nil
+}
+
+func (m *PaymentRequest) UnmarshalProto(b []byte) error {
+	*m = PaymentRequest{}
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			m.CorrelationID = v
+			return n, nil
+		case num == 2 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			m.AmountCents = int64(v)
+			return n, nil
+		case num == 3 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			m.CallbackURL = v
+			return n, nil
+		case num == 4 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			m.Priority = v
+			return n, nil
+		}
+		return protowire.ConsumeFieldValue(num, typ, b), nil
+	})
+}
+
+func (m *SummaryItem) MarshalProto() ([]byte, error) {
+	var b []byte
+	b = appendInt64(b, 1, m.TotalRequests)
+	b = appendInt64(b, 2, m.TotalAmountCents)
+	return b, nil
+}
+
+func (m *SummaryItem) UnmarshalProto(b []byte) error {
+	*m = SummaryItem{}
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		if typ != protowire.VarintType || (num != 1 && num != 2) {
+			return protowire.ConsumeFieldValue(num, typ, b), nil
+		}
+		v, n := protowire.ConsumeVarint(b)
+		if num == 1 {
+			m.TotalRequests = int64(v)
+		} else {
+			m.TotalAmountCents = int64(v)
+		}
+		return n, nil
+	})
+}
+
+func (m *PaymentsSummary) MarshalProto() ([]byte, error) {
+	var (
+		b   []byte
+		err error
+	)
+	if m.DefaultProcessor != nil {
+		if b, err = appendMessage(b, 1, m.DefaultProcessor); err != nil {
+			return nil, err
+		}
+	}
+	if m.FallbackProcessor != nil {
+		if b, err = appendMessage(b, 2, m.FallbackProcessor); err != nil {
+			return nil, err
+		}
+	}
+	names := make([]string, 0, len(m.Processors))
+	for name := range m.Processors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if b, err = appendMessage(b, 3, &summaryEntry{Name: name, Item: m.Processors[name]}); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func (m *PaymentsSummary) UnmarshalProto(b []byte) error {
+	*m = PaymentsSummary{}
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		if typ != protowire.BytesType || num < 1 || num > 3 {
+			return protowire.ConsumeFieldValue(num, typ, b), nil
+		}
+		v, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return n, nil
+		}
+		if num == 3 {
+			entry := &summaryEntry{}
+			if err := entry.UnmarshalProto(v); err != nil {
+				return 0, err
+			}
+			if m.Processors == nil {
+				m.Processors = make(map[string]*SummaryItem)
+			}
+			m.Processors[entry.Name] = entry.Item
+			return n, nil
+		}
+		item := &SummaryItem{}
+		if err := item.UnmarshalProto(v); err != nil {
+			return 0, err
+		}
+		if num == 1 {
+			m.DefaultProcessor = item
+		} else {
+			m.FallbackProcessor = item
+		}
+		return n, nil
+	})
+}
+
+func (m *summaryEntry) MarshalProto() ([]byte, error) {
+	b := protowire.AppendTag(nil, 1, protowire.BytesType)
+	b = protowire.AppendString(b, m.Name)
+	if m.Item == nil {
+		return b, nil
+	}
+	return appendMessage(b, 2, m.Item)
+}
+
+func (m *summaryEntry) UnmarshalProto(b []byte) error {
+	*m = summaryEntry{Item: &SummaryItem{}}
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			m.Name = v
+			return n, nil
+		case num == 2 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return n, nil
+			}
+			return n, m.Item.UnmarshalProto(v)
+		}
+		return protowire.ConsumeFieldValue(num, typ, b), nil
+	})
+}
+
+type protoMessage interface {
+	MarshalProto() ([]byte, error)
+}
+
+func appendString(b []byte, num protowire.Number, v string) []byte {
+	if v == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, v)
+}
+
+func appendInt64(b []byte, num protowire.Number, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(v))
+}
+
+func appendMessage(b []byte, num protowire.Number, m protoMessage) ([]byte, error) {
+	v, err := m.MarshalProto()
+	if err != nil {
+		return nil, err
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v), nil
+}
+
+// consumeFields walks the fields of a message. field decodes (or skips) the
+// value of one field and returns how many bytes it consumed, negative on
+// malformed input as protowire does.
+func consumeFields(b []byte, field func(protowire.Number, protowire.Type, []byte) (int, error)) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return fmt.Errorf("%w: %v", ErrMalformedMessage, protowire.ParseError(n))
+		}
+		b = b[n:]
+
+		n, err := field(num, typ, b)
+		if err != nil {
+			return err
+		}
+		if n < 0 {
+			return fmt.Errorf("%w: %v", ErrMalformedMessage, protowire.ParseError(n))
+		}
+		b = b[n:]
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package protocol
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bufbuild/protocompile"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// schema compiles the published payments.proto, so the hand-written codecs
+// are checked against what generated code would put on the wire.
+func schema(t *testing.T) protoreflect.FileDescriptor {
+	t.Helper()
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{}),
+	}
+	files, err := compiler.Compile(context.Background(), "payments.proto")
+	if err != nil {
+		t.Fatalf("compile payments.proto: %v", err)
+	}
+	return files[0]
+}
+
+type codecMessage interface {
+	MarshalProto() ([]byte, error)
+	UnmarshalProto([]byte) error
+}
+
+func TestCodecsMatchSchema(t *testing.T) {
+	file := schema(t)
+	tests := []struct {
+		message string
+		json    string
+		codec   func() codecMessage
+	}{
+		{"PaymentRequest", `{"correlationId": "4a7e2c1e-3f0e-4bd6-9c8e-1b2d3c4d5e6f", "amountCents": "1990", "callbackUrl": "https://example.com/hook", "priority": "high"}`, func() codecMessage { return &PaymentRequest{} }},
+		{"PaymentRequest", `{"correlationId": "4a7e2c1e-3f0e-4bd6-9c8e-1b2d3c4d5e6f", "amountCents": "-5"}`, func() codecMessage { return &PaymentRequest{} }},
+		{"SummaryItem", `{"totalRequests": "11630", "totalAmountCents": "23143700"}`, func() codecMessage { return &SummaryItem{} }},
+		{"PaymentsSummary", `{
+			"defaultProcessor": {"totalRequests": "2", "totalAmountCents": "300"},
+			"fallbackProcessor": {},
+			"processors": {
+				"default": {"totalRequests": "2", "totalAmountCents": "300"},
+				"fallback": {},
+				"backup": {"totalRequests": "1", "totalAmountCents": "5"}
+			}
+		}`, func() codecMessage { return &PaymentsSummary{} }},
+		{"SubmitPaymentResponse", `{"correlationId": "4a7e2c1e-3f0e-4bd6-9c8e-1b2d3c4d5e6f", "result": "duplicate"}`, func() codecMessage { return &SubmitPaymentResponse{} }},
+		{"SubmitPaymentsResponse", `{
+			"accepted": "1", "duplicate": "1", "rejected": "1",
+			"results": [
+				{"index": "0", "correlationId": "a", "status": "accepted"},
+				{"index": "1", "correlationId": "b", "status": "duplicate"},
+				{"index": "2", "status": "invalid", "reason": "amount must be greater than zero"}
+			]
+		}`, func() codecMessage { return &SubmitPaymentsResponse{} }},
+		{"GetPaymentRequest", `{"correlationId": "4a7e2c1e-3f0e-4bd6-9c8e-1b2d3c4d5e6f"}`, func() codecMessage { return &GetPaymentRequest{} }},
+		{"PaymentStatus", `{
+			"correlationId": "4a7e2c1e-3f0e-4bd6-9c8e-1b2d3c4d5e6f", "amountCents": "10050",
+			"requestedAt": "2025-07-15T12:34:56Z", "state": "processed-by-default",
+			"processor": "default", "attempts": "2", "lastError": "timeout",
+			"createdAt": "2025-07-15T12:34:56.101Z", "updatedAt": "2025-07-15T12:34:56.342Z",
+			"transitions": {"queued": "2025-07-15T12:34:56.101Z", "processed-by-default": "2025-07-15T12:34:56.342Z"}
+		}`, func() codecMessage { return &PaymentStatus{} }},
+		{"GetSummaryRequest", `{"from": "2025-07-15T12:34:56Z", "to": "2025-07-15T12:35:56Z"}`, func() codecMessage { return &GetSummaryRequest{} }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.message, func(t *testing.T) {
+			descriptor := file.Messages().ByName(protoreflect.Name(tt.message))
+			if descriptor == nil {
+				t.Fatalf("payments.proto has no message %s", tt.message)
+			}
+			want := dynamicpb.NewMessage(descriptor)
+			if err := protojson.Unmarshal([]byte(tt.json), want); err != nil {
+				t.Fatalf("build %s: %v", tt.message, err)
+			}
+			wire, err := proto.MarshalOptions{Deterministic: true}.Marshal(want)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			decoded := tt.codec()
+			if err := decoded.UnmarshalProto(wire); err != nil {
+				t.Fatalf("UnmarshalProto: %v", err)
+			}
+			encoded, err := decoded.MarshalProto()
+			if err != nil {
+				t.Fatalf("MarshalProto: %v", err)
+			}
+
+			got := dynamicpb.NewMessage(descriptor)
+			if err := proto.Unmarshal(encoded, got); err != nil {
+				t.Fatalf("schema cannot decode MarshalProto output: %v", err)
+			}
+			if !proto.Equal(got, want) {
+				t.Errorf("round trip through the codec changed the message\n got: %v\nwant: %v", got, want)
+			}
+		})
+	}
+}
+
+func TestUnmarshalSkipsUnknownFields(t *testing.T) {
+	request := &PaymentRequest{CorrelationID: "4a7e2c1e-3f0e-4bd6-9c8e-1b2d3c4d5e6f", AmountCents: 1990, Priority: "low"}
+	wire, err := request.MarshalProto()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Fields a newer schema could add, of every wire type, around the known
+	// ones.
+	unknown := protowire.AppendTag(nil, 90, protowire.VarintType)
+	unknown = protowire.AppendVarint(unknown, 1<<40)
+	unknown = protowire.AppendTag(unknown, 91, protowire.BytesType)
+	unknown = protowire.AppendBytes(unknown, []byte("future"))
+	unknown = protowire.AppendTag(unknown, 92, protowire.Fixed32Type)
+	unknown = protowire.AppendFixed32(unknown, 7)
+	unknown = protowire.AppendTag(unknown, 93, protowire.Fixed64Type)
+	unknown = protowire.AppendFixed64(unknown, 7)
+	// A known field number with an unexpected wire type is skipped too.
+	mistyped := protowire.AppendTag(nil, 2, protowire.BytesType)
+	mistyped = protowire.AppendBytes(mistyped, []byte("not a varint"))
+	wire = append(append(append(mistyped, unknown...), wire...), unknown...)
+
+	var got PaymentRequest
+	if err := got.UnmarshalProto(wire); err != nil {
+		t.Fatalf("UnmarshalProto: %v", err)
+	}
+	if got != *request {
+		t.Errorf("got %+v, want %+v", got, *request)
+	}
+
+	summary := &PaymentsSummary{Processors: map[string]*SummaryItem{"backup": {TotalRequests: 1, TotalAmountCents: 5}}}
+	summaryWire, err := summary.MarshalProto()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded PaymentsSummary
+	if err := decoded.UnmarshalProto(append(unknown, summaryWire...)); err != nil {
+		t.Fatalf("UnmarshalProto: %v", err)
+	}
+	if item := decoded.Processors["backup"]; item == nil || *item != (SummaryItem{TotalRequests: 1, TotalAmountCents: 5}) {
+		t.Errorf("got processors %v", decoded.Processors)
+	}
+}
+
+func TestUnmarshalRejectsTruncatedMessages(t *testing.T) {
+	request := &PaymentRequest{CorrelationID: "4a7e2c1e-3f0e-4bd6-9c8e-1b2d3c4d5e6f", AmountCents: 1990}
+	wire, err := request.MarshalProto()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got PaymentRequest
+	if err := got.UnmarshalProto(wire[:len(wire)-1]); err == nil {
+		t.Error("UnmarshalProto accepted a truncated message")
+	}
+}
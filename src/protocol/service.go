@@ -0,0 +1,226 @@
+package protocol
+
+import (
+	"sort"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type SubmitPaymentResponse struct {
+	CorrelationID string
+	Result        string
+}
+
+type SubmitPaymentResult struct {
+	Index         int64
+	CorrelationID string
+	Status        string
+	Reason        string
+}
+
+type SubmitPaymentsResponse struct {
+	Accepted  int64
+	Duplicate int64
+	Rejected  int64
+	Results   []*SubmitPaymentResult
+}
+
+type GetPaymentRequest struct {
+	CorrelationID string
+}
+
+type PaymentStatus struct {
+	CorrelationID string
+	AmountCents   int64
+	RequestedAt   string
+	State         string
+	Processor     string
+	Attempts      int64
+	LastError     string
+	CreatedAt     string
+	UpdatedAt     string
+	Transitions   map[string]string
+}
+
+type GetSummaryRequest struct {
+	From string
+	To   string
+}
+
+func (m *SubmitPaymentResponse) MarshalProto() ([]byte, error) {
+	var b []byte
+	b = appendString(b, 1, m.CorrelationID)
+	b = appendString(b, 2, m.Result)
+	return b, nil
+}
+
+func (m *SubmitPaymentResponse) UnmarshalProto(b []byte) error {
+	*m = SubmitPaymentResponse{}
+	return consumeFields(b, scalarFields(map[protowire.Number]*string{
+		1: &m.CorrelationID,
+		2: &m.Result,
+	}, nil))
+}
+
+func (m *SubmitPaymentResult) MarshalProto() ([]byte, error) {
+	var b []byte
+	b = appendInt64(b, 1, m.Index)
+	b = appendString(b, 2, m.CorrelationID)
+	b = appendString(b, 3, m.Status)
+	b = appendString(b, 4, m.Reason)
+	return b, nil
+}
+
+func (m *SubmitPaymentResult) UnmarshalProto(b []byte) error {
+	*m = SubmitPaymentResult{}
+	return consumeFields(b, scalarFields(map[protowire.Number]*string{
+		2: &m.CorrelationID,
+		3: &m.Status,
+		4: &m.Reason,
+	}, map[protowire.Number]*int64{
+		1: &m.Index,
+	}))
+}
+
+func (m *SubmitPaymentsResponse) MarshalProto() ([]byte, error) {
+	var b []byte
+	b = appendInt64(b, 1, m.Accepted)
+	b = appendInt64(b, 2, m.Duplicate)
+	b = appendInt64(b, 3, m.Rejected)
+	for _, result := range m.Results {
+		var err error
+		if b, err = appendMessage(b, 4, result); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func (m *SubmitPaymentsResponse) UnmarshalProto(b []byte) error {
+	*m = SubmitPaymentsResponse{}
+	ints := scalarFields(nil, map[protowire.Number]*int64{
+		1: &m.Accepted,
+		2: &m.Duplicate,
+		3: &m.Rejected,
+	})
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		if num != 4 || typ != protowire.BytesType {
+			return ints(num, typ, b)
+		}
+		v, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return n, nil
+		}
+		result := &SubmitPaymentResult{}
+		if err := result.UnmarshalProto(v); err != nil {
+			return 0, err
+		}
+		m.Results = append(m.Results, result)
+		return n, nil
+	})
+}
+
+func (m *GetPaymentRequest) MarshalProto() ([]byte, error) {
+	return appendString(nil, 1, m.CorrelationID), nil
+}
+
+func (m *GetPaymentRequest) UnmarshalProto(b []byte) error {
+	*m = GetPaymentRequest{}
+	return consumeFields(b, scalarFields(map[protowire.Number]*string{
+		1: &m.CorrelationID,
+	}, nil))
+}
+
+func (m *PaymentStatus) MarshalProto() ([]byte, error) {
+	var b []byte
+	b = appendString(b, 1, m.CorrelationID)
+	b = appendInt64(b, 2, m.AmountCents)
+	b = appendString(b, 3, m.RequestedAt)
+	b = appendString(b, 4, m.State)
+	b = appendString(b, 5, m.Processor)
+	b = appendInt64(b, 6, m.Attempts)
+	b = appendString(b, 7, m.LastError)
+	b = appendString(b, 8, m.CreatedAt)
+	b = appendString(b, 9, m.UpdatedAt)
+
+	// Map entries are encoded as repeated key/value messages; sort the keys
+	// so the output is deterministic.
+	keys := make([]string, 0, len(m.Transitions))
+	for key := range m.Transitions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		var entry []byte
+		entry = appendString(entry, 1, key)
+		entry = appendString(entry, 2, m.Transitions[key])
+		b = protowire.AppendTag(b, 10, protowire.BytesType)
+		b = protowire.AppendBytes(b, entry)
+	}
+	return b, nil
+}
+
+func (m *PaymentStatus) UnmarshalProto(b []byte) error {
+	*m = PaymentStatus{Transitions: map[string]string{}}
+	scalars := scalarFields(map[protowire.Number]*string{
+		1: &m.CorrelationID,
+		3: &m.RequestedAt,
+		4: &m.State,
+		5: &m.Processor,
+		7: &m.LastError,
+		8: &m.CreatedAt,
+		9: &m.UpdatedAt,
+	}, map[protowire.Number]*int64{
+		2: &m.AmountCents,
+		6: &m.Attempts,
+	})
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		if num != 10 || typ != protowire.BytesType {
+			return scalars(num, typ, b)
+		}
+		v, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return n, nil
+		}
+		var key, value string
+		err := consumeFields(v, scalarFields(map[protowire.Number]*string{1: &key, 2: &value}, nil))
+		if err != nil {
+			return 0, err
+		}
+		m.Transitions[key] = value
+		return n, nil
+	})
+}
+
+func (m *GetSummaryRequest) MarshalProto() ([]byte, error) {
+	var b []byte
+	b = appendString(b, 1, m.From)
+	b = appendString(b, 2, m.To)
+	return b, nil
+}
+
+func (m *GetSummaryRequest) UnmarshalProto(b []byte) error {
+	*m = GetSummaryRequest{}
+	return consumeFields(b, scalarFields(map[protowire.Number]*string{
+		1: &m.From,
+		2: &m.To,
+	}, nil))
+}
+
+// scalarFields builds a consumeFields callback for messages made only of
+// string and int64 scalars, skipping every other field.
+func scalarFields(strings map[protowire.Number]*string, ints map[protowire.Number]*int64) func(protowire.Number, protowire.Type, []byte) (int, error) {
+	return func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		if target, ok := strings[num]; ok && typ == protowire.BytesType {
+			v, n := protowire.ConsumeString(b)
+			*target = v
+			return n, nil
+		}
+		if target, ok := ints[num]; ok && typ == protowire.VarintType {
+			v, n := protowire.ConsumeVarint(b)
+			*target = int64(v)
+			return n, nil
+		}
+		return protowire.ConsumeFieldValue(num, typ, b), nil
+	}
+}
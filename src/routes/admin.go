@@ -0,0 +1,53 @@
+package routes
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"payment-processor/config"
+	"payment-processor/controllers"
+	"payment-processor/infrastructure/composite"
+	"payment-processor/interfaces"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterAdminRoutes registers the admin endpoints, or none at all when
+// ADMIN_TOKEN is unset, so no deployment exposes them behind a known token.
+func RegisterAdminRoutes(router *gin.Engine, store interfaces.Store, queue interfaces.Queue, conn interfaces.DatabaseConnection) {
+	if config.LoadConfig().AdminToken == "" {
+		log.Println("ADMIN_TOKEN is not set, admin endpoints are disabled")
+		return
+	}
+	group := router.Group("/", adminTokenMiddleware())
+	adminController := composite.AdminComposer(store, queue, conn)
+
+	group.POST("/purge-payments", adminController.PurgePayments)
+	group.GET("/intake-metrics", adminController.GetIntakeMetrics)
+	group.GET("/processor-status", adminController.GetProcessorStatus)
+	group.GET("/circuit-breakers", adminController.GetCircuitBreakers)
+	group.GET("/workers", adminController.GetWorkers)
+	group.GET("/webhooks/:correlationId", adminController.GetWebhook)
+	group.POST("/webhooks/:correlationId/resend", adminController.ResendWebhook)
+	group.GET("/dead-letters", adminController.ListDeadLetters)
+	group.GET("/dead-letters/:id", adminController.GetDeadLetter)
+	group.POST("/dead-letters/:id/replay", adminController.ReplayDeadLetter)
+	group.DELETE("/dead-letters/:id", adminController.DiscardDeadLetter)
+}
+
+// adminTokenMiddleware rejects requests whose X-Rinha-Token header does not
+// match the configured admin token, mirroring the payment processors' admin API.
+func adminTokenMiddleware() gin.HandlerFunc {
+	token := []byte(config.LoadConfig().AdminToken)
+	return func(c *gin.Context) {
+		provided := []byte(c.GetHeader("X-Rinha-Token"))
+		if len(token) == 0 || subtle.ConstantTimeCompare(provided, token) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, controllers.ErrorResponse{
+				Error:   "Unauthorized",
+				Message: "Missing or invalid X-Rinha-Token header",
+			})
+			return
+		}
+		c.Next()
+	}
+}
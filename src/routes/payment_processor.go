@@ -2,14 +2,17 @@ package routes
 
 import (
 	"payment-processor/infrastructure/composite"
+	"payment-processor/interfaces"
 
 	"github.com/gin-gonic/gin"
 )
 
-func RegisterprocessPaymentRoutes(router *gin.Engine) {
+func RegisterprocessPaymentRoutes(router *gin.Engine, store interfaces.Store, queue interfaces.Queue) {
 	group := router.Group("/")
-	defaultPaymentController := composite.ProcessDefaultPaymentComposer()
+	defaultPaymentController := composite.ProcessDefaultPaymentComposer(store, queue)
 
 	group.POST("/payments", defaultPaymentController.EnqueuePayment)
+	group.POST("/payments/batch", defaultPaymentController.EnqueuePayments)
+	group.GET("/payments/:correlationId", defaultPaymentController.GetPayment)
 	group.GET("/payments-summary", defaultPaymentController.GetPaymentsSummary)
 }
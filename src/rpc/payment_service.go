@@ -0,0 +1,291 @@
+// Package rpc serves the PaymentService described in protocol/payments.proto
+// over gRPC, backed by the same use cases as the HTTP API.
+package rpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"payment-processor/config"
+	"payment-processor/core/models"
+	"payment-processor/protocol"
+	usecases "payment-processor/use_cases"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const serviceName = "rinha.payments.v1.PaymentService"
+
+type PaymentServiceServer interface {
+	SubmitPayment(context.Context, *protocol.PaymentRequest) (*protocol.SubmitPaymentResponse, error)
+	SubmitPayments(grpc.ServerStream) error
+	GetPayment(context.Context, *protocol.GetPaymentRequest) (*protocol.PaymentStatus, error)
+	GetSummary(context.Context, *protocol.GetSummaryRequest) (*protocol.PaymentsSummary, error)
+}
+
+type PaymentService struct {
+	QueuePaymentsUseCase      *usecases.QueuePaymentsUseCase
+	GetPaymentsSummaryUseCase *usecases.GetPaymentsSummaryUseCase
+	PaymentStatusUseCase      *usecases.PaymentStatusUseCase
+}
+
+func NewPaymentService(
+	queuePaymentsUseCase *usecases.QueuePaymentsUseCase,
+	getPaymentsSummaryUseCase *usecases.GetPaymentsSummaryUseCase,
+	paymentStatusUseCase *usecases.PaymentStatusUseCase,
+) *PaymentService {
+	return &PaymentService{
+		QueuePaymentsUseCase:      queuePaymentsUseCase,
+		GetPaymentsSummaryUseCase: getPaymentsSummaryUseCase,
+		PaymentStatusUseCase:      paymentStatusUseCase,
+	}
+}
+
+// NewServer returns a gRPC server exposing service. Messages are encoded with
+// protocol.Codec, which is wire compatible with generated protobuf clients.
+func NewServer(service PaymentServiceServer) *grpc.Server {
+	server := grpc.NewServer(grpc.ForceServerCodec(protocol.Codec{}))
+	server.RegisterService(&paymentServiceDesc, service)
+	return server
+}
+
+func (s *PaymentService) SubmitPayment(ctx context.Context, req *protocol.PaymentRequest) (*protocol.SubmitPaymentResponse, error) {
+	result, err := s.QueuePaymentsUseCase.EnqueuePayment(ctx, toPayment(req, now()))
+	if err != nil {
+		return nil, intakeStatus(err)
+	}
+	return &protocol.SubmitPaymentResponse{
+		CorrelationID: req.CorrelationID,
+		Result:        string(result),
+	}, nil
+}
+
+// SubmitPayments enqueues the streamed payments in pipelined batches of
+// BatchMaxItems as they arrive, so only one batch is held in memory. A stream
+// of more than GRPCStreamMaxItems payments is cut off with RESOURCE_EXHAUSTED
+// once the payments before it were enqueued.
+func (s *PaymentService) SubmitPayments(stream grpc.ServerStream) error {
+	config := config.LoadConfig()
+	requestedAt := now()
+
+	response := &protocol.SubmitPaymentsResponse{}
+	payments := make([]models.Payment, 0, config.BatchMaxItems)
+	received := 0
+	for {
+		req := &protocol.PaymentRequest{}
+		err := stream.RecvMsg(req)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if received == config.GRPCStreamMaxItems {
+			s.enqueueBatch(stream.Context(), response, received-len(payments), payments)
+			return status.Errorf(codes.ResourceExhausted,
+				"stream must not contain more than %d payments; the first %d were submitted, resend the rest in a new stream",
+				config.GRPCStreamMaxItems, received)
+		}
+		payments = append(payments, toPayment(req, requestedAt))
+		received++
+		if len(payments) == config.BatchMaxItems {
+			s.enqueueBatch(stream.Context(), response, received-len(payments), payments)
+			payments = payments[:0]
+		}
+	}
+	s.enqueueBatch(stream.Context(), response, received-len(payments), payments)
+	return stream.SendMsg(response)
+}
+
+// enqueueBatch enqueues payments, the stream items from offset on, and adds
+// their outcomes to response.
+func (s *PaymentService) enqueueBatch(ctx context.Context, response *protocol.SubmitPaymentsResponse, offset int, payments []models.Payment) {
+	if len(payments) == 0 {
+		return
+	}
+	results, errs := s.QueuePaymentsUseCase.EnqueuePayments(ctx, payments)
+	for i := range results {
+		outcome, reason := usecases.DescribeOutcome(results[i], errs[i])
+		switch outcome {
+		case usecases.OutcomeAccepted:
+			response.Accepted++
+		case usecases.OutcomeDuplicate:
+			response.Duplicate++
+		default:
+			response.Rejected++
+		}
+		response.Results = append(response.Results, &protocol.SubmitPaymentResult{
+			Index:         int64(offset + i),
+			CorrelationID: payments[i].CorrelationID,
+			Status:        outcome,
+			Reason:        reason,
+		})
+	}
+}
+
+func (s *PaymentService) GetPayment(ctx context.Context, req *protocol.GetPaymentRequest) (*protocol.PaymentStatus, error) {
+	paymentStatus, err := s.PaymentStatusUseCase.Get(ctx, req.CorrelationID)
+	if errors.Is(err, usecases.ErrPaymentNotFound) {
+		return nil, status.Errorf(codes.NotFound, "no payment found for correlationId %s", req.CorrelationID)
+	}
+	if err != nil {
+		log.Printf("Failed to get payment status %s: %v", req.CorrelationID, err)
+		return nil, status.Error(codes.Internal, "failed to retrieve payment status")
+	}
+
+	transitions := make(map[string]string, len(paymentStatus.Transitions))
+	for state, at := range paymentStatus.Transitions {
+		transitions[string(state)] = at
+	}
+	return &protocol.PaymentStatus{
+		CorrelationID: paymentStatus.CorrelationID,
+		AmountCents:   paymentStatus.Amount.Cents(),
+		RequestedAt:   paymentStatus.RequestedAt,
+		State:         string(paymentStatus.State),
+		Processor:     paymentStatus.Processor,
+		Attempts:      int64(paymentStatus.Attempts),
+		LastError:     paymentStatus.LastError,
+		CreatedAt:     paymentStatus.CreatedAt,
+		UpdatedAt:     paymentStatus.UpdatedAt,
+		Transitions:   transitions,
+	}, nil
+}
+
+func (s *PaymentService) GetSummary(ctx context.Context, req *protocol.GetSummaryRequest) (*protocol.PaymentsSummary, error) {
+	from, err := time.Parse(time.RFC3339, req.From)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid 'from' date format")
+	}
+	to, err := time.Parse(time.RFC3339, req.To)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid 'to' date format")
+	}
+
+	summary, err := s.GetPaymentsSummaryUseCase.Execute(ctx, from, to)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to retrieve payments summary")
+	}
+	message := &protocol.PaymentsSummary{
+		Processors: make(map[string]*protocol.SummaryItem, len(*summary)),
+	}
+	for name, item := range *summary {
+		message.Processors[name] = &protocol.SummaryItem{
+			TotalRequests:    int64(item.TotalRequests),
+			TotalAmountCents: item.TotalAmount.Cents(),
+		}
+	}
+	message.DefaultProcessor = message.Processors["default"]
+	message.FallbackProcessor = message.Processors["fallback"]
+	return message, nil
+}
+
+// intakeStatus maps intake errors to the gRPC codes documented in
+// payments.proto.
+func intakeStatus(err error) error {
+	switch {
+	case errors.Is(err, usecases.ErrInvalidPayment):
+		return status.Error(codes.InvalidArgument, errors.Unwrap(err).Error())
+	case errors.Is(err, usecases.ErrPaymentConflict):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, usecases.ErrQueueFull):
+		return status.Error(codes.ResourceExhausted, "payment queue is full, retry later")
+	case errors.Is(err, usecases.ErrIntakeThrottled):
+		return status.Error(codes.ResourceExhausted, "intake is throttled, retry later")
+	case errors.Is(err, usecases.ErrIntakeOverloaded):
+		return status.Error(codes.Unavailable, "intake is overloaded, retry later")
+	case errors.Is(err, usecases.ErrQueueUnavailable):
+		log.Printf("Failed to queue payment: %v", err)
+		return status.Error(codes.Unavailable, "payment queue is unavailable, retry later")
+	default:
+		log.Printf("Failed to queue payment: %v", err)
+		return status.Error(codes.Internal, "failed to process payment")
+	}
+}
+
+func toPayment(req *protocol.PaymentRequest, requestedAt string) models.Payment {
+	return models.Payment{
+		CorrelationID: req.CorrelationID,
+		Amount:        models.Money(req.AmountCents),
+		RequestedAt:   requestedAt,
+		CallbackURL:   req.CallbackURL,
+		Priority:      models.Priority(req.Priority),
+	}
+}
+
+func now() string {
+	return time.Now().UTC().Format(time.RFC3339)
+}
+
+var paymentServiceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*PaymentServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "SubmitPayment", Handler: submitPaymentHandler},
+		{MethodName: "GetPayment", Handler: getPaymentHandler},
+		{MethodName: "GetSummary", Handler: getSummaryHandler},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "SubmitPayments",
+			Handler:       submitPaymentsHandler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "payments.proto",
+}
+
+func submitPaymentHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	return unary(srv, ctx, dec, interceptor, "SubmitPayment", &protocol.PaymentRequest{},
+		func(server PaymentServiceServer, ctx context.Context, req interface{}) (interface{}, error) {
+			return server.SubmitPayment(ctx, req.(*protocol.PaymentRequest))
+		})
+}
+
+func getPaymentHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	return unary(srv, ctx, dec, interceptor, "GetPayment", &protocol.GetPaymentRequest{},
+		func(server PaymentServiceServer, ctx context.Context, req interface{}) (interface{}, error) {
+			return server.GetPayment(ctx, req.(*protocol.GetPaymentRequest))
+		})
+}
+
+func getSummaryHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	return unary(srv, ctx, dec, interceptor, "GetSummary", &protocol.GetSummaryRequest{},
+		func(server PaymentServiceServer, ctx context.Context, req interface{}) (interface{}, error) {
+			return server.GetSummary(ctx, req.(*protocol.GetSummaryRequest))
+		})
+}
+
+func submitPaymentsHandler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(PaymentServiceServer).SubmitPayments(stream)
+}
+
+// unary decodes the request into in and runs call through the interceptor
+// chain, the same way protoc-gen-go-grpc generated handlers do.
+func unary(
+	srv interface{},
+	ctx context.Context,
+	dec func(interface{}) error,
+	interceptor grpc.UnaryServerInterceptor,
+	method string,
+	in interface{},
+	call func(PaymentServiceServer, context.Context, interface{}) (interface{}, error),
+) (interface{}, error) {
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	server := srv.(PaymentServiceServer)
+	if interceptor == nil {
+		return call(server, ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/" + serviceName + "/" + method,
+	}
+	return interceptor(ctx, in, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return call(server, ctx, req)
+	})
+}
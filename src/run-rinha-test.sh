@@ -0,0 +1,13 @@
+#!/usr/bin/env bash
+# Purges the backend, then runs the rinha k6 test against it. The test's own
+# reset does not send the admin token, so it cannot purge this backend.
+set -euo pipefail
+
+ADMIN_TOKEN=${ADMIN_TOKEN:-rinha-dev-admin-token}
+BACKEND_URL=${BACKEND_URL:-http://localhost:9999}
+
+curl -fsS -X POST -H "X-Rinha-Token: $ADMIN_TOKEN" "$BACKEND_URL/purge-payments"
+echo
+
+cd "$(dirname "$0")/../rinha-test"
+k6 run "$@" rinha.js
@@ -1,6 +1,10 @@
 package structs
 
+import "time"
+
 type ServiceStatus struct {
 	Failing         bool  `json:"failing"`
 	MinResponseTime int64 `json:"minResponseTime"`
+	// CheckedAt is when the health poll that reported the status ran.
+	CheckedAt time.Time `json:"checkedAt"`
 }
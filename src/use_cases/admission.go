@@ -0,0 +1,165 @@
+package usecases
+
+import (
+	"errors"
+	"fmt"
+	"payment-processor/config"
+	"payment-processor/core/models"
+	"payment-processor/interfaces"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+var (
+	ErrIntakeThrottled  = errors.New("intake is throttled")
+	ErrIntakeOverloaded = errors.New("intake is overloaded")
+)
+
+type AdmissionLevel int32
+
+const (
+	AdmissionOpen AdmissionLevel = iota
+	AdmissionThrottled
+	AdmissionOverloaded
+)
+
+func (l AdmissionLevel) String() string {
+	switch l {
+	case AdmissionThrottled:
+		return "throttled"
+	case AdmissionOverloaded:
+		return "overloaded"
+	default:
+		return "open"
+	}
+}
+
+// Admission sheds intake before the queue outgrows what the processors can
+// clear. It samples the queue lag and the age of the oldest unacked payment
+// every ADMISSION_CHECK_INTERVAL_MS; past the throttle thresholds intake
+// rejects the priorities in ADMISSION_THROTTLE_SHED with 429, past the
+// overload thresholds those in ADMISSION_OVERLOAD_SHED with 503.
+type Admission struct {
+	level   atomic.Int32
+	lag     atomic.Int64
+	pending atomic.Int64
+	oldest  atomic.Int64
+	shed    map[models.Priority]*atomic.Int64
+}
+
+type AdmissionSnapshot struct {
+	Level           string           `json:"level"`
+	Lag             int64            `json:"lag"`
+	Pending         int64            `json:"pending"`
+	OldestPendingMs int64            `json:"oldestPendingMs"`
+	Shed            map[string]int64 `json:"shed"`
+}
+
+var admission = Admission{
+	shed: map[models.Priority]*atomic.Int64{
+		models.PriorityHigh:   new(atomic.Int64),
+		models.PriorityNormal: new(atomic.Int64),
+		models.PriorityLow:    new(atomic.Int64),
+	},
+}
+
+func GetAdmission() *Admission {
+	return &admission
+}
+
+func (a *Admission) Level() AdmissionLevel {
+	return AdmissionLevel(a.level.Load())
+}
+
+// Admit returns an *IntakeError when a payment of the given priority must be
+// shed at the current level.
+func (a *Admission) Admit(priority models.Priority) error {
+	level := a.Level()
+	if level == AdmissionOpen {
+		return nil
+	}
+	config := config.LoadConfig()
+
+	priority = priority.Normalize()
+	kind, shed := ErrIntakeThrottled, config.Admission.ThrottleShed
+	if level == AdmissionOverloaded {
+		kind, shed = ErrIntakeOverloaded, config.Admission.OverloadShed
+	}
+	if !slices.Contains(shed, string(priority)) {
+		return nil
+	}
+
+	a.shed[priority].Add(1)
+	return &IntakeError{
+		Kind:       kind,
+		RetryAfter: time.Duration(config.IntakeRetryAfter) * time.Second,
+	}
+}
+
+func (a *Admission) Snapshot() AdmissionSnapshot {
+	shed := make(map[string]int64, len(a.shed))
+	for priority, count := range a.shed {
+		shed[string(priority)] = count.Load()
+	}
+	return AdmissionSnapshot{
+		Level:           a.Level().String(),
+		Lag:             a.lag.Load(),
+		Pending:         a.pending.Load(),
+		OldestPendingMs: a.oldest.Load(),
+		Shed:            shed,
+	}
+}
+
+// Watch samples the queue until ctx is done. When the queue cannot be read
+// intake is left open; enqueueing then fails or spools on its own.
+func (a *Admission) Watch(ctx context.Context, queue interfaces.Queue) {
+	config := config.LoadConfig()
+
+	ticker := time.NewTicker(time.Duration(config.Admission.CheckInterval) * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Println("Admission: Context canceled, stopping execution")
+			return
+		case <-ticker.C:
+			level := AdmissionOpen
+			lag, pending, err := queue.Backlog(ctx)
+			var oldest time.Time
+			if err == nil {
+				oldest, err = queue.OldestUnacked(ctx)
+			}
+			if err == nil {
+				var age time.Duration
+				if !oldest.IsZero() {
+					age = max(time.Since(oldest), 0)
+				}
+				a.lag.Store(lag)
+				a.pending.Store(pending)
+				a.oldest.Store(age.Milliseconds())
+				level = admissionLevel(lag, age)
+			}
+
+			if previous := AdmissionLevel(a.level.Swap(int32(level))); previous != level {
+				fmt.Printf("Admission: %s -> %s, lag %d, oldest pending %dms\n", previous, level, a.lag.Load(), a.oldest.Load())
+			}
+		}
+	}
+}
+
+func admissionLevel(lag int64, age time.Duration) AdmissionLevel {
+	thresholds := config.LoadConfig().Admission
+	exceeds := func(value int64, threshold int) bool {
+		return threshold > 0 && value >= int64(threshold)
+	}
+	switch {
+	case exceeds(lag, thresholds.OverloadLag), exceeds(age.Milliseconds(), thresholds.OverloadOldestMs):
+		return AdmissionOverloaded
+	case exceeds(lag, thresholds.ThrottleLag), exceeds(age.Milliseconds(), thresholds.ThrottleOldestMs):
+		return AdmissionThrottled
+	}
+	return AdmissionOpen
+}
@@ -0,0 +1,22 @@
+package usecases
+
+import (
+	"math/rand"
+	"time"
+)
+
+// backoffDelay returns a "full jitter" exponential backoff: a random delay
+// between base and min(max, base*2^(attempt-1)).
+func backoffDelay(base, max time.Duration, attempt int) time.Duration {
+	ceiling := base
+	for i := 1; i < attempt && ceiling < max; i++ {
+		ceiling *= 2
+	}
+	if ceiling > max {
+		ceiling = max
+	}
+	if ceiling <= base {
+		return base
+	}
+	return base + time.Duration(rand.Int63n(int64(ceiling-base)))
+}
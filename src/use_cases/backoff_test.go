@@ -0,0 +1,46 @@
+package usecases
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	base, max := 100*time.Millisecond, 5*time.Second
+	tests := []struct {
+		attempt int
+		ceiling time.Duration
+	}{
+		{0, base},
+		{1, base},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{6, 3200 * time.Millisecond},
+		{7, max},
+		{50, max},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 200; i++ {
+			delay := backoffDelay(base, max, tt.attempt)
+			if delay < base || delay > tt.ceiling {
+				t.Fatalf("backoffDelay(attempt %d) = %v, want within [%v, %v]", tt.attempt, delay, base, tt.ceiling)
+			}
+		}
+	}
+}
+
+func TestBackoffDelayJitters(t *testing.T) {
+	seen := make(map[time.Duration]bool)
+	for i := 0; i < 50; i++ {
+		seen[backoffDelay(time.Millisecond, time.Second, 10)] = true
+	}
+	if len(seen) < 2 {
+		t.Error("backoffDelay returned the same delay every time")
+	}
+}
+
+func TestBackoffDelayMaxBelowBase(t *testing.T) {
+	if delay := backoffDelay(time.Second, time.Millisecond, 5); delay != time.Second {
+		t.Errorf("got %v, want the base delay when max is below it", delay)
+	}
+}
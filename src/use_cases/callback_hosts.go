@@ -0,0 +1,71 @@
+package usecases
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"payment-processor/config"
+	"strings"
+	"sync"
+)
+
+// ErrCallbackForbidden is returned for a callback URL whose host is not
+// allowed. Deliveries failing with it are not retried.
+var ErrCallbackForbidden = errors.New("callback host is not allowed")
+
+var (
+	deniedNetworksOnce sync.Once
+	deniedNetworks     []*net.IPNet
+)
+
+// CheckCallbackHost checks the host of a callback URL against
+// WEBHOOK_ALLOWED_HOSTS and, when it is an IP literal, against
+// WEBHOOK_DENIED_NETWORKS. Hostnames are checked again once resolved, by
+// CheckCallbackIP, when the webhook is sent.
+func CheckCallbackHost(host string) error {
+	allowed := config.LoadConfig().Webhooks.AllowedHosts
+	if len(allowed) > 0 && !hostAllowed(strings.ToLower(host), allowed) {
+		return fmt.Errorf("%w: %s is not in WEBHOOK_ALLOWED_HOSTS", ErrCallbackForbidden, host)
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return CheckCallbackIP(ip)
+	}
+	return nil
+}
+
+// CheckCallbackIP rejects addresses in WEBHOOK_DENIED_NETWORKS, by default
+// every loopback, private, link-local and otherwise internal range, so
+// callbacks cannot reach Redis, Postgres, the processors or metadata services.
+func CheckCallbackIP(ip net.IP) error {
+	if ip.IsUnspecified() || ip.IsMulticast() {
+		return fmt.Errorf("%w: %s", ErrCallbackForbidden, ip)
+	}
+	deniedNetworksOnce.Do(func() {
+		for _, cidr := range config.LoadConfig().Webhooks.DeniedNetworks {
+			_, network, err := net.ParseCIDR(cidr)
+			if err != nil {
+				fmt.Printf("Ignoring invalid WEBHOOK_DENIED_NETWORKS entry %q: %v\n", cidr, err)
+				continue
+			}
+			deniedNetworks = append(deniedNetworks, network)
+		}
+	})
+	for _, network := range deniedNetworks {
+		if network.Contains(ip) {
+			return fmt.Errorf("%w: %s is in %s", ErrCallbackForbidden, ip, network)
+		}
+	}
+	return nil
+}
+
+// hostAllowed matches host against the allowlist; an entry starting with a
+// dot allows every subdomain of it.
+func hostAllowed(host string, allowed []string) bool {
+	for _, entry := range allowed {
+		entry = strings.ToLower(entry)
+		if host == entry || (strings.HasPrefix(entry, ".") && strings.HasSuffix(host, entry)) {
+			return true
+		}
+	}
+	return false
+}
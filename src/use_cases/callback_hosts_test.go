@@ -0,0 +1,91 @@
+package usecases
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestCheckCallbackIP(t *testing.T) {
+	tests := []struct {
+		ip      string
+		allowed bool
+	}{
+		{"127.0.0.1", false},
+		{"127.10.0.1", false},
+		{"::1", false},
+		{"10.0.0.5", false},
+		{"172.16.3.4", false},
+		{"172.31.255.255", false},
+		{"192.168.1.10", false},
+		{"100.64.0.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:10.0.0.1", false},
+		{"::ffff:169.254.169.254", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"224.0.0.1", false},
+		{"172.32.0.1", true},
+		{"8.8.8.8", true},
+		{"2606:4700:4700::1111", true},
+	}
+	for _, tt := range tests {
+		err := CheckCallbackIP(net.ParseIP(tt.ip))
+		if tt.allowed && err != nil {
+			t.Errorf("CheckCallbackIP(%s) = %v, want allowed", tt.ip, err)
+		}
+		if !tt.allowed && !errors.Is(err, ErrCallbackForbidden) {
+			t.Errorf("CheckCallbackIP(%s) = %v, want ErrCallbackForbidden", tt.ip, err)
+		}
+	}
+}
+
+func TestCheckCallbackHost(t *testing.T) {
+	// WEBHOOK_ALLOWED_HOSTS is empty here, so only IP literals are checked;
+	// hostnames are checked once resolved, when dialed.
+	tests := []struct {
+		host    string
+		allowed bool
+	}{
+		{"127.0.0.1", false},
+		{"169.254.169.254", false},
+		{"::ffff:192.168.0.1", false},
+		{"::1", false},
+		{"8.8.8.8", true},
+		{"example.com", true},
+		{"localhost", true},
+	}
+	for _, tt := range tests {
+		err := CheckCallbackHost(tt.host)
+		if tt.allowed && err != nil {
+			t.Errorf("CheckCallbackHost(%s) = %v, want allowed", tt.host, err)
+		}
+		if !tt.allowed && !errors.Is(err, ErrCallbackForbidden) {
+			t.Errorf("CheckCallbackHost(%s) = %v, want ErrCallbackForbidden", tt.host, err)
+		}
+	}
+}
+
+func TestHostAllowed(t *testing.T) {
+	allowed := []string{"hooks.example.com", ".partner.io"}
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"hooks.example.com", true},
+		{"example.com", false},
+		{"evil-hooks.example.com", false},
+		{"api.partner.io", true},
+		{"a.b.partner.io", true},
+		{"partner.io", false},
+		{"evilpartner.io", false},
+	}
+	for _, tt := range tests {
+		if got := hostAllowed(tt.host, allowed); got != tt.want {
+			t.Errorf("hostAllowed(%s) = %v, want %v", tt.host, got, tt.want)
+		}
+	}
+}
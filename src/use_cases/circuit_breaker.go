@@ -0,0 +1,248 @@
+package usecases
+
+import (
+	"encoding/json"
+	"fmt"
+	"payment-processor/config"
+	"payment-processor/interfaces"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+type CircuitState string
+
+const (
+	CircuitClosed   CircuitState = "closed"
+	CircuitOpen     CircuitState = "open"
+	CircuitHalfOpen CircuitState = "half-open"
+)
+
+// CircuitBreakers is the process-wide circuit breaker of every payment
+// processor, fed by the outcome of real calls. A breaker opens after
+// CIRCUIT_FAILURE_THRESHOLD failures in a row and refuses calls for
+// CIRCUIT_OPEN_MS; it is then half-open and lets CIRCUIT_HALF_OPEN_PROBES
+// calls through at a time, closing on the first success and opening again on
+// the first failure. Opening and closing are published so every instance
+// follows the breaker of the instance that saw the failures, while failure
+// streaks and probes stay local.
+type CircuitBreakers struct {
+	mu       sync.Mutex
+	breakers map[string]*circuitBreaker
+}
+
+type circuitBreaker struct {
+	state     CircuitState
+	failures  int
+	probes    int
+	changedAt time.Time
+	openUntil time.Time
+}
+
+// CircuitBreakerSnapshot is one processor's breaker, as published to the
+// other instances and reported by GET /circuit-breakers.
+type CircuitBreakerSnapshot struct {
+	Processor           string       `json:"processor"`
+	State               CircuitState `json:"state"`
+	ConsecutiveFailures int          `json:"consecutiveFailures"`
+	ProbesInFlight      int          `json:"probesInFlight"`
+	ChangedAt           time.Time    `json:"changedAt"`
+	OpenUntil           *time.Time   `json:"openUntil,omitempty"`
+}
+
+var circuitBreakers = CircuitBreakers{breakers: make(map[string]*circuitBreaker)}
+
+func GetCircuitBreakers() *CircuitBreakers {
+	return &circuitBreakers
+}
+
+// Available reports whether a call to processor would be let through, without
+// taking a probe.
+func (c *CircuitBreakers) Available(processor string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	breaker := c.breaker(processor)
+	switch breaker.currentState() {
+	case CircuitOpen:
+		return false
+	case CircuitHalfOpen:
+		return breaker.probes < config.LoadConfig().CircuitBreaker.HalfOpenProbes
+	}
+	return true
+}
+
+// Allow lets a call to processor through, reporting whether it is a probe of
+// a half-open breaker. Every allowed call must be followed by Record.
+func (c *CircuitBreakers) Allow(processor string) (probe bool, allowed bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	breaker := c.breaker(processor)
+	switch breaker.currentState() {
+	case CircuitOpen:
+		return false, false
+	case CircuitHalfOpen:
+		if breaker.probes >= config.LoadConfig().CircuitBreaker.HalfOpenProbes {
+			return false, false
+		}
+		breaker.probes++
+		return true, true
+	}
+	return false, true
+}
+
+// Record feeds the outcome of a call allowed by Allow into the breaker and
+// publishes the breaker when the call opened or closed it.
+func (c *CircuitBreakers) Record(ctx context.Context, store interfaces.Store, processor string, probe, failed bool) {
+	config := config.LoadConfig().CircuitBreaker
+
+	c.mu.Lock()
+	breaker := c.breaker(processor)
+	if probe && breaker.probes > 0 {
+		breaker.probes--
+	}
+	state := breaker.currentState()
+	changed := false
+	switch {
+	case failed && state != CircuitOpen:
+		breaker.failures++
+		if state == CircuitHalfOpen || breaker.failures >= config.FailureThreshold {
+			breaker.state = CircuitOpen
+			breaker.changedAt = time.Now()
+			breaker.openUntil = breaker.changedAt.Add(time.Duration(config.OpenMs) * time.Millisecond)
+			changed = true
+		}
+	case !failed:
+		breaker.failures = 0
+		if state == CircuitHalfOpen {
+			breaker.state = CircuitClosed
+			breaker.changedAt = time.Now()
+			breaker.openUntil = time.Time{}
+			changed = true
+		}
+	}
+	snapshot := breaker.snapshot(processor)
+	c.mu.Unlock()
+
+	if changed {
+		fmt.Printf("CircuitBreakers: %s breaker %s\n", processor, snapshot.State)
+		if err := c.publish(ctx, store, snapshot); err != nil {
+			fmt.Println("CircuitBreakers: failed to publish breaker:", err)
+		}
+	}
+}
+
+// Snapshot returns every processor's breaker, sorted by processor.
+func (c *CircuitBreakers) Snapshot() []CircuitBreakerSnapshot {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, processor := range config.LoadConfig().Processors {
+		c.breaker(processor.Name)
+	}
+
+	snapshots := make([]CircuitBreakerSnapshot, 0, len(c.breakers))
+	for processor, breaker := range c.breakers {
+		snapshots = append(snapshots, breaker.snapshot(processor))
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Processor < snapshots[j].Processor
+	})
+	return snapshots
+}
+
+// Watch applies the breakers published by the other instances until ctx is
+// done, starting from the stored ones.
+func (c *CircuitBreakers) Watch(ctx context.Context, store interfaces.Store) {
+	registry := config.LoadConfig().Processors
+	config := config.LoadConfig().CircuitBreaker
+
+	messages := store.Subscribe(ctx, config.Channel)
+
+	for _, processor := range registry {
+		if data, err := store.Get(ctx, config.KeyPrefix+processor.Name); err == nil && data != "" {
+			c.apply(data)
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Println("CircuitBreakers: Context canceled, stopping execution")
+			return
+		case payload, ok := <-messages:
+			if !ok {
+				return
+			}
+			c.apply(payload)
+		}
+	}
+}
+
+func (c *CircuitBreakers) publish(ctx context.Context, store interfaces.Store, snapshot CircuitBreakerSnapshot) error {
+	config := config.LoadConfig().CircuitBreaker
+	encoded, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to encode circuit breaker: %w", err)
+	}
+	// An open breaker outlives its open period so late joiners still see it
+	// half-open; a closed one only needs to cover the same span.
+	ttl := 2 * time.Duration(config.OpenMs) * time.Millisecond
+	return store.SetPublish(ctx, config.KeyPrefix+snapshot.Processor, config.Channel, string(encoded), ttl)
+}
+
+// apply adopts a published breaker unless the local one changed after it.
+func (c *CircuitBreakers) apply(data string) {
+	var snapshot CircuitBreakerSnapshot
+	if err := json.Unmarshal([]byte(data), &snapshot); err != nil {
+		fmt.Println("CircuitBreakers: failed to decode breaker:", err)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	breaker := c.breaker(snapshot.Processor)
+	if !snapshot.ChangedAt.After(breaker.changedAt) {
+		return
+	}
+	breaker.state = CircuitClosed
+	breaker.openUntil = time.Time{}
+	if snapshot.State != CircuitClosed && snapshot.OpenUntil != nil {
+		breaker.state = CircuitOpen
+		breaker.openUntil = *snapshot.OpenUntil
+	}
+	breaker.changedAt = snapshot.ChangedAt
+	breaker.failures = 0
+}
+
+func (c *CircuitBreakers) breaker(processor string) *circuitBreaker {
+	breaker, ok := c.breakers[processor]
+	if !ok {
+		breaker = &circuitBreaker{state: CircuitClosed}
+		c.breakers[processor] = breaker
+	}
+	return breaker
+}
+
+// currentState turns an open breaker whose open period is over into a
+// half-open one.
+func (b *circuitBreaker) currentState() CircuitState {
+	if b.state == CircuitOpen && !time.Now().Before(b.openUntil) {
+		return CircuitHalfOpen
+	}
+	return b.state
+}
+
+func (b *circuitBreaker) snapshot(processor string) CircuitBreakerSnapshot {
+	snapshot := CircuitBreakerSnapshot{
+		Processor:           processor,
+		State:               b.currentState(),
+		ConsecutiveFailures: b.failures,
+		ProbesInFlight:      b.probes,
+		ChangedAt:           b.changedAt,
+	}
+	if !b.openUntil.IsZero() {
+		openUntil := b.openUntil
+		snapshot.OpenUntil = &openUntil
+	}
+	return snapshot
+}
@@ -0,0 +1,116 @@
+package usecases
+
+import (
+	"encoding/json"
+	"payment-processor/config"
+	"payment-processor/infrastructure"
+	"payment-processor/interfaces"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// recordOutcomes feeds calls into breakers with a cancelled context, so
+// publishing a change fails fast instead of needing Redis.
+func recordOutcomes(breakers *CircuitBreakers, store interfaces.Store, processor string, probe bool, outcomes ...bool) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, failed := range outcomes {
+		breakers.Record(ctx, store, processor, probe, failed)
+	}
+}
+
+func TestCircuitBreakerLifecycle(t *testing.T) {
+	settings := config.LoadConfig().CircuitBreaker
+	store := infrastructure.NewRedis()
+	breakers := &CircuitBreakers{breakers: make(map[string]*circuitBreaker)}
+
+	for i := 0; i < settings.FailureThreshold-1; i++ {
+		recordOutcomes(breakers, store, "default", false, true)
+	}
+	if !breakers.Available("default") {
+		t.Fatal("breaker opened before reaching the failure threshold")
+	}
+	// A success resets the streak.
+	recordOutcomes(breakers, store, "default", false, false)
+	recordOutcomes(breakers, store, "default", false, true)
+	if !breakers.Available("default") {
+		t.Fatal("breaker opened on a streak broken by a success")
+	}
+
+	for i := 0; i < settings.FailureThreshold; i++ {
+		recordOutcomes(breakers, store, "default", false, true)
+	}
+	if breakers.Available("default") {
+		t.Fatal("breaker did not open at the failure threshold")
+	}
+	if _, allowed := breakers.Allow("default"); allowed {
+		t.Fatal("open breaker let a call through")
+	}
+	if !breakers.Available("fallback") {
+		t.Fatal("breakers are not per processor")
+	}
+
+	// Once the open period is over the breaker is half-open and lets
+	// HalfOpenProbes calls through.
+	breakers.breakers["default"].openUntil = time.Now().Add(-time.Millisecond)
+	for i := 0; i < settings.HalfOpenProbes; i++ {
+		if probe, allowed := breakers.Allow("default"); !probe || !allowed {
+			t.Fatalf("half-open breaker Allow = %v, %v, want a probe", probe, allowed)
+		}
+	}
+	if _, allowed := breakers.Allow("default"); allowed {
+		t.Fatal("half-open breaker let more than CIRCUIT_HALF_OPEN_PROBES calls through")
+	}
+
+	// A failed probe opens it again, a successful one closes it.
+	recordOutcomes(breakers, store, "default", true, true)
+	if state := breakers.breakers["default"].currentState(); state != CircuitOpen {
+		t.Fatalf("failed probe left the breaker %s", state)
+	}
+	breakers.breakers["default"].openUntil = time.Now().Add(-time.Millisecond)
+	breakers.Allow("default")
+	recordOutcomes(breakers, store, "default", true, false)
+	if state := breakers.breakers["default"].currentState(); state != CircuitClosed {
+		t.Fatalf("successful probe left the breaker %s", state)
+	}
+	if probes := breakers.breakers["default"].probes; probes != 0 {
+		t.Errorf("%d probes still in flight", probes)
+	}
+}
+
+func TestCircuitBreakerApply(t *testing.T) {
+	breakers := &CircuitBreakers{breakers: make(map[string]*circuitBreaker)}
+	now := time.Now()
+	openUntil := now.Add(time.Minute)
+	publish := func(snapshot CircuitBreakerSnapshot) {
+		data, err := json.Marshal(snapshot)
+		if err != nil {
+			t.Fatal(err)
+		}
+		breakers.apply(string(data))
+	}
+
+	publish(CircuitBreakerSnapshot{Processor: "default", State: CircuitOpen, ChangedAt: now, OpenUntil: &openUntil})
+	if breakers.Available("default") {
+		t.Fatal("published open breaker was not applied")
+	}
+
+	// An older snapshot does not override a newer local change.
+	publish(CircuitBreakerSnapshot{Processor: "default", State: CircuitClosed, ChangedAt: now.Add(-time.Second)})
+	if breakers.Available("default") {
+		t.Fatal("stale snapshot closed the breaker")
+	}
+
+	publish(CircuitBreakerSnapshot{Processor: "default", State: CircuitClosed, ChangedAt: now.Add(time.Second)})
+	if !breakers.Available("default") {
+		t.Fatal("newer closed snapshot was not applied")
+	}
+
+	// Corrupt payloads are ignored.
+	breakers.apply("{")
+	if !breakers.Available("default") {
+		t.Fatal("corrupt snapshot changed the breaker")
+	}
+}
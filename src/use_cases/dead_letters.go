@@ -0,0 +1,133 @@
+package usecases
+
+import (
+	"errors"
+	"fmt"
+	"payment-processor/core/models"
+	"payment-processor/interfaces"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+var ErrDeadLetterNotFound = errors.New("dead-letter entry not found")
+
+// DeadLetterUseCase manages the queue's dead letters, where payments end up
+// once they exhaust MAX_ATTEMPTS or can never be processed.
+type DeadLetterUseCase struct {
+	Queue  interfaces.Queue
+	Status *PaymentStatusUseCase
+}
+
+type DeadLetterPage struct {
+	Total   int64                  `json:"total"`
+	Entries []models.QueuedPayment `json:"entries"`
+	Next    string                 `json:"next,omitempty"`
+}
+
+func NewDeadLetterUseCase(queue interfaces.Queue, status *PaymentStatusUseCase) *DeadLetterUseCase {
+	return &DeadLetterUseCase{
+		Queue:  queue,
+		Status: status,
+	}
+}
+
+// DeadLetter moves a delivery to the dead-letter queue with its delivery
+// history and acks the original in the same transaction.
+func (d *DeadLetterUseCase) DeadLetter(ctx context.Context, message models.QueueMessage, entry models.QueuedPayment) error {
+	values := entryValues(message.Values, entry)
+	values["deadLetteredAt"] = time.Now().UTC().Format(time.RFC3339Nano)
+	values["sourceId"] = message.ID
+	if err := d.Queue.DeadLetter(ctx, message.ID, values); err != nil {
+		return err
+	}
+
+	correlationID, _ := message.Values["correlationId"].(string)
+	var reason string
+	if len(entry.Reasons) > 0 {
+		reason = entry.Reasons[len(entry.Reasons)-1]
+	}
+	if err := d.Status.MarkDeadLettered(ctx, correlationID, reason); err != nil {
+		fmt.Println("Error tracking dead-lettered payment status:", err)
+	}
+	return nil
+}
+
+// List returns up to count entries, oldest first, starting at the entry id
+// start (inclusive, empty for the beginning).
+func (d *DeadLetterUseCase) List(ctx context.Context, start string, count int64) (*DeadLetterPage, error) {
+	messages, total, err := d.Queue.DeadLetters(ctx, start, count+1)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &DeadLetterPage{Total: total, Entries: []models.QueuedPayment{}}
+	if int64(len(messages)) > count {
+		page.Next = messages[count].ID
+		messages = messages[:count]
+	}
+	for _, message := range messages {
+		entry, _ := ParseQueuedPayment(message)
+		page.Entries = append(page.Entries, entry)
+	}
+	return page, nil
+}
+
+func (d *DeadLetterUseCase) Get(ctx context.Context, id string) (*models.QueuedPayment, error) {
+	message, err := d.find(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	entry, _ := ParseQueuedPayment(message)
+	return &entry, nil
+}
+
+// Replay moves the entry back to the payments queue with a fresh attempt
+// budget and returns its new id. Concurrent replays of the same entry enqueue
+// it once.
+func (d *DeadLetterUseCase) Replay(ctx context.Context, id string) (string, error) {
+	message, err := d.find(ctx, id)
+	if err != nil {
+		return "", err
+	}
+
+	values := entryValues(message.Values, models.QueuedPayment{})
+	delete(values, "deadLetteredAt")
+	delete(values, "sourceId")
+	newID, found, err := d.Queue.ReplayDeadLetter(ctx, id, values)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "", ErrDeadLetterNotFound
+	}
+
+	if entry, err := ParseQueuedPayment(message); err == nil {
+		if err := d.Status.MarkQueued(ctx, entry.Payment()); err != nil {
+			fmt.Println("Error tracking replayed payment status:", err)
+		}
+	}
+	return newID, nil
+}
+
+func (d *DeadLetterUseCase) Discard(ctx context.Context, id string) error {
+	deleted, err := d.Queue.DiscardDeadLetter(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrDeadLetterNotFound
+	}
+	return nil
+}
+
+func (d *DeadLetterUseCase) find(ctx context.Context, id string) (models.QueueMessage, error) {
+	messages, _, err := d.Queue.DeadLetters(ctx, id, 1)
+	if err != nil {
+		return models.QueueMessage{}, err
+	}
+	if len(messages) == 0 || messages[0].ID != id {
+		return models.QueueMessage{}, ErrDeadLetterNotFound
+	}
+	return messages[0], nil
+}
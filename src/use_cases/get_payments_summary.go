@@ -4,60 +4,75 @@ import (
 	"encoding/json"
 	"payment-processor/config"
 	"payment-processor/core/models"
-	"payment-processor/infrastructure"
+	"payment-processor/interfaces"
 	"time"
 
 	"golang.org/x/net/context"
 )
 
 type GetPaymentsSummaryUseCase struct {
-	Redis *infrastructure.Redis
+	Store interfaces.Store
 }
 
-type PaymentsSummary struct {
-	Default  *SummaryItem `json:"default"`
-	Fallback *SummaryItem `json:"fallback"`
+// PaymentsSummary maps every registered processor to its totals, so with the
+// default registry it keeps the {"default": ..., "fallback": ...} shape.
+type PaymentsSummary map[string]*SummaryItem
+
+// summaryMember is a member of the processed payments sorted set: a single
+// payment, or a per-second bucket of Count payments once RetentionUseCase
+// compacted it.
+type summaryMember struct {
+	models.Payment
+	Count int `json:"count,omitempty"`
+}
+
+func (m summaryMember) requests() int {
+	if m.Count > 0 {
+		return m.Count
+	}
+	return 1
 }
 
 type SummaryItem struct {
-	TotalRequests int     `json:"totalRequests"`
-	TotalAmount   float64 `json:"totalAmount"`
+	TotalRequests int          `json:"totalRequests"`
+	TotalAmount   models.Money `json:"totalAmount"`
 }
 
-func NewGetPaymentsSummaryUseCase(redis *infrastructure.Redis) *GetPaymentsSummaryUseCase {
+func NewGetPaymentsSummaryUseCase(store interfaces.Store) *GetPaymentsSummaryUseCase {
 	return &GetPaymentsSummaryUseCase{
-		Redis: redis,
+		Store: store,
 	}
 }
 
 func (g *GetPaymentsSummaryUseCase) Execute(ctx context.Context, from, to time.Time) (*PaymentsSummary, error) {
 	config := config.LoadConfig()
-	summary := &PaymentsSummary{
-		Default:  &SummaryItem{TotalRequests: 0, TotalAmount: 0},
-		Fallback: &SummaryItem{TotalRequests: 0, TotalAmount: 0},
+	summary := PaymentsSummary{}
+	for _, processor := range config.Processors {
+		summary[processor.Name] = &SummaryItem{TotalRequests: 0, TotalAmount: 0}
 	}
-	data, err := g.Redis.ZRangeByScore(ctx, config.SetQueue, from, to)
+	data, err := g.Store.ZRangeByScore(ctx, config.SetQueue, from, to)
 	if err != nil {
 		return nil, err
 	}
 	if len(data) == 0 {
-		return summary, nil
+		return &summary, nil
 	}
 
 	for _, item := range data {
-		var payment models.Payment
+		var payment summaryMember
 		json.Unmarshal([]byte(item), &payment)
 		if payment.RequestedAt < from.Format(time.RFC3339) || payment.RequestedAt > to.Format(time.RFC3339) {
 			continue
 		}
-		switch payment.Type {
-		case "default":
-			summary.Default.TotalRequests += 1
-			summary.Default.TotalAmount += payment.Amount
-		case "fallback":
-			summary.Fallback.TotalRequests += 1
-			summary.Fallback.TotalAmount += payment.Amount
+		// Processors dropped from the registry still show up while their
+		// payments are in range.
+		item, ok := summary[payment.Type]
+		if !ok {
+			item = &SummaryItem{}
+			summary[payment.Type] = item
 		}
+		item.TotalRequests += payment.requests()
+		item.TotalAmount += payment.Amount
 	}
-	return summary, nil
+	return &summary, nil
 }
@@ -0,0 +1,189 @@
+package usecases
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"payment-processor/config"
+	"payment-processor/core/models"
+	"payment-processor/infrastructure"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidPayment   = errors.New("invalid payment")
+	ErrQueueFull        = errors.New("payment queue is full")
+	ErrQueueUnavailable = errors.New("payment queue is unavailable")
+)
+
+// IntakeError is returned by the intake use cases when a payment was not
+// queued. Kind is one of ErrInvalidPayment, ErrQueueFull, ErrQueueUnavailable,
+// ErrIntakeThrottled or ErrIntakeOverloaded so callers can match it with
+// errors.Is; RetryAfter tells clients when a retry is worth attempting.
+type IntakeError struct {
+	Kind       error
+	RetryAfter time.Duration
+	Cause      error
+}
+
+func (e *IntakeError) Error() string {
+	if e.Cause == nil {
+		return e.Kind.Error()
+	}
+	return fmt.Sprintf("%v: %v", e.Kind, e.Cause)
+}
+
+func (e *IntakeError) Is(target error) bool {
+	return target == e.Kind
+}
+
+func (e *IntakeError) Unwrap() error {
+	return e.Cause
+}
+
+type IntakeMetrics struct {
+	Accepted         atomic.Int64
+	Duplicate        atomic.Int64
+	Conflict         atomic.Int64
+	Invalid          atomic.Int64
+	QueueFull        atomic.Int64
+	QueueUnavailable atomic.Int64
+	Spooled          atomic.Int64
+}
+
+type IntakeMetricsSnapshot struct {
+	Accepted         int64                  `json:"accepted"`
+	Duplicate        int64                  `json:"duplicate"`
+	Conflict         int64                  `json:"conflict"`
+	Invalid          int64                  `json:"invalid"`
+	QueueFull        int64                  `json:"queueFull"`
+	QueueUnavailable int64                  `json:"queueUnavailable"`
+	Spooled          int64                  `json:"spooled"`
+	RedisMemory      MemoryPressureSnapshot `json:"redisMemory"`
+	Admission        AdmissionSnapshot      `json:"admission"`
+}
+
+// intakeMetrics is process wide: the HTTP composites and the workers build
+// their own use case instances, but all of them report to the same counters.
+var intakeMetrics IntakeMetrics
+
+func GetIntakeMetrics() *IntakeMetrics {
+	return &intakeMetrics
+}
+
+func (m *IntakeMetrics) Snapshot() IntakeMetricsSnapshot {
+	return IntakeMetricsSnapshot{
+		Accepted:         m.Accepted.Load(),
+		Duplicate:        m.Duplicate.Load(),
+		Conflict:         m.Conflict.Load(),
+		Invalid:          m.Invalid.Load(),
+		QueueFull:        m.QueueFull.Load(),
+		QueueUnavailable: m.QueueUnavailable.Load(),
+		Spooled:          m.Spooled.Load(),
+		RedisMemory:      memoryPressure.Snapshot(),
+		Admission:        admission.Snapshot(),
+	}
+}
+
+func (m *IntakeMetrics) record(result EnqueueResult, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidPayment):
+		m.Invalid.Add(1)
+	case errors.Is(err, ErrPaymentConflict):
+		m.Conflict.Add(1)
+	case errors.Is(err, ErrQueueFull):
+		m.QueueFull.Add(1)
+	case errors.Is(err, ErrQueueUnavailable):
+		m.QueueUnavailable.Add(1)
+	case result == EnqueueDuplicate:
+		m.Duplicate.Add(1)
+	case result == EnqueueAccepted:
+		m.Accepted.Add(1)
+	}
+}
+
+const (
+	OutcomeAccepted  = "accepted"
+	OutcomeDuplicate = "duplicate"
+	OutcomeConflict  = "conflict"
+	OutcomeInvalid   = "invalid"
+	OutcomeFailed    = "failed"
+)
+
+// DescribeOutcome summarises the enqueue of one payment as a status and a
+// reason that can be shown to the client.
+func DescribeOutcome(result EnqueueResult, err error) (string, string) {
+	switch {
+	case errors.Is(err, ErrInvalidPayment):
+		return OutcomeInvalid, errors.Unwrap(err).Error()
+	case errors.Is(err, ErrPaymentConflict):
+		return OutcomeConflict, err.Error()
+	case errors.Is(err, ErrQueueFull):
+		return OutcomeFailed, "payment queue is full, retry later"
+	case errors.Is(err, ErrIntakeThrottled):
+		return OutcomeFailed, "intake is throttled, retry later"
+	case errors.Is(err, ErrIntakeOverloaded):
+		return OutcomeFailed, "intake is overloaded, retry later"
+	case err != nil:
+		return OutcomeFailed, "payment queue is unavailable, retry later"
+	case result == EnqueueDuplicate:
+		return OutcomeDuplicate, ""
+	default:
+		return OutcomeAccepted, ""
+	}
+}
+
+// ValidatePayment checks the intake constraints of a payment.
+func ValidatePayment(payment models.Payment) error {
+	var reason string
+	switch {
+	case payment.CorrelationID == "":
+		reason = "correlationId is required"
+	case uuid.Validate(payment.CorrelationID) != nil:
+		reason = "correlationId must be a valid UUID"
+	case payment.Amount <= 0:
+		reason = "amount must be greater than zero"
+	case payment.CallbackURL != "" && !config.LoadConfig().Webhooks.Enabled():
+		reason = "callbackUrl is not accepted, webhooks are disabled"
+	case payment.CallbackURL != "" && !isHTTPURL(payment.CallbackURL):
+		reason = "callbackUrl must be an absolute http or https URL"
+	case payment.CallbackURL != "" && !callbackHostAllowed(payment.CallbackURL):
+		reason = "callbackUrl host is not allowed"
+	case !payment.Priority.Valid():
+		reason = "priority must be high, normal or low"
+	default:
+		return nil
+	}
+	return &IntakeError{Kind: ErrInvalidPayment, Cause: errors.New(reason)}
+}
+
+func isHTTPURL(raw string) bool {
+	parsed, err := url.Parse(raw)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
+
+func callbackHostAllowed(raw string) bool {
+	parsed, err := url.Parse(raw)
+	return err == nil && CheckCallbackHost(parsed.Hostname()) == nil
+}
+
+// classifyQueueError turns a storage failure into a typed intake error: Redis
+// refusing writes because of maxmemory means the queue is full, anything else
+// means it is unreachable.
+func classifyQueueError(err error) error {
+	retryAfter := time.Duration(config.LoadConfig().IntakeRetryAfter) * time.Second
+	if infrastructure.IsOutOfMemory(err) {
+		return &IntakeError{Kind: ErrQueueFull, RetryAfter: retryAfter, Cause: err}
+	}
+	return &IntakeError{Kind: ErrQueueUnavailable, RetryAfter: retryAfter, Cause: err}
+}
+
+func queueFullError() error {
+	return &IntakeError{
+		Kind:       ErrQueueFull,
+		RetryAfter: time.Duration(config.LoadConfig().IntakeRetryAfter) * time.Second,
+	}
+}
@@ -0,0 +1,30 @@
+package usecases
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// miniRedis is the Redis every test of the package talks to.
+var miniRedis *miniredis.Miniredis
+
+// TestMain points the configuration at an in-process Redis and enables
+// webhooks before the first LoadConfig, which reads the environment once.
+func TestMain(m *testing.M) {
+	server, err := miniredis.Run()
+	if err != nil {
+		fmt.Println("Failed to start miniredis:", err)
+		os.Exit(1)
+	}
+	miniRedis = server
+	os.Setenv("REDIS_HOST", server.Host())
+	os.Setenv("REDIS_PORT", server.Port())
+	os.Setenv("WEBHOOK_SECRET", "test-secret")
+
+	code := m.Run()
+	server.Close()
+	os.Exit(code)
+}
@@ -0,0 +1,74 @@
+package usecases
+
+import (
+	"fmt"
+	"payment-processor/config"
+	"payment-processor/interfaces"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// MemoryPressure tracks how close Redis is to maxmemory. Redis runs with
+// noeviction, so past the limit every write fails; intake starts answering
+// 429 at MEMORY_HIGH_WATERMARK_PERCENT instead, leaving room for the workers
+// to ack, retry and record what is already queued.
+type MemoryPressure struct {
+	used   atomic.Int64
+	max    atomic.Int64
+	active atomic.Bool
+}
+
+type MemoryPressureSnapshot struct {
+	UsedBytes int64 `json:"usedBytes"`
+	MaxBytes  int64 `json:"maxBytes"`
+	Active    bool  `json:"active"`
+}
+
+var memoryPressure MemoryPressure
+
+func GetMemoryPressure() *MemoryPressure {
+	return &memoryPressure
+}
+
+func (m *MemoryPressure) Active() bool {
+	return m.active.Load()
+}
+
+func (m *MemoryPressure) Snapshot() MemoryPressureSnapshot {
+	return MemoryPressureSnapshot{
+		UsedBytes: m.used.Load(),
+		MaxBytes:  m.max.Load(),
+		Active:    m.active.Load(),
+	}
+}
+
+// Watch polls the store's memory usage until ctx is done. Failed polls keep
+// the last reading; an unreachable Redis is handled by the spool instead.
+// Stores without a memory limit never activate it.
+func (m *MemoryPressure) Watch(ctx context.Context, store interfaces.Store) {
+	config := config.LoadConfig()
+
+	ticker := time.NewTicker(time.Duration(config.MemoryCheckInterval) * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Println("MemoryPressure: Context canceled, stopping execution")
+			return
+		case <-ticker.C:
+			used, max, err := store.MemoryUsage(ctx)
+			if err != nil {
+				continue
+			}
+			m.used.Store(used)
+			m.max.Store(max)
+
+			active := max > 0 && used*100 >= max*int64(config.MemoryHighWatermark)
+			if m.active.Swap(active) != active {
+				fmt.Printf("MemoryPressure: active=%t, redis using %d of %d bytes\n", active, used, max)
+			}
+		}
+	}
+}
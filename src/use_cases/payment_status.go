@@ -0,0 +1,162 @@
+package usecases
+
+import (
+	"errors"
+	"fmt"
+	"payment-processor/config"
+	"payment-processor/core/models"
+	"payment-processor/interfaces"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+var ErrPaymentNotFound = errors.New("payment not found")
+
+type PaymentStatusUseCase struct {
+	Store interfaces.Store
+}
+
+func NewPaymentStatusUseCase(store interfaces.Store) *PaymentStatusUseCase {
+	return &PaymentStatusUseCase{
+		Store: store,
+	}
+}
+
+func (p *PaymentStatusUseCase) MarkQueued(ctx context.Context, payment models.Payment) error {
+	return p.transition(ctx, payment.CorrelationID, models.PaymentStateQueued, map[string]interface{}{
+		"amount":      payment.Amount.String(),
+		"requestedAt": payment.RequestedAt,
+	}, false)
+}
+
+// MarkQueuedBatch records the queued state of many payments in one round trip.
+func (p *PaymentStatusUseCase) MarkQueuedBatch(ctx context.Context, payments []models.Payment) error {
+	config := config.LoadConfig()
+	updates := make([]models.HashUpdate, 0, len(payments))
+	for _, payment := range payments {
+		updates = append(updates, models.HashUpdate{
+			Key: statusKey(payment.CorrelationID),
+			Values: transitionValues(models.PaymentStateQueued, map[string]interface{}{
+				"amount":      payment.Amount.String(),
+				"requestedAt": payment.RequestedAt,
+			}),
+		})
+	}
+	return p.Store.HUpdateMany(ctx, updates, time.Duration(config.PaymentStatusTTL)*time.Second)
+}
+
+// MarkDispatching records that a worker is about to call a processor; every
+// dispatch counts as one attempt.
+func (p *PaymentStatusUseCase) MarkDispatching(ctx context.Context, correlationID, processor string) error {
+	return p.transition(ctx, correlationID, models.PaymentStateDispatching, map[string]interface{}{
+		"processor": processor,
+	}, true)
+}
+
+func (p *PaymentStatusUseCase) MarkProcessed(ctx context.Context, correlationID, processor string) error {
+	return p.transition(ctx, correlationID, models.ProcessedState(processor), map[string]interface{}{
+		"processor": processor,
+		"lastError": "",
+	}, false)
+}
+
+func (p *PaymentStatusUseCase) MarkRetrying(ctx context.Context, correlationID, reason string) error {
+	return p.transition(ctx, correlationID, models.PaymentStateRetrying, map[string]interface{}{
+		"lastError": reason,
+	}, false)
+}
+
+func (p *PaymentStatusUseCase) MarkDeadLettered(ctx context.Context, correlationID, reason string) error {
+	return p.transition(ctx, correlationID, models.PaymentStateDeadLettered, map[string]interface{}{
+		"lastError": reason,
+	}, false)
+}
+
+// MarkSpoolConflict records on the queued payment that a spooled submission
+// with the same correlationId but another amount was dropped. That submission
+// was answered 204 while Redis was down, so its status is the only place the
+// client can find out. The queued payment's state is left alone.
+func (p *PaymentStatusUseCase) MarkSpoolConflict(ctx context.Context, payment models.Payment) error {
+	config := config.LoadConfig()
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	return p.Store.HUpdate(ctx, statusKey(payment.CorrelationID), map[string]interface{}{
+		"conflict":   fmt.Sprintf("a submission with amount %s, spooled while Redis was down, was dropped: the payment was already queued with another amount", payment.Amount),
+		"conflictAt": now,
+		"updatedAt":  now,
+	}, nil, time.Duration(config.PaymentStatusTTL)*time.Second)
+}
+
+func (p *PaymentStatusUseCase) Get(ctx context.Context, correlationID string) (*models.PaymentStatus, error) {
+	values, err := p.Store.HGetAll(ctx, statusKey(correlationID))
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, ErrPaymentNotFound
+	}
+
+	amount, _ := models.ParseMoney(values["amount"])
+	attempts, _ := strconv.Atoi(values["attempts"])
+	status := &models.PaymentStatus{
+		CorrelationID: correlationID,
+		Amount:        amount,
+		RequestedAt:   values["requestedAt"],
+		State:         models.PaymentState(values["state"]),
+		Processor:     values["processor"],
+		Attempts:      attempts,
+		LastError:     values["lastError"],
+		Conflict:      values["conflict"],
+		CreatedAt:     values[string(models.PaymentStateQueued)+"At"],
+		UpdatedAt:     values["updatedAt"],
+		Transitions:   map[models.PaymentState]string{},
+	}
+	for _, state := range models.PaymentStates {
+		if at, ok := values[string(state)+"At"]; ok {
+			status.Transitions[state] = at
+		}
+	}
+	// Processors beyond default and fallback have no constant of their own.
+	for field, at := range values {
+		if strings.HasPrefix(field, models.PaymentStateProcessedPrefix) && strings.HasSuffix(field, "At") {
+			status.Transitions[models.PaymentState(strings.TrimSuffix(field, "At"))] = at
+		}
+	}
+	return status, nil
+}
+
+func (p *PaymentStatusUseCase) transition(
+	ctx context.Context,
+	correlationID string,
+	state models.PaymentState,
+	values map[string]interface{},
+	countAttempt bool,
+) error {
+	config := config.LoadConfig()
+
+	var increments map[string]int64
+	if countAttempt {
+		increments = map[string]int64{"attempts": 1}
+	}
+	return p.Store.HUpdate(
+		ctx,
+		statusKey(correlationID),
+		transitionValues(state, values),
+		increments,
+		time.Duration(config.PaymentStatusTTL)*time.Second,
+	)
+}
+
+func transitionValues(state models.PaymentState, values map[string]interface{}) map[string]interface{} {
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	values["state"] = string(state)
+	values["updatedAt"] = now
+	values[string(state)+"At"] = now
+	return values
+}
+
+func statusKey(correlationID string) string {
+	return config.LoadConfig().PaymentStatusPrefix + correlationID
+}
@@ -5,8 +5,8 @@ import (
 	"fmt"
 	"payment-processor/config"
 	"payment-processor/core/models"
-	"payment-processor/infrastructure"
 	"payment-processor/infrastructure/repositories"
+	"payment-processor/interfaces"
 	"strconv"
 	"time"
 
@@ -16,14 +16,14 @@ import (
 type ProcessPaymentUseCase struct {
 	Repo    repositories.PaymentRepository
 	UseCase GetPaymentsSummaryUseCase
-	Redis   infrastructure.Redis
+	Store   interfaces.Store
 }
 
-func NewProcessPaymentUseCase(repo repositories.PaymentRepository, useCase GetPaymentsSummaryUseCase, redis infrastructure.Redis) *ProcessPaymentUseCase {
+func NewProcessPaymentUseCase(repo repositories.PaymentRepository, useCase GetPaymentsSummaryUseCase, store interfaces.Store) *ProcessPaymentUseCase {
 	return &ProcessPaymentUseCase{
 		Repo:    repo,
 		UseCase: useCase,
-		Redis:   redis,
+		Store:   store,
 	}
 }
 
@@ -51,7 +51,7 @@ func (p *ProcessPaymentUseCase) processBatch(ctx context.Context, t time.Time) {
 		maxScore time.Time
 	)
 
-	val, _ := p.Redis.Get(ctx, "score")
+	val, _ := p.Store.Get(ctx, config.RedisScoreKey)
 	if val == "" {
 		minScore = time.Now().UTC().Add(-50 * time.Second) // Look back 10 seconds
 	} else {
@@ -62,20 +62,24 @@ func (p *ProcessPaymentUseCase) processBatch(ctx context.Context, t time.Time) {
 	}
 	maxScore = t.UTC()
 
-	data, err := p.Redis.ZRangeByScore(ctx, config.SetQueue, minScore, maxScore)
+	data, err := p.Store.ZRangeByScore(ctx, config.SetQueue, minScore, maxScore)
 	if err != nil {
 		fmt.Println("Error fetching from sorted set for batch creating payments in db:", err)
 		return
 	}
 
 	for _, item := range data {
-		var payment models.Payment
+		var payment summaryMember
 		err := json.Unmarshal([]byte(item), &payment)
 		if err != nil {
 			fmt.Println("Error unmarshaling payment from sorted set:", err)
 			continue
 		}
-		payments = append(payments, payment)
+		if payment.Count > 0 {
+			// Compacted bucket, its payments were persisted before compaction.
+			continue
+		}
+		payments = append(payments, payment.Payment)
 	}
 
 	if len(payments) > 0 {
@@ -87,7 +91,7 @@ func (p *ProcessPaymentUseCase) processBatch(ctx context.Context, t time.Time) {
 	}
 	maxScore = maxScore.Add(-1 * time.Second)
 
-	err = p.Redis.Set(ctx, "score", fmt.Sprintf("%.6f", float64(maxScore.Unix())+float64(maxScore.Nanosecond())/1e9), 3600)
+	err = p.Store.Set(ctx, config.RedisScoreKey, fmt.Sprintf("%.6f", float64(maxScore.Unix())+float64(maxScore.Nanosecond())/1e9), 3600)
 	if err != nil {
 		fmt.Println("Error updating score in Redis:", err)
 	}
@@ -0,0 +1,82 @@
+package usecases
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// outcomeWeight is the weight of the newest call in the moving averages.
+	outcomeWeight = 0.1
+	// failureHalfLife halves a processor's failure rate for every period it
+	// goes without calls, so a processor routing avoided after an outage gets
+	// traffic again once its health poll says it recovered.
+	failureHalfLife = 10 * time.Second
+	// latencyHalfLife does the same for the measured latency. Routing never
+	// takes latency below the polled minResponseTime, so a processor avoided
+	// after one slow patch drifts back to its advertised latency instead of
+	// staying priced out with nothing left to measure it.
+	latencyHalfLife = 10 * time.Second
+)
+
+// ProcessorOutcomes is the process-wide record of how calls to each payment
+// processor actually went: a moving failure rate and latency per processor.
+type ProcessorOutcomes struct {
+	mu         sync.Mutex
+	processors map[string]*processorOutcome
+}
+
+type processorOutcome struct {
+	failureRate float64
+	latency     time.Duration
+	updatedAt   time.Time
+}
+
+var processorOutcomes = ProcessorOutcomes{processors: make(map[string]*processorOutcome)}
+
+func GetProcessorOutcomes() *ProcessorOutcomes {
+	return &processorOutcomes
+}
+
+// Record adds the outcome of one call to processor. faulted is whether the
+// processor was at fault, as for the circuit breakers: a payment it refused
+// says nothing about its health.
+func (o *ProcessorOutcomes) Record(processor string, latency time.Duration, faulted bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	failed := 0.0
+	if faulted {
+		failed = 1
+	}
+	outcome, ok := o.processors[processor]
+	if !ok {
+		o.processors[processor] = &processorOutcome{failureRate: failed, latency: latency, updatedAt: time.Now()}
+		return
+	}
+	outcome.failureRate = outcomeWeight*failed + (1-outcomeWeight)*outcome.decayedFailureRate()
+	outcome.latency = time.Duration(outcomeWeight*float64(latency) + (1-outcomeWeight)*float64(outcome.decayedLatency()))
+	outcome.updatedAt = time.Now()
+}
+
+// Get returns the failure rate and latency of processor, both zero before its
+// first call and decaying towards zero while it gets no calls.
+func (o *ProcessorOutcomes) Get(processor string) (float64, time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	outcome, ok := o.processors[processor]
+	if !ok {
+		return 0, 0
+	}
+	return outcome.decayedFailureRate(), outcome.decayedLatency()
+}
+
+func (o *processorOutcome) decayedFailureRate() float64 {
+	return o.failureRate * math.Pow(0.5, float64(time.Since(o.updatedAt))/float64(failureHalfLife))
+}
+
+func (o *processorOutcome) decayedLatency() time.Duration {
+	return time.Duration(float64(o.latency) * math.Pow(0.5, float64(time.Since(o.updatedAt))/float64(latencyHalfLife)))
+}
@@ -0,0 +1,83 @@
+package usecases
+
+import (
+	"payment-processor/core/models"
+	"testing"
+	"time"
+)
+
+func TestProcessorOutcomesMovingAverages(t *testing.T) {
+	outcomes := ProcessorOutcomes{processors: make(map[string]*processorOutcome)}
+	if rate, latency := outcomes.Get("default"); rate != 0 || latency != 0 {
+		t.Fatalf("unknown processor = %v, %v, want zero", rate, latency)
+	}
+
+	outcomes.Record("default", 100*time.Millisecond, false)
+	outcomes.Record("default", 200*time.Millisecond, true)
+	rate, latency := outcomes.Get("default")
+	if rate < 0.099 || rate > 0.1 {
+		t.Errorf("failure rate = %v, want about 0.1", rate)
+	}
+	if latency < 109*time.Millisecond || latency > 110*time.Millisecond {
+		t.Errorf("latency = %v, want about 110ms", latency)
+	}
+}
+
+func TestProcessorOutcomesDecayWithoutCalls(t *testing.T) {
+	outcomes := ProcessorOutcomes{processors: map[string]*processorOutcome{
+		"default": {failureRate: 1, latency: 4 * time.Second, updatedAt: time.Now().Add(-2 * failureHalfLife)},
+	}}
+	rate, latency := outcomes.Get("default")
+	if rate < 0.24 || rate > 0.25 {
+		t.Errorf("failure rate after two half-lives = %v, want about 0.25", rate)
+	}
+	if latency < 990*time.Millisecond || latency > time.Second {
+		t.Errorf("latency after two half-lives = %v, want about 1s", latency)
+	}
+
+	// A new call averages against the decayed values, not the stale ones.
+	outcomes.Record("default", 0, false)
+	if rate, _ := outcomes.Get("default"); rate > 0.25*(1-outcomeWeight) {
+		t.Errorf("failure rate after a success = %v", rate)
+	}
+}
+
+func TestMaxProfitRouting(t *testing.T) {
+	payment := models.Payment{CorrelationID: "4a7e2c1e-3f0e-4bd6-9c8e-1b2d3c4d5e6f", Amount: 1990}
+	tests := []struct {
+		name    string
+		penalty float64
+		adjust  func(state *models.ProcessorState)
+		want    string
+	}{
+		{"cheapest wins when both are healthy", 0, nil, "default"},
+		{"only healthy processor", 0, func(s *models.ProcessorState) { s.Processors[0].Failing = true }, "fallback"},
+		{"failure rate outweighs the fee", 0, func(s *models.ProcessorState) { s.Processors[0].FailureRate = 0.5 }, "fallback"},
+		{"small failure rate does not", 0, func(s *models.ProcessorState) { s.Processors[0].FailureRate = 0.05 }, "default"},
+		{"latency is priced in", 0.1, func(s *models.ProcessorState) { s.Processors[0].Latency = 2 * time.Second }, "fallback"},
+		{"latency is free without a penalty", 0, func(s *models.ProcessorState) { s.Processors[0].Latency = 2 * time.Second }, "default"},
+		{"ties go to the cheapest", 0, func(s *models.ProcessorState) { s.Processors[1].FeeRate = 0.05 }, "default"},
+	}
+	for _, tt := range tests {
+		state := processors(false, false)
+		if tt.adjust != nil {
+			tt.adjust(&state)
+		}
+		decision := MaxProfitRouting{LatencyPenalty: tt.penalty}.Route(payment, state)
+		if decision.Action != models.RouteDispatch || decision.Processor != tt.want {
+			t.Errorf("%s: got %+v, want dispatch to %s", tt.name, decision, tt.want)
+		}
+	}
+}
+
+func TestMaxProfitRoutingFloorsLatencyAtMinResponseTime(t *testing.T) {
+	// A decayed latency below the advertised minimum does not make a
+	// processor look faster than it can be.
+	state := processors(false, false)
+	state.Processors[0].MinResponseTime = 2000
+	state.Processors[0].Latency = time.Millisecond
+	payment := models.Payment{CorrelationID: "4a7e2c1e-3f0e-4bd6-9c8e-1b2d3c4d5e6f", Amount: 1990}
+	if decision := (MaxProfitRouting{LatencyPenalty: 0.1}).Route(payment, state); decision.Processor != "fallback" {
+		t.Errorf("got %+v, want dispatch to fallback", decision)
+	}
+}
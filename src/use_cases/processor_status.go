@@ -0,0 +1,211 @@
+package usecases
+
+import (
+	"encoding/json"
+	"fmt"
+	"payment-processor/config"
+	"payment-processor/core/models"
+	"payment-processor/interfaces"
+	"payment-processor/structs"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// ProcessorStatus is the process-wide view of the payment processors'
+// health. Workers read it once per message without locks or Redis round
+// trips; the health pollers update it and publish every new snapshot so the
+// other instances pick it up without polling Redis. Each processor is polled
+// by one instance, so snapshots are merged processor by processor, keeping
+// whichever status was checked last. Snapshots are never modified once
+// stored.
+type ProcessorStatus struct {
+	current atomic.Pointer[ProcessorStatusSnapshot]
+}
+
+type ProcessorStatusSnapshot struct {
+	Version int64 `json:"version"`
+	// UpdatedAt is the latest check of any processor.
+	UpdatedAt  time.Time                        `json:"updatedAt"`
+	Processors map[string]structs.ServiceStatus `json:"processors"`
+}
+
+var processorStatus ProcessorStatus
+
+func GetProcessorStatus() *ProcessorStatus {
+	return &processorStatus
+}
+
+// Load returns the latest snapshot, or nil before the first one arrived.
+func (p *ProcessorStatus) Load() *ProcessorStatusSnapshot {
+	return p.current.Load()
+}
+
+// Get returns the status of the processor called name. Missing or stale data
+// reports the processor as failing, so payments are deferred rather than
+// routed on a status nobody refreshed.
+func (p *ProcessorStatus) Get(name string) structs.ServiceStatus {
+	snapshot := p.current.Load()
+	if snapshot == nil {
+		return structs.ServiceStatus{Failing: true}
+	}
+	status := snapshot.Processors[name]
+	if time.Since(status.CheckedAt) > maxStatusAge() {
+		return structs.ServiceStatus{Failing: true, CheckedAt: status.CheckedAt}
+	}
+	return status
+}
+
+// State returns every registered processor's status for routing, with the
+// same stale handling as Get and processors whose circuit breaker refuses
+// calls reported as failing, their fees and their measured outcomes, cheapest
+// first and by priority on equal fees.
+func (p *ProcessorStatus) State() models.ProcessorState {
+	registry := config.LoadConfig().Processors
+	processors := make([]models.ProcessorHealth, len(registry))
+	for i, processor := range registry {
+		processors[i] = processorHealth(processor, p.Get(processor.Name))
+	}
+	sort.SliceStable(processors, func(i, j int) bool {
+		return processors[i].FeeRate < processors[j].FeeRate
+	})
+	return models.ProcessorState{Processors: processors}
+}
+
+func processorHealth(processor config.ProcessorConfig, status structs.ServiceStatus) models.ProcessorHealth {
+	failureRate, latency := GetProcessorOutcomes().Get(processor.Name)
+	return models.ProcessorHealth{
+		Name:            processor.Name,
+		Priority:        processor.Priority,
+		Failing:         status.Failing || !GetCircuitBreakers().Available(processor.Name),
+		MinResponseTime: status.MinResponseTime,
+		FeeRate:         processor.FeeRate,
+		FailureRate:     failureRate,
+		Latency:         latency,
+	}
+}
+
+func (s *ProcessorStatusSnapshot) Age() time.Duration {
+	return time.Since(s.UpdatedAt)
+}
+
+// Stale reports whether no processor was checked within
+// PROCESSOR_STATUS_MAX_AGE_MS.
+func (s *ProcessorStatusSnapshot) Stale() bool {
+	return s.Age() > maxStatusAge()
+}
+
+func maxStatusAge() time.Duration {
+	return time.Duration(config.LoadConfig().ProcessorStatusMaxAge) * time.Millisecond
+}
+
+// store merges snapshot into the held one, keeping the latest checked status
+// of each processor and the highest version, and reports whether anything
+// changed.
+func (p *ProcessorStatus) store(snapshot *ProcessorStatusSnapshot) bool {
+	for {
+		current := p.current.Load()
+		merged := &ProcessorStatusSnapshot{
+			Version:    snapshot.Version,
+			Processors: make(map[string]structs.ServiceStatus),
+		}
+		changed := current == nil
+		if current != nil {
+			merged.Version = max(current.Version, snapshot.Version)
+			changed = merged.Version != current.Version
+			for name, status := range current.Processors {
+				merged.Processors[name] = status
+			}
+		}
+		for name, status := range snapshot.Processors {
+			if held, ok := merged.Processors[name]; !ok || status.CheckedAt.After(held.CheckedAt) {
+				merged.Processors[name] = status
+				changed = true
+			}
+		}
+		if !changed {
+			return false
+		}
+		for _, status := range merged.Processors {
+			if status.CheckedAt.After(merged.UpdatedAt) {
+				merged.UpdatedAt = status.CheckedAt
+			}
+		}
+		if p.current.CompareAndSwap(current, merged) {
+			return true
+		}
+	}
+}
+
+// Publish records the result of a health poll of the processor called name.
+// Versions come from a shared counter so they are ordered across instances;
+// while the store is unreachable the result is only kept locally.
+func (p *ProcessorStatus) Publish(ctx context.Context, store interfaces.Store, name string, status structs.ServiceStatus) error {
+	config := config.LoadConfig()
+
+	status.CheckedAt = time.Now()
+	snapshot := &ProcessorStatusSnapshot{Processors: map[string]structs.ServiceStatus{name: status}}
+	version, err := store.Incr(ctx, config.RedisProcessorStatusKey+":version")
+	if err != nil {
+		p.store(snapshot)
+		return err
+	}
+	snapshot.Version = version
+	p.store(snapshot)
+
+	encoded, err := json.Marshal(p.current.Load())
+	if err != nil {
+		return fmt.Errorf("failed to encode processor status: %w", err)
+	}
+	return store.SetPublish(ctx, config.RedisProcessorStatusKey, config.ProcessorStatusChannel, string(encoded), maxStatusAge())
+}
+
+// Watch keeps the snapshot in sync with the other instances until ctx is
+// done: it applies every published snapshot and, in case a message was lost
+// while the subscription reconnected, reloads the stored one whenever the
+// local copy is half way to stale.
+func (p *ProcessorStatus) Watch(ctx context.Context, store interfaces.Store) {
+	config := config.LoadConfig()
+	maxAge := time.Duration(config.ProcessorStatusMaxAge) * time.Millisecond
+
+	messages := store.Subscribe(ctx, config.ProcessorStatusChannel)
+
+	p.refresh(ctx, store)
+	ticker := time.NewTicker(maxAge / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Println("ProcessorStatus: Context canceled, stopping execution")
+			return
+		case payload, ok := <-messages:
+			if !ok {
+				return
+			}
+			p.apply(payload)
+		case <-ticker.C:
+			if snapshot := p.current.Load(); snapshot == nil || snapshot.Age() > maxAge/2 {
+				p.refresh(ctx, store)
+			}
+		}
+	}
+}
+
+func (p *ProcessorStatus) refresh(ctx context.Context, store interfaces.Store) {
+	data, err := store.Get(ctx, config.LoadConfig().RedisProcessorStatusKey)
+	if err != nil || data == "" {
+		return
+	}
+	p.apply(data)
+}
+
+func (p *ProcessorStatus) apply(data string) {
+	var snapshot ProcessorStatusSnapshot
+	if err := json.Unmarshal([]byte(data), &snapshot); err != nil {
+		fmt.Println("ProcessorStatus: failed to decode snapshot:", err)
+		return
+	}
+	p.store(&snapshot)
+}
@@ -0,0 +1,80 @@
+package usecases
+
+import (
+	"payment-processor/config"
+	"payment-processor/infrastructure/repositories"
+	"payment-processor/interfaces"
+
+	"golang.org/x/net/context"
+)
+
+type PurgePaymentsUseCase struct {
+	Store interfaces.Store
+	Queue interfaces.Queue
+	Repo  *repositories.PaymentRepository
+}
+
+type PurgeResult struct {
+	StreamEntries     int64 `json:"streamEntries"`
+	ProcessedPayments int64 `json:"processedPayments"`
+	KeysDeleted       int64 `json:"keysDeleted"`
+	DatabaseRows      int64 `json:"databaseRows"`
+}
+
+func NewPurgePaymentsUseCase(store interfaces.Store, queue interfaces.Queue, repo *repositories.PaymentRepository) *PurgePaymentsUseCase {
+	return &PurgePaymentsUseCase{
+		Store: store,
+		Queue: queue,
+		Repo:  repo,
+	}
+}
+
+// Execute clears the shared state and the rinha table in one step: the table
+// is emptied in a transaction that only commits once the store was purged, so a
+// failure on either side leaves the rows in place and the purge can be retried.
+func (p *PurgePaymentsUseCase) Execute(ctx context.Context) (*PurgeResult, error) {
+	result := &PurgeResult{}
+	rows, err := p.Repo.DeleteAllPayments(ctx, func() error {
+		return p.purgeStore(ctx, result)
+	})
+	if err != nil {
+		return nil, err
+	}
+	result.DatabaseRows = rows
+	return result, nil
+}
+
+func (p *PurgePaymentsUseCase) purgeStore(ctx context.Context, result *PurgeResult) error {
+	config := config.LoadConfig()
+
+	streamEntries, err := p.Queue.Purge(ctx)
+	if err != nil {
+		return err
+	}
+
+	processed, keys, err := p.Store.PurgeSet(
+		ctx,
+		config.SetQueue,
+		config.RedisScoreKey,
+		config.Webhooks.ScheduleKey,
+		config.SetQueue+":compacted",
+	)
+	if err != nil {
+		return err
+	}
+
+	statuses, err := p.Store.DeleteByPattern(ctx, config.PaymentStatusPrefix+"*")
+	if err != nil {
+		return err
+	}
+
+	webhooks, err := p.Store.DeleteByPattern(ctx, config.Webhooks.KeyPrefix+"*")
+	if err != nil {
+		return err
+	}
+
+	result.StreamEntries = streamEntries
+	result.ProcessedPayments = processed
+	result.KeysDeleted = keys + statuses + webhooks
+	return nil
+}
@@ -2,47 +2,420 @@ package usecases
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"payment-processor/config"
 	"payment-processor/core/models"
 	"payment-processor/infrastructure"
+	"payment-processor/interfaces"
+	"strconv"
+	"time"
 
-	"github.com/redis/go-redis/v9"
 	"golang.org/x/net/context"
 )
 
+var ErrPaymentConflict = errors.New("payment already queued with a different amount")
+
+type EnqueueResult string
+
+const (
+	EnqueueAccepted  EnqueueResult = "accepted"
+	EnqueueDuplicate EnqueueResult = "duplicate"
+)
+
 type QueuePaymentsUseCase struct {
-	Redis *infrastructure.Redis
+	Store  interfaces.Store
+	Queue  interfaces.Queue
+	Status *PaymentStatusUseCase
 }
 
-func NewQueuePaymentsUseCase(redis *infrastructure.Redis) *QueuePaymentsUseCase {
+func NewQueuePaymentsUseCase(store interfaces.Store, queue interfaces.Queue, status *PaymentStatusUseCase) *QueuePaymentsUseCase {
 	return &QueuePaymentsUseCase{
-		Redis: redis,
+		Store:  store,
+		Queue:  queue,
+		Status: status,
 	}
 }
 
-func (u *QueuePaymentsUseCase) EnqueuePayment(ctx context.Context, queueName string, paymentData models.Payment) error {
-	var paymentMap = map[string]interface{}{
-		"correlationId": paymentData.CorrelationID,
-		"amount":        paymentData.Amount,
-		"requestedAt":   paymentData.RequestedAt,
+// EnqueuePayment adds the payment to the queue at most once per
+// correlationId within the configured idempotency window. Replays with the
+// same amount report EnqueueDuplicate; replays with another amount fail with
+// ErrPaymentConflict. When the queue is unreachable the payment is written to
+// the local spool instead and replayed later by ReplaySpool. Payments that
+// could not be queued or spooled fail with an *IntakeError.
+func (u *QueuePaymentsUseCase) EnqueuePayment(ctx context.Context, paymentData models.Payment) (EnqueueResult, error) {
+	result, err := u.enqueuePayment(ctx, paymentData)
+	intakeMetrics.record(result, err)
+	return result, err
+}
+
+func (u *QueuePaymentsUseCase) enqueuePayment(ctx context.Context, paymentData models.Payment) (EnqueueResult, error) {
+	if err := ValidatePayment(paymentData); err != nil {
+		return "", err
+	}
+	paymentData.Priority = derivePriority(paymentData)
+	if err := admission.Admit(paymentData.Priority); err != nil {
+		return "", err
+	}
+	if spool := infrastructure.GetSpool(); spool != nil && spool.Pending() {
+		return u.spoolPayment(paymentData, nil)
+	}
+	if memoryPressure.Active() {
+		return "", queueFullError()
 	}
 
-	err := u.Redis.XAdd(ctx, queueName, paymentMap)
+	result, err := u.enqueue(ctx, paymentData)
 	if err != nil {
-		fmt.Println("Error adding payment to queue:", err)
+		return u.spoolPayment(paymentData, classifyQueueError(err))
+	}
+
+	switch result {
+	case models.QueueAddDuplicate:
+		return EnqueueDuplicate, nil
+	case models.QueueAddConflict:
+		return "", ErrPaymentConflict
+	case models.QueueAddFull:
+		return "", queueFullError()
+	}
+
+	if err := u.Status.MarkQueued(ctx, paymentData); err != nil {
+		fmt.Println("Error tracking queued payment status:", err)
+	}
+	return EnqueueAccepted, nil
+}
+
+// EnqueuePayments is the batch form of EnqueuePayment: every payment is
+// deduplicated and handed to the queue in one call, a single pipelined round
+// trip on Redis. Results and errors are reported per payment, in input order.
+func (u *QueuePaymentsUseCase) EnqueuePayments(ctx context.Context, payments []models.Payment) ([]EnqueueResult, []error) {
+	config := config.LoadConfig()
+	results := make([]EnqueueResult, len(payments))
+	errs := make([]error, len(payments))
+	spool := infrastructure.GetSpool()
+	spooling := spool != nil && spool.Pending()
+
+	var (
+		items   []models.QueueItem
+		indexes []int
+	)
+	for i, paymentData := range payments {
+		if err := ValidatePayment(paymentData); err != nil {
+			errs[i] = err
+			continue
+		}
+		paymentData.Priority = derivePriority(paymentData)
+		if err := admission.Admit(paymentData.Priority); err != nil {
+			errs[i] = err
+			continue
+		}
+		if spooling {
+			results[i], errs[i] = u.spoolPayment(paymentData, nil)
+			continue
+		}
+		if memoryPressure.Active() {
+			errs[i] = queueFullError()
+			continue
+		}
+		items = append(items, queueItem(paymentData))
+		indexes = append(indexes, i)
+	}
+
+	var (
+		addResults []models.QueueAddResult
+		addErrs    []error
+	)
+	if len(items) > 0 {
+		addResults, addErrs = u.Queue.Enqueue(
+			ctx,
+			time.Duration(config.IdempotencyWindow)*time.Second,
+			int64(config.QueueMaxLength),
+			items,
+		)
+	}
+
+	var queued []models.Payment
+	for j, i := range indexes {
+		if addErrs[j] != nil {
+			results[i], errs[i] = u.spoolPayment(payments[i], classifyQueueError(addErrs[j]))
+			continue
+		}
+		switch addResults[j] {
+		case models.QueueAddDuplicate:
+			results[i] = EnqueueDuplicate
+		case models.QueueAddConflict:
+			errs[i] = ErrPaymentConflict
+		case models.QueueAddFull:
+			errs[i] = queueFullError()
+		default:
+			results[i] = EnqueueAccepted
+			queued = append(queued, payments[i])
+		}
+	}
+	for i := range payments {
+		intakeMetrics.record(results[i], errs[i])
+	}
+
+	if err := u.Status.MarkQueuedBatch(ctx, queued); err != nil {
+		fmt.Println("Error tracking queued payment statuses:", err)
+	}
+	return results, errs
+}
+
+// spoolPayment writes the payment to the local spool when the queue is
+// unavailable (queueErr is ErrQueueUnavailable) or when older spooled payments
+// still have to be replayed (queueErr is nil). Any other queueErr is returned
+// unchanged.
+func (u *QueuePaymentsUseCase) spoolPayment(paymentData models.Payment, queueErr error) (EnqueueResult, error) {
+	spool := infrastructure.GetSpool()
+	if spool == nil || (queueErr != nil && !errors.Is(queueErr, ErrQueueUnavailable)) {
+		return "", queueErr
+	}
+
+	err := spool.Append(infrastructure.SpoolRecord{Queue: config.LoadConfig().Queue, Payment: paymentData, Priority: paymentData.Priority})
+	if err != nil {
+		fmt.Println("Error spooling payment:", err)
+		if queueErr != nil {
+			return "", queueErr
+		}
+		return "", classifyQueueError(err)
+	}
+	intakeMetrics.Spooled.Add(1)
+	return EnqueueAccepted, nil
+}
+
+// spoolReplayMaxBackoff caps the wait after an interrupted spool replay, in
+// replay intervals.
+const spoolReplayMaxBackoff = 10
+
+// ReplaySpool drains the local spool into the queue whenever it is
+// reachable. Records go through the same idempotent enqueue as live intake, so
+// payments spooled twice during an outage are still queued only once. An
+// interrupted replay, such as on a full queue, is retried with backoff of up
+// to spoolReplayMaxBackoff replay intervals.
+func (u *QueuePaymentsUseCase) ReplaySpool(ctx context.Context) {
+	config := config.LoadConfig()
+	spool := infrastructure.GetSpool()
+	if spool == nil {
+		return
+	}
+
+	interval := time.Duration(config.SpoolReplayInterval) * time.Millisecond
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var (
+		failures  int
+		nextRetry time.Time
+	)
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Println("ReplaySpool: Context canceled, stopping execution")
+			return
+		case now := <-ticker.C:
+			if now.Before(nextRetry) || !spool.Pending() || u.Queue.Ping(ctx) != nil {
+				continue
+			}
+			replayed, err := spool.Replay(func(record infrastructure.SpoolRecord) error {
+				return u.replaySpoolRecord(ctx, record)
+			})
+			if replayed > 0 {
+				fmt.Printf("ReplaySpool: replayed %d spooled payments\n", replayed)
+			}
+			if err != nil {
+				failures++
+				delay := backoffDelay(interval, spoolReplayMaxBackoff*interval, failures)
+				nextRetry = now.Add(delay)
+				fmt.Printf("ReplaySpool: replay interrupted, retrying in %s: %v\n", delay, err)
+				continue
+			}
+			failures = 0
+		}
+	}
+}
+
+func (u *QueuePaymentsUseCase) replaySpoolRecord(ctx context.Context, record infrastructure.SpoolRecord) error {
+	paymentData := record.Payment
+	paymentData.Priority = record.Priority
+	result, err := u.enqueue(ctx, paymentData)
+	if err != nil {
+		return err
+	}
+
+	switch result {
+	case models.QueueAddFull:
+		return queueFullError()
+	case models.QueueAddConflict:
+		// Intake already answered 204 for it, so the client has to learn from
+		// the payment's status that it was not queued.
+		fmt.Printf("ReplaySpool: dropping payment %s, already queued with a different amount\n", paymentData.CorrelationID)
+		if err := u.Status.MarkSpoolConflict(ctx, paymentData); err != nil {
+			fmt.Println("Error tracking dropped spooled payment:", err)
+		}
+	case models.QueueAddAccepted:
+		if err := u.Status.MarkQueued(ctx, paymentData); err != nil {
+			fmt.Println("Error tracking queued payment status:", err)
+		}
 	}
 	return nil
 }
 
+func (u *QueuePaymentsUseCase) enqueue(ctx context.Context, paymentData models.Payment) (models.QueueAddResult, error) {
+	config := config.LoadConfig()
+	results, errs := u.Queue.Enqueue(
+		ctx,
+		time.Duration(config.IdempotencyWindow)*time.Second,
+		int64(config.QueueMaxLength),
+		[]models.QueueItem{queueItem(paymentData)},
+	)
+	return results[0], errs[0]
+}
+
 func (u *QueuePaymentsUseCase) StoreAsScore(ctx context.Context, queueName string, requestedAtFloat float64, paymentData models.Payment) error {
-	var err error
-	if paymentString, err := json.Marshal(paymentData); err == nil {
-		err := u.Redis.ZAdd(ctx, queueName, redis.Z{Score: requestedAtFloat, Member: string(paymentString)})
-		if err != nil {
-			fmt.Println("Error adding payment to sorted set:", err)
+	paymentString, err := json.Marshal(paymentData)
+	if err != nil {
+		return fmt.Errorf("failed to encode processed payment: %w", err)
+	}
+	if err := u.Store.ZAdd(ctx, queueName, requestedAtFloat, string(paymentString)); err != nil {
+		return fmt.Errorf("failed to add payment to sorted set: %w", err)
+	}
+	return nil
+}
+
+// ScheduleRetry acks a delivery and schedules it to be queued again after a
+// jittered exponential backoff based on how many times it was already
+// attempted or deferred. ReleaseRetries moves it back once due.
+func (u *QueuePaymentsUseCase) ScheduleRetry(ctx context.Context, message models.QueueMessage, entry models.QueuedPayment) (time.Time, error) {
+	config := config.LoadConfig()
+
+	nextAttempt := time.Now().Add(backoffDelay(
+		time.Duration(config.RetryBackoffBaseMs)*time.Millisecond,
+		time.Duration(config.RetryBackoffMaxMs)*time.Millisecond,
+		entry.Attempts+entry.Deferrals,
+	))
+	if err := u.Queue.Retry(ctx, message.ID, entryValues(message.Values, entry), nextAttempt); err != nil {
+		return time.Time{}, err
+	}
+	return nextAttempt, nil
+}
+
+// ReleaseRetries moves due retries back to the queue. Every instance runs
+// it; the move is atomic so each retry is released once.
+func (u *QueuePaymentsUseCase) ReleaseRetries(ctx context.Context) {
+	config := config.LoadConfig()
+
+	ticker := time.NewTicker(time.Duration(config.RetryPollInterval) * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Println("ReleaseRetries: Context canceled, stopping execution")
+			return
+		case <-ticker.C:
+			for {
+				moved, err := u.Queue.ReleaseDue(ctx, time.Now(), 100)
+				if err != nil {
+					fmt.Println("ReleaseRetries: failed to release due retries:", err)
+					break
+				}
+				if moved < 100 {
+					break
+				}
+			}
 		}
-		return nil
 	}
-	return err
+}
+
+func paymentValues(paymentData models.Payment) map[string]interface{} {
+	values := map[string]interface{}{
+		"correlationId": paymentData.CorrelationID,
+		"amount":        paymentData.Amount.String(),
+		"requestedAt":   paymentData.RequestedAt,
+	}
+	if paymentData.CallbackURL != "" {
+		values["callbackUrl"] = paymentData.CallbackURL
+	}
+	if priority := paymentData.Priority.Normalize(); priority != models.PriorityNormal {
+		values[models.QueueLaneField] = string(priority)
+	}
+	return values
+}
+
+// derivePriority returns the explicit priority of the payment or, without
+// one, the priority set by PRIORITY_HIGH_AMOUNT and PRIORITY_LOW_AMOUNT:
+// amounts at or above the first are high, amounts below the second are low.
+func derivePriority(paymentData models.Payment) models.Priority {
+	if paymentData.Priority != "" {
+		return paymentData.Priority
+	}
+	config := config.LoadConfig()
+	if high, err := models.ParseMoney(config.PriorityHighAmount); err == nil && paymentData.Amount >= high {
+		return models.PriorityHigh
+	}
+	if low, err := models.ParseMoney(config.PriorityLowAmount); err == nil && paymentData.Amount < low {
+		return models.PriorityLow
+	}
+	return models.PriorityNormal
+}
+
+func amountFingerprint(paymentData models.Payment) string {
+	return paymentData.Amount.String()
+}
+
+func queueItem(paymentData models.Payment) models.QueueItem {
+	return models.QueueItem{
+		Key:         config.LoadConfig().IdempotencyPrefix + paymentData.CorrelationID,
+		Fingerprint: amountFingerprint(paymentData),
+		Values:      paymentValues(paymentData),
+	}
+}
 
+// ParseQueuedPayment reads a queue message written by this use case. The
+// returned entry carries whatever fields could be read even on error.
+func ParseQueuedPayment(message models.QueueMessage) (models.QueuedPayment, error) {
+	entry := models.QueuedPayment{ID: message.ID}
+	entry.CorrelationID, _ = message.Values["correlationId"].(string)
+	entry.RequestedAt, _ = message.Values["requestedAt"].(string)
+	entry.CallbackURL, _ = message.Values["callbackUrl"].(string)
+	entry.DeadLetteredAt, _ = message.Values["deadLetteredAt"].(string)
+	if priority, ok := message.Values[models.QueueLaneField].(string); ok {
+		entry.Priority = models.Priority(priority)
+	}
+	if attempts, ok := message.Values["attempts"].(string); ok {
+		entry.Attempts, _ = strconv.Atoi(attempts)
+	}
+	if deferrals, ok := message.Values["deferrals"].(string); ok {
+		entry.Deferrals, _ = strconv.Atoi(deferrals)
+	}
+	if reasons, ok := message.Values["reasons"].(string); ok {
+		json.Unmarshal([]byte(reasons), &entry.Reasons)
+	}
+
+	amount, _ := message.Values["amount"].(string)
+	amountMoney, err := models.ParseMoney(amount)
+	if err != nil {
+		return entry, fmt.Errorf("invalid amount %q for payment %s: %w", amount, entry.CorrelationID, err)
+	}
+	entry.Amount = amountMoney
+	return entry, nil
+}
+
+// entryValues copies the fields of a queue message, as received, with the
+// delivery history of entry. Fields are copied verbatim so a malformed entry
+// keeps its original values.
+func entryValues(values map[string]interface{}, entry models.QueuedPayment) map[string]interface{} {
+	copied := make(map[string]interface{}, len(values)+3)
+	for field, value := range values {
+		copied[field] = value
+	}
+	delete(copied, "reasons")
+	delete(copied, "deferrals")
+	copied["attempts"] = entry.Attempts
+	if entry.Deferrals > 0 {
+		copied["deferrals"] = entry.Deferrals
+	}
+	if len(entry.Reasons) > 0 {
+		encoded, _ := json.Marshal(entry.Reasons)
+		copied["reasons"] = string(encoded)
+	}
+	return copied
 }
@@ -0,0 +1,99 @@
+package usecases
+
+import (
+	"fmt"
+	"payment-processor/config"
+	"payment-processor/interfaces"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+const compactBatchSize = 1000
+
+// RetentionUseCase keeps the store's footprint bounded: it has the queue
+// release acknowledged messages and cap its dead letters, has the store drop
+// expired keys, and folds old processed payments into per-second buckets the
+// summary can still sum, which keeps Redis under maxmemory with noeviction.
+type RetentionUseCase struct {
+	Store interfaces.Store
+	Queue interfaces.Queue
+}
+
+func NewRetentionUseCase(store interfaces.Store, queue interfaces.Queue) *RetentionUseCase {
+	return &RetentionUseCase{
+		Store: store,
+		Queue: queue,
+	}
+}
+
+func (r *RetentionUseCase) Execute(ctx context.Context) {
+	config := config.LoadConfig()
+
+	ticker := time.NewTicker(time.Duration(config.RetentionInterval) * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Println("RetentionUseCase: Context canceled, stopping execution")
+			return
+		case t := <-ticker.C:
+			r.enforce(ctx, t)
+		}
+	}
+}
+
+func (r *RetentionUseCase) enforce(ctx context.Context, t time.Time) {
+	config := config.LoadConfig()
+
+	if err := r.Queue.Trim(ctx, int64(config.DQLMaxLength)); err != nil {
+		fmt.Println("RetentionUseCase: failed to trim payments queue:", err)
+	}
+	if err := r.Store.Trim(ctx); err != nil {
+		fmt.Println("RetentionUseCase: failed to trim expired keys:", err)
+	}
+
+	if boundary, ok := r.compactionBoundary(ctx, t); ok {
+		for {
+			folded, err := r.Store.ZCompact(ctx, config.SetQueue, config.SetQueue+":compacted", boundary, compactBatchSize)
+			if err != nil {
+				fmt.Println("RetentionUseCase: failed to compact processed payments:", err)
+				break
+			}
+			if folded < compactBatchSize {
+				break
+			}
+		}
+	}
+
+	if config.SummaryRetention > 0 {
+		before := t.Add(-time.Duration(config.SummaryRetention) * time.Second)
+		if _, err := r.Store.ZRemRangeBefore(ctx, config.SetQueue, before); err != nil {
+			fmt.Println("RetentionUseCase: failed to expire processed payments:", err)
+		}
+	}
+}
+
+// compactionBoundary returns the time before which processed payments may be
+// folded. When payments are persisted to the database, members the persister
+// has not copied yet are left alone.
+func (r *RetentionUseCase) compactionBoundary(ctx context.Context, t time.Time) (time.Time, bool) {
+	config := config.LoadConfig()
+	if config.SummaryCompactAfter <= 0 {
+		return time.Time{}, false
+	}
+	boundary := t.Add(-time.Duration(config.SummaryCompactAfter) * time.Second)
+
+	if config.ShouldPersistInDB {
+		val, _ := r.Store.Get(ctx, config.RedisScoreKey)
+		persisted, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return time.Time{}, false
+		}
+		if persistedAt := time.Unix(int64(persisted), 0); persistedAt.Before(boundary) {
+			boundary = persistedAt
+		}
+	}
+	return boundary, true
+}
@@ -0,0 +1,211 @@
+package usecases
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"payment-processor/config"
+	"payment-processor/core/models"
+	"payment-processor/interfaces"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NewRoutingStrategy returns the built-in strategy called name, as set by
+// ROUTING_STRATEGY.
+func NewRoutingStrategy(name string) (interfaces.RoutingStrategy, error) {
+	switch name {
+	case "max-profit", "":
+		return MaxProfitRouting{LatencyPenalty: config.LoadConfig().RoutingLatencyPenalty}, nil
+	case "lowest-latency":
+		return LowestLatencyRouting{}, nil
+	case "cheapest-healthy":
+		return CheapestHealthyRouting{}, nil
+	case "default-unless-down":
+		return DefaultUnlessDownRouting{}, nil
+	case "weighted-split":
+		weights, err := parseRoutingWeights(config.LoadConfig().RoutingWeights)
+		if err != nil {
+			return nil, err
+		}
+		return WeightedSplitRouting{Weights: weights}, nil
+	default:
+		return nil, fmt.Errorf("unknown routing strategy %q, expected max-profit, lowest-latency, cheapest-healthy, default-unless-down or weighted-split", name)
+	}
+}
+
+// MaxProfitRouting sends every payment to the healthy processor with the
+// highest expected value: the amount it keeps after the fee, weighted by the
+// chance the call succeeds, minus LatencyPenalty of the amount for every
+// second the call is expected to take. A pricier processor has to beat the
+// cheaper ones outright, ties go to the cheapest.
+type MaxProfitRouting struct {
+	LatencyPenalty float64
+}
+
+func (MaxProfitRouting) Name() string { return "max-profit" }
+
+func (r MaxProfitRouting) Route(payment models.Payment, state models.ProcessorState) models.RoutingDecision {
+	var (
+		best      *models.ProcessorHealth
+		bestValue float64
+		runnerUp  = math.Inf(-1)
+	)
+	for i, processor := range state.Processors {
+		if processor.Failing {
+			continue
+		}
+		value := r.expectedValue(payment, processor)
+		if best == nil || value > bestValue {
+			if best != nil {
+				runnerUp = bestValue
+			}
+			best, bestValue = &state.Processors[i], value
+		} else if value > runnerUp {
+			runnerUp = value
+		}
+	}
+	if best == nil {
+		return allFailing()
+	}
+	if math.IsInf(runnerUp, -1) {
+		return dispatch(best.Name, fmt.Sprintf("only healthy processor, expected value %.2f", bestValue/100))
+	}
+	return dispatch(best.Name, fmt.Sprintf("expected value %.2f against %.2f", bestValue/100, runnerUp/100))
+}
+
+// expectedValue is in cents.
+func (r MaxProfitRouting) expectedValue(payment models.Payment, processor models.ProcessorHealth) float64 {
+	amount := float64(payment.Amount.Cents())
+	latency := max(time.Duration(processor.MinResponseTime)*time.Millisecond, processor.Latency)
+	return amount*(1-processor.FeeRate)*(1-processor.FailureRate) - amount*r.LatencyPenalty*latency.Seconds()
+}
+
+// LowestLatencyRouting sends every payment to the healthy processor with the
+// lowest advertised minimum response time, the cheapest one on ties.
+type LowestLatencyRouting struct{}
+
+func (LowestLatencyRouting) Name() string { return "lowest-latency" }
+
+func (LowestLatencyRouting) Route(payment models.Payment, state models.ProcessorState) models.RoutingDecision {
+	var best *models.ProcessorHealth
+	for i, processor := range state.Processors {
+		if !processor.Failing && (best == nil || processor.MinResponseTime < best.MinResponseTime) {
+			best = &state.Processors[i]
+		}
+	}
+	if best == nil {
+		return allFailing()
+	}
+	return dispatch(best.Name, fmt.Sprintf("lowest minResponseTime %dms", best.MinResponseTime))
+}
+
+// CheapestHealthyRouting sends every payment to the cheapest processor that is
+// not failing, whatever its latency.
+type CheapestHealthyRouting struct{}
+
+func (CheapestHealthyRouting) Name() string { return "cheapest-healthy" }
+
+func (CheapestHealthyRouting) Route(payment models.Payment, state models.ProcessorState) models.RoutingDecision {
+	for i, processor := range state.Processors {
+		if !processor.Failing {
+			return dispatch(processor.Name, fmt.Sprintf("cheapest healthy processor, %d cheaper ones failing", i))
+		}
+	}
+	return allFailing()
+}
+
+// DefaultUnlessDownRouting sends every payment to the processor with the
+// highest priority, default out of the box, and only uses another one while
+// it is failing: the healthy one with the highest priority.
+type DefaultUnlessDownRouting struct{}
+
+func (DefaultUnlessDownRouting) Name() string { return "default-unless-down" }
+
+func (DefaultUnlessDownRouting) Route(payment models.Payment, state models.ProcessorState) models.RoutingDecision {
+	var primary, standby *models.ProcessorHealth
+	for i, processor := range state.Processors {
+		if primary == nil || processor.Priority < primary.Priority {
+			primary = &state.Processors[i]
+		}
+		if !processor.Failing && (standby == nil || processor.Priority < standby.Priority) {
+			standby = &state.Processors[i]
+		}
+	}
+	if standby == nil {
+		return allFailing()
+	}
+	if standby == primary {
+		return dispatch(primary.Name, primary.Name+" is up")
+	}
+	return dispatch(standby.Name, primary.Name+" is failing")
+}
+
+// WeightedSplitRouting spreads payments over the healthy processors in
+// proportion to their weight, set by ROUTING_WEIGHTS. A payment always lands
+// on the same processor for the same set of healthy ones, since the split
+// hashes its correlationId. Processors without a weight only get payments
+// while every weighted one is failing.
+type WeightedSplitRouting struct {
+	Weights map[string]int
+}
+
+func (WeightedSplitRouting) Name() string { return "weighted-split" }
+
+func (r WeightedSplitRouting) Route(payment models.Payment, state models.ProcessorState) models.RoutingDecision {
+	total := 0
+	var unweighted *models.ProcessorHealth
+	for i, processor := range state.Processors {
+		if processor.Failing {
+			continue
+		}
+		total += r.Weights[processor.Name]
+		if unweighted == nil {
+			unweighted = &state.Processors[i]
+		}
+	}
+	if unweighted == nil {
+		return allFailing()
+	}
+	if total == 0 {
+		return dispatch(unweighted.Name, "every weighted processor is failing")
+	}
+
+	hash := fnv.New32a()
+	hash.Write([]byte(payment.CorrelationID))
+	point := int(hash.Sum32() % uint32(total))
+	for _, processor := range state.Processors {
+		if processor.Failing {
+			continue
+		}
+		weight := r.Weights[processor.Name]
+		if point < weight {
+			return dispatch(processor.Name, fmt.Sprintf("weighted split, %d of %d", weight, total))
+		}
+		point -= weight
+	}
+	return dispatch(unweighted.Name, "weighted split")
+}
+
+func dispatch(processor, reason string) models.RoutingDecision {
+	return models.RoutingDecision{Action: models.RouteDispatch, Processor: processor, Reason: reason}
+}
+
+func allFailing() models.RoutingDecision {
+	return models.RoutingDecision{Action: models.RouteRetryLater, Reason: "all payment processors are failing"}
+}
+
+// parseRoutingWeights reads ROUTING_WEIGHTS entries such as "default:3".
+func parseRoutingWeights(entries []string) (map[string]int, error) {
+	weights := make(map[string]int)
+	for _, entry := range entries {
+		name, rawWeight, _ := strings.Cut(entry, ":")
+		weight, err := strconv.Atoi(rawWeight)
+		if name == "" || err != nil || weight < 0 {
+			return nil, fmt.Errorf("invalid routing weight %q, expected <processor>:<weight>", entry)
+		}
+		weights[name] = weight
+	}
+	return weights, nil
+}
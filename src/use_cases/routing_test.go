@@ -0,0 +1,102 @@
+package usecases
+
+import (
+	"fmt"
+	"payment-processor/core/models"
+	"payment-processor/interfaces"
+	"reflect"
+	"testing"
+)
+
+// processors lists default and fallback the way routing sees them: cheapest
+// first.
+func processors(defaultFailing, fallbackFailing bool) models.ProcessorState {
+	return models.ProcessorState{Processors: []models.ProcessorHealth{
+		{Name: "default", Priority: 0, Failing: defaultFailing, MinResponseTime: 100, FeeRate: 0.05},
+		{Name: "fallback", Priority: 1, Failing: fallbackFailing, MinResponseTime: 10, FeeRate: 0.15},
+	}}
+}
+
+func TestRoutingStrategies(t *testing.T) {
+	payment := models.Payment{CorrelationID: "4a7e2c1e-3f0e-4bd6-9c8e-1b2d3c4d5e6f", Amount: 1990}
+	tests := []struct {
+		strategy interfaces.RoutingStrategy
+		state    models.ProcessorState
+		want     string
+	}{
+		{LowestLatencyRouting{}, processors(false, false), "fallback"},
+		{LowestLatencyRouting{}, processors(false, true), "default"},
+		{CheapestHealthyRouting{}, processors(false, false), "default"},
+		{CheapestHealthyRouting{}, processors(true, false), "fallback"},
+		{DefaultUnlessDownRouting{}, processors(false, false), "default"},
+		{DefaultUnlessDownRouting{}, processors(true, false), "fallback"},
+		{WeightedSplitRouting{Weights: map[string]int{"fallback": 1}}, processors(false, false), "fallback"},
+		{WeightedSplitRouting{Weights: map[string]int{"fallback": 1}}, processors(false, true), "default"},
+	}
+	for _, tt := range tests {
+		decision := tt.strategy.Route(payment, tt.state)
+		if decision.Action != models.RouteDispatch || decision.Processor != tt.want {
+			t.Errorf("%s on %+v = %+v, want dispatch to %s", tt.strategy.Name(), tt.state.Processors, decision, tt.want)
+		}
+	}
+}
+
+func TestRoutingStrategiesAllFailing(t *testing.T) {
+	payment := models.Payment{CorrelationID: "4a7e2c1e-3f0e-4bd6-9c8e-1b2d3c4d5e6f", Amount: 1990}
+	strategies := []interfaces.RoutingStrategy{
+		MaxProfitRouting{},
+		LowestLatencyRouting{},
+		CheapestHealthyRouting{},
+		DefaultUnlessDownRouting{},
+		WeightedSplitRouting{Weights: map[string]int{"default": 1}},
+	}
+	for _, strategy := range strategies {
+		if decision := strategy.Route(payment, processors(true, true)); decision.Action != models.RouteRetryLater {
+			t.Errorf("%s with every processor failing = %+v, want retry", strategy.Name(), decision)
+		}
+	}
+}
+
+func TestWeightedSplitRouting(t *testing.T) {
+	strategy := WeightedSplitRouting{Weights: map[string]int{"default": 3, "fallback": 1}}
+	state := processors(false, false)
+	counts := make(map[string]int)
+	for i := 0; i < 4000; i++ {
+		payment := models.Payment{CorrelationID: fmt.Sprintf("payment-%d", i), Amount: 1990}
+		decision := strategy.Route(payment, state)
+		counts[decision.Processor]++
+		if again := strategy.Route(payment, state); again.Processor != decision.Processor {
+			t.Fatalf("payment-%d went to %s, then %s", i, decision.Processor, again.Processor)
+		}
+	}
+	if share := float64(counts["default"]) / 4000; share < 0.7 || share > 0.8 {
+		t.Errorf("default got %.2f of the payments, want about 0.75 (%v)", share, counts)
+	}
+}
+
+func TestParseRoutingWeights(t *testing.T) {
+	weights, err := parseRoutingWeights([]string{"default:3", "fallback:0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int{"default": 3, "fallback": 0}; !reflect.DeepEqual(weights, want) {
+		t.Errorf("got %v, want %v", weights, want)
+	}
+	for _, entry := range []string{"default", ":3", "default:x", "default:-1"} {
+		if _, err := parseRoutingWeights([]string{entry}); err == nil {
+			t.Errorf("parseRoutingWeights accepted %q", entry)
+		}
+	}
+}
+
+func TestNewRoutingStrategy(t *testing.T) {
+	for _, name := range []string{"lowest-latency", "cheapest-healthy", "default-unless-down"} {
+		strategy, err := NewRoutingStrategy(name)
+		if err != nil || strategy.Name() != name {
+			t.Errorf("NewRoutingStrategy(%q) = %v, %v", name, strategy, err)
+		}
+	}
+	if _, err := NewRoutingStrategy("round-robin"); err == nil {
+		t.Error("NewRoutingStrategy accepted an unknown strategy")
+	}
+}
@@ -0,0 +1,230 @@
+package usecases
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"payment-processor/config"
+	"payment-processor/core/models"
+	"payment-processor/interfaces"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+var ErrWebhookNotFound = errors.New("webhook delivery not found")
+
+const (
+	webhookClaimLease = 30 * time.Second
+	webhookLogSize    = 20
+)
+
+// WebhookUseCase keeps the delivery record, schedule and log of completion
+// webhooks. Deliveries live in a hash per correlationId and are scheduled in
+// a sorted set scored by next attempt time; the HTTP calls themselves are
+// made by workers.WebhookDispatcher.
+type WebhookUseCase struct {
+	Store interfaces.Store
+}
+
+func NewWebhookUseCase(store interfaces.Store) *WebhookUseCase {
+	return &WebhookUseCase{
+		Store: store,
+	}
+}
+
+// Notify schedules an immediate delivery of the final outcome of payment. It
+// is a no-op for payments without a callbackUrl or while webhooks are disabled.
+func (w *WebhookUseCase) Notify(ctx context.Context, payment models.Payment, state models.PaymentState, reason string) error {
+	if payment.CallbackURL == "" || !config.LoadConfig().Webhooks.Enabled() {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	payload, err := json.Marshal(models.WebhookNotification{
+		CorrelationID: payment.CorrelationID,
+		Processor:     payment.Type,
+		Amount:        payment.Amount,
+		Status:        state,
+		Reason:        reason,
+		RequestedAt:   payment.RequestedAt,
+		CompletedAt:   now.Format(time.RFC3339Nano),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook notification: %w", err)
+	}
+
+	err = w.Store.HUpdate(ctx, w.deliveryKey(payment.CorrelationID), map[string]interface{}{
+		"url":       payment.CallbackURL,
+		"payload":   string(payload),
+		"state":     string(models.WebhookPending),
+		"attempts":  0,
+		"createdAt": now.Format(time.RFC3339Nano),
+		"updatedAt": now.Format(time.RFC3339Nano),
+	}, nil, w.retention())
+	if err != nil {
+		return err
+	}
+	return w.schedule(ctx, payment.CorrelationID, now)
+}
+
+// ClaimDue leases up to count deliveries whose next attempt is due. A claimed
+// delivery that is not recorded within the lease becomes due again.
+func (w *WebhookUseCase) ClaimDue(ctx context.Context, count int64) ([]models.WebhookDelivery, error) {
+	config := config.LoadConfig()
+	ids, err := w.Store.ZClaimDue(ctx, config.Webhooks.ScheduleKey, time.Now(), webhookClaimLease, count)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := make([]models.WebhookDelivery, 0, len(ids))
+	for _, id := range ids {
+		delivery, err := w.load(ctx, id)
+		if errors.Is(err, ErrWebhookNotFound) || (err == nil && delivery.State != models.WebhookPending) {
+			w.Store.ZRem(ctx, config.Webhooks.ScheduleKey, id)
+			continue
+		}
+		if err != nil {
+			return deliveries, err
+		}
+		deliveries = append(deliveries, *delivery)
+	}
+	return deliveries, nil
+}
+
+// RecordAttempt logs one delivery attempt and either completes the delivery
+// or schedules the next attempt with jittered exponential backoff.
+func (w *WebhookUseCase) RecordAttempt(ctx context.Context, delivery models.WebhookDelivery, statusCode int, sendErr error, duration time.Duration) error {
+	config := config.LoadConfig()
+	now := time.Now().UTC()
+	attempt := delivery.Attempts + 1
+
+	entry := models.WebhookAttempt{
+		Attempt:    attempt,
+		At:         now.Format(time.RFC3339Nano),
+		StatusCode: statusCode,
+		DurationMs: duration.Milliseconds(),
+	}
+	if sendErr != nil {
+		entry.Error = sendErr.Error()
+	}
+	logEntry, _ := json.Marshal(entry)
+	if err := w.Store.LPushTrim(ctx, w.logKey(delivery.CorrelationID), string(logEntry), webhookLogSize, w.retention()); err != nil {
+		return err
+	}
+
+	values := map[string]interface{}{
+		"attempts":       attempt,
+		"lastStatusCode": statusCode,
+		"lastError":      entry.Error,
+		"updatedAt":      entry.At,
+		"nextAttemptAt":  "",
+	}
+	var next time.Time
+	switch {
+	case sendErr == nil:
+		values["state"] = string(models.WebhookDelivered)
+	case attempt >= config.Webhooks.MaxAttempts, errors.Is(sendErr, ErrCallbackForbidden):
+		values["state"] = string(models.WebhookFailed)
+	default:
+		next = now.Add(backoffDelay(
+			time.Duration(config.Webhooks.BackoffBaseMs)*time.Millisecond,
+			time.Duration(config.Webhooks.BackoffMaxMs)*time.Millisecond,
+			attempt,
+		))
+		values["nextAttemptAt"] = next.Format(time.RFC3339Nano)
+	}
+
+	if err := w.Store.HUpdate(ctx, w.deliveryKey(delivery.CorrelationID), values, nil, w.retention()); err != nil {
+		return err
+	}
+	if next.IsZero() {
+		return w.Store.ZRem(ctx, config.Webhooks.ScheduleKey, delivery.CorrelationID)
+	}
+	return w.schedule(ctx, delivery.CorrelationID, next)
+}
+
+func (w *WebhookUseCase) Get(ctx context.Context, correlationID string) (*models.WebhookDelivery, error) {
+	delivery, err := w.load(ctx, correlationID)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := w.Store.LRange(ctx, w.logKey(correlationID), 0, webhookLogSize-1)
+	if err != nil {
+		return nil, err
+	}
+	for _, raw := range entries {
+		var entry models.WebhookAttempt
+		if json.Unmarshal([]byte(raw), &entry) == nil {
+			delivery.Log = append(delivery.Log, entry)
+		}
+	}
+	return delivery, nil
+}
+
+// Resend restarts delivery of an existing notification with a fresh attempt
+// budget, whatever its current state.
+func (w *WebhookUseCase) Resend(ctx context.Context, correlationID string) (*models.WebhookDelivery, error) {
+	if _, err := w.load(ctx, correlationID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	err := w.Store.HUpdate(ctx, w.deliveryKey(correlationID), map[string]interface{}{
+		"state":         string(models.WebhookPending),
+		"attempts":      0,
+		"nextAttemptAt": now.Format(time.RFC3339Nano),
+		"updatedAt":     now.Format(time.RFC3339Nano),
+	}, nil, w.retention())
+	if err != nil {
+		return nil, err
+	}
+	if err := w.schedule(ctx, correlationID, now); err != nil {
+		return nil, err
+	}
+	return w.Get(ctx, correlationID)
+}
+
+func (w *WebhookUseCase) load(ctx context.Context, correlationID string) (*models.WebhookDelivery, error) {
+	values, err := w.Store.HGetAll(ctx, w.deliveryKey(correlationID))
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, ErrWebhookNotFound
+	}
+
+	attempts, _ := strconv.Atoi(values["attempts"])
+	statusCode, _ := strconv.Atoi(values["lastStatusCode"])
+	return &models.WebhookDelivery{
+		CorrelationID:  correlationID,
+		URL:            values["url"],
+		Payload:        values["payload"],
+		State:          models.WebhookDeliveryState(values["state"]),
+		Attempts:       attempts,
+		LastStatusCode: statusCode,
+		LastError:      values["lastError"],
+		NextAttemptAt:  values["nextAttemptAt"],
+		CreatedAt:      values["createdAt"],
+		UpdatedAt:      values["updatedAt"],
+	}, nil
+}
+
+func (w *WebhookUseCase) schedule(ctx context.Context, correlationID string, at time.Time) error {
+	score := float64(at.UnixNano()) / 1e9
+	return w.Store.ZAdd(ctx, config.LoadConfig().Webhooks.ScheduleKey, score, correlationID)
+}
+
+func (w *WebhookUseCase) deliveryKey(correlationID string) string {
+	return config.LoadConfig().Webhooks.KeyPrefix + correlationID
+}
+
+func (w *WebhookUseCase) logKey(correlationID string) string {
+	return config.LoadConfig().Webhooks.KeyPrefix + correlationID + ":log"
+}
+
+func (w *WebhookUseCase) retention() time.Duration {
+	return time.Duration(config.LoadConfig().Webhooks.RetentionSecs) * time.Second
+}
@@ -0,0 +1,80 @@
+package usecases
+
+import (
+	"errors"
+	"fmt"
+	"payment-processor/config"
+	"payment-processor/core/models"
+	"payment-processor/infrastructure"
+	"slices"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func claimWebhook(t *testing.T, w *WebhookUseCase, correlationID string) models.WebhookDelivery {
+	t.Helper()
+	ctx := context.Background()
+	payment := models.Payment{CorrelationID: correlationID, Amount: 1990, Type: "default", CallbackURL: "https://hooks.example.com/payments"}
+	if err := w.Notify(ctx, payment, models.ProcessedState("default"), ""); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	deliveries, err := w.ClaimDue(ctx, 100)
+	if err != nil {
+		t.Fatalf("ClaimDue: %v", err)
+	}
+	for _, delivery := range deliveries {
+		if delivery.CorrelationID == correlationID {
+			return delivery
+		}
+	}
+	t.Fatalf("delivery %s was not claimed", correlationID)
+	return models.WebhookDelivery{}
+}
+
+func TestWebhookRecordAttempt(t *testing.T) {
+	ctx := context.Background()
+	w := NewWebhookUseCase(infrastructure.NewRedis())
+	maxAttempts := config.LoadConfig().Webhooks.MaxAttempts
+	failed := errors.New("webhook receiver responded with status code: 503")
+
+	tests := []struct {
+		name      string
+		attempts  int
+		status    int
+		err       error
+		want      models.WebhookDeliveryState
+		scheduled bool
+	}{
+		{"success", 0, 200, nil, models.WebhookDelivered, false},
+		{"failure is retried", 0, 503, failed, models.WebhookPending, true},
+		{"last attempt fails for good", maxAttempts - 1, 503, failed, models.WebhookFailed, false},
+		{"forbidden host is not retried", 0, 0, fmt.Errorf("%w: 10.0.0.1", ErrCallbackForbidden), models.WebhookFailed, false},
+	}
+	for i, tt := range tests {
+		delivery := claimWebhook(t, w, fmt.Sprintf("webhook-%d", i))
+		delivery.Attempts = tt.attempts
+		if err := w.RecordAttempt(ctx, delivery, tt.status, tt.err, 20*time.Millisecond); err != nil {
+			t.Fatalf("%s: RecordAttempt: %v", tt.name, err)
+		}
+
+		got, err := w.Get(ctx, delivery.CorrelationID)
+		if err != nil {
+			t.Fatalf("%s: Get: %v", tt.name, err)
+		}
+		if got.State != tt.want || got.Attempts != tt.attempts+1 || got.LastStatusCode != tt.status {
+			t.Errorf("%s: state %s after %d attempts (last status %d), want %s after %d", tt.name, got.State, got.Attempts, got.LastStatusCode, tt.want, tt.attempts+1)
+		}
+		if len(got.Log) != 1 || got.Log[0].Attempt != tt.attempts+1 || (tt.err != nil) != (got.Log[0].Error != "") {
+			t.Errorf("%s: log = %+v", tt.name, got.Log)
+		}
+		if scheduled := got.NextAttemptAt != ""; scheduled != tt.scheduled {
+			t.Errorf("%s: nextAttemptAt = %q, want scheduled %v", tt.name, got.NextAttemptAt, tt.scheduled)
+		}
+		scheduled, _ := miniRedis.ZMembers(config.LoadConfig().Webhooks.ScheduleKey)
+		if slices.Contains(scheduled, delivery.CorrelationID) != tt.scheduled {
+			t.Errorf("%s: schedule = %v, want it scheduled %v", tt.name, scheduled, tt.scheduled)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package usecases
+
+import (
+	"sync"
+	"time"
+)
+
+const maxScalingDecisions = 50
+
+// WorkerScaling is the process-wide record of the worker pool's size and of
+// the autoscaler's recent decisions, kept for GET /workers.
+type WorkerScaling struct {
+	mu        sync.Mutex
+	current   WorkerScalingSnapshot
+	decisions []ScalingDecision
+}
+
+type ScalingDecision struct {
+	At        time.Time `json:"at"`
+	From      int       `json:"from"`
+	To        int       `json:"to"`
+	Lag       int64     `json:"lag"`
+	Pending   int64     `json:"pending"`
+	LatencyMs float64   `json:"latencyMs"`
+	Reason    string    `json:"reason"`
+}
+
+type WorkerScalingSnapshot struct {
+	Workers   int               `json:"workers"`
+	Min       int               `json:"min"`
+	Max       int               `json:"max"`
+	Lag       int64             `json:"lag"`
+	Pending   int64             `json:"pending"`
+	LatencyMs float64           `json:"latencyMs"`
+	UpdatedAt time.Time         `json:"updatedAt"`
+	Decisions []ScalingDecision `json:"decisions"`
+}
+
+var workerScaling WorkerScaling
+
+func GetWorkerScaling() *WorkerScaling {
+	return &workerScaling
+}
+
+// Update records the pool size and the signals it was sized on.
+func (w *WorkerScaling) Update(workers, min, max int, lag, pending int64, latency time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.current = WorkerScalingSnapshot{
+		Workers:   workers,
+		Min:       min,
+		Max:       max,
+		Lag:       lag,
+		Pending:   pending,
+		LatencyMs: float64(latency) / float64(time.Millisecond),
+		UpdatedAt: time.Now(),
+	}
+}
+
+// Record keeps decision among the last maxScalingDecisions.
+func (w *WorkerScaling) Record(decision ScalingDecision) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.decisions = append(w.decisions, decision)
+	if len(w.decisions) > maxScalingDecisions {
+		w.decisions = w.decisions[len(w.decisions)-maxScalingDecisions:]
+	}
+}
+
+// Snapshot returns the current state with decisions newest first.
+func (w *WorkerScaling) Snapshot() WorkerScalingSnapshot {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	snapshot := w.current
+	snapshot.Decisions = make([]ScalingDecision, len(w.decisions))
+	for i, decision := range w.decisions {
+		snapshot.Decisions[len(w.decisions)-1-i] = decision
+	}
+	return snapshot
+}
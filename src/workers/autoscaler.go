@@ -0,0 +1,134 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"payment-processor/config"
+	"payment-processor/infrastructure/queues"
+	usecases "payment-processor/use_cases"
+	"time"
+)
+
+// latencyWeight is the weight of the newest sample in the processor latency
+// moving average.
+const latencyWeight = 0.2
+
+// autoscale resizes the pool every AUTOSCALE_INTERVAL_MS so this instance's
+// share of the backlog (consumer lag plus pending deliveries) drains within
+// AUTOSCALE_DRAIN_TARGET_MS at the observed processor latency. It grows
+// straight to the target and shrinks by half the gap per interval, so a short
+// lull does not drop the workers a returning burst needs.
+func (swp *StreamWorkerPool) autoscale(ctx context.Context) {
+	config := config.LoadConfig()
+
+	ticker := time.NewTicker(time.Duration(config.AutoscaleInterval) * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-swp.stopCh:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			lag, pending, err := swp.queue.Backlog(ctx)
+			if err != nil {
+				log.Printf("Autoscaler: failed to read queue backlog: %v", err)
+				continue
+			}
+			latency := swp.currentLatency()
+			current := swp.size()
+			instances := queues.GetPartitionAssignment().Members()
+			target, reason := swp.targetWorkers(lag+pending, instances, latency)
+
+			next := target
+			if target < current {
+				next = current - max(1, (current-target)/2)
+			}
+			if next != current {
+				swp.resize(ctx, next)
+				usecases.GetWorkerScaling().Record(usecases.ScalingDecision{
+					At:        time.Now(),
+					From:      current,
+					To:        next,
+					Lag:       lag,
+					Pending:   pending,
+					LatencyMs: float64(latency) / float64(time.Millisecond),
+					Reason:    reason,
+				})
+				log.Printf("Autoscaler: %d -> %d workers, %s", current, next, reason)
+			}
+			usecases.GetWorkerScaling().Update(next, swp.minWorkers, swp.maxWorkers, lag, pending, latency)
+		}
+	}
+}
+
+// targetWorkers returns how many workers drain this instance's even share of
+// backlog within the drain target when each payment takes latency, within the
+// pool bounds. The backlog covers the whole queue, so sizing every instance
+// for all of it would overshoot by the instance count.
+func (swp *StreamWorkerPool) targetWorkers(backlog int64, instances int, latency time.Duration) (int, string) {
+	drainTarget := time.Duration(config.LoadConfig().AutoscaleDrainTarget) * time.Millisecond
+	share := int64(math.Ceil(float64(backlog) / float64(max(instances, 1))))
+	needed := int(math.Ceil(float64(share) * float64(latency) / float64(drainTarget)))
+
+	reason := fmt.Sprintf("backlog %d over %d instances at %s per payment needs %d workers to drain within %s",
+		backlog, max(instances, 1), latency.Round(time.Millisecond), needed, drainTarget)
+	switch {
+	case needed > swp.maxWorkers:
+		return swp.maxWorkers, reason + fmt.Sprintf(", capped at %d", swp.maxWorkers)
+	case needed < swp.minWorkers:
+		return swp.minWorkers, reason + fmt.Sprintf(", floored at %d", swp.minWorkers)
+	}
+	return needed, reason
+}
+
+// resize starts or stops workers until n are running. Stopped workers finish
+// their current batch first, so they leave nothing pending behind.
+func (swp *StreamWorkerPool) resize(ctx context.Context, n int) {
+	swp.mu.Lock()
+	defer swp.mu.Unlock()
+
+	for len(swp.workers) < n {
+		quit := make(chan struct{})
+		consumerName := fmt.Sprintf("%s-worker-%d", swp.hostname, len(swp.workers))
+		swp.workers = append(swp.workers, quit)
+		swp.wg.Add(1)
+		go swp.worker(ctx, consumerName, quit)
+	}
+	for len(swp.workers) > n {
+		last := len(swp.workers) - 1
+		close(swp.workers[last])
+		swp.workers = swp.workers[:last]
+	}
+}
+
+func (swp *StreamWorkerPool) size() int {
+	swp.mu.Lock()
+	defer swp.mu.Unlock()
+	return len(swp.workers)
+}
+
+func (swp *StreamWorkerPool) observeLatency(sample time.Duration) {
+	for {
+		current := swp.latency.Load()
+		next := int64(sample)
+		if current > 0 {
+			next = int64(latencyWeight*float64(sample) + (1-latencyWeight)*float64(current))
+		}
+		if swp.latency.CompareAndSwap(current, next) {
+			return
+		}
+	}
+}
+
+// currentLatency is the moving average of processor calls, or the preferred
+// processor's advertised minimum response time before the first call.
+func (swp *StreamWorkerPool) currentLatency() time.Duration {
+	if latency := swp.latency.Load(); latency > 0 {
+		return time.Duration(latency)
+	}
+	status := usecases.GetProcessorStatus().Get(config.LoadConfig().Processors[0].Name)
+	return max(time.Duration(status.MinResponseTime)*time.Millisecond, time.Millisecond)
+}
@@ -0,0 +1,30 @@
+package workers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTargetWorkers(t *testing.T) {
+	// AUTOSCALE_DRAIN_TARGET_MS defaults to 1000.
+	swp := &StreamWorkerPool{minWorkers: 2, maxWorkers: 20}
+	tests := []struct {
+		backlog   int64
+		instances int
+		latency   time.Duration
+		want      int
+	}{
+		{1000, 1, 10 * time.Millisecond, 10},
+		{1000, 2, 10 * time.Millisecond, 5},
+		{1000, 3, 10 * time.Millisecond, 4},
+		{1000, 0, 10 * time.Millisecond, 10},
+		{10000, 2, 10 * time.Millisecond, 20},
+		{10, 2, 10 * time.Millisecond, 2},
+		{0, 1, 10 * time.Millisecond, 2},
+	}
+	for _, tt := range tests {
+		if got, reason := swp.targetWorkers(tt.backlog, tt.instances, tt.latency); got != tt.want {
+			t.Errorf("targetWorkers(%d, %d, %s) = %d (%s), want %d", tt.backlog, tt.instances, tt.latency, got, reason, tt.want)
+		}
+	}
+}
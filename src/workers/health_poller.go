@@ -0,0 +1,93 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"payment-processor/config"
+	"payment-processor/core/services"
+	"payment-processor/structs"
+	usecases "payment-processor/use_cases"
+	"time"
+)
+
+// leaseCheckInterval is how often instances that do not hold a processor's
+// health lease check whether it is free.
+const leaseCheckInterval = time.Second
+
+// pollHealth polls one processor's health endpoint every
+// HEALTH_POLL_INTERVAL_MS while this instance holds the processor's lease in
+// Redis, so the processor sees one poller for the whole cluster. When the
+// holder stops renewing it, another instance takes over once the lease
+// expires.
+func (swp *StreamWorkerPool) pollHealth(ctx context.Context, processor config.ProcessorConfig) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-swp.stopCh:
+			log.Printf("Health poller %s: Stop signal received, stopping execution", processor.Name)
+			return
+		case <-ctx.Done():
+			log.Printf("Health poller %s: Context canceled, stopping execution", processor.Name)
+			return
+		case <-timer.C:
+			timer.Reset(swp.pollHealthOnce(ctx, processor))
+		}
+	}
+}
+
+// pollHealthOnce polls the processor if this instance holds its lease and
+// returns how long to wait before the next attempt. A failed poll publishes
+// nothing, so the last good status stands until it goes stale; a 429 or 503
+// with Retry-After pushes the next poll, and the lease, past it.
+func (swp *StreamWorkerPool) pollHealthOnce(ctx context.Context, processor config.ProcessorConfig) time.Duration {
+	config := config.LoadConfig()
+	interval := time.Duration(config.HealthPollInterval) * time.Millisecond
+	leaseTTL := time.Duration(config.HealthLeaseTTL) * time.Millisecond
+	key := config.HealthLeasePrefix + processor.Name
+
+	held, err := swp.store.AcquireLease(ctx, key, swp.hostname, leaseTTL)
+	if err != nil {
+		log.Printf("Health poller %s: %v", processor.Name, err)
+		return leaseCheckInterval
+	}
+	if !held {
+		return leaseCheckInterval
+	}
+
+	pollCtx, cancel := context.WithTimeout(ctx, interval)
+	defer cancel()
+	status, err := fetchServiceStatus(pollCtx, processor.HealthCheckURL)
+	var healthErr *services.HealthCheckError
+	if errors.As(err, &healthErr) && healthErr.RetryAfter > interval {
+		log.Printf("Health poller %s: %v, keeping last status and waiting %s", processor.Name, err, healthErr.RetryAfter)
+		if _, err := swp.store.AcquireLease(ctx, key, swp.hostname, healthErr.RetryAfter+leaseTTL); err != nil {
+			log.Printf("Health poller %s: %v", processor.Name, err)
+		}
+		return healthErr.RetryAfter
+	}
+	if err != nil {
+		log.Printf("Health poller %s: %v, keeping last status", processor.Name, err)
+		return interval
+	}
+
+	if err := usecases.GetProcessorStatus().Publish(ctx, swp.store, processor.Name, status); err != nil {
+		log.Printf("Health poller %s: Failed to publish status: %v", processor.Name, err)
+	}
+	return interval
+}
+
+func fetchServiceStatus(ctx context.Context, url string) (structs.ServiceStatus, error) {
+	var status structs.ServiceStatus
+	data, err := services.GetServiceStatusData(ctx, url)
+	if err != nil {
+		return status, err
+	}
+	if err := json.Unmarshal(data, &status); err != nil {
+		return status, fmt.Errorf("invalid health check response: %w", err)
+	}
+	return status, nil
+}
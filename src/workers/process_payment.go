@@ -2,64 +2,94 @@ package workers
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"os"
 	"payment-processor/config"
 	"payment-processor/core/models"
 	"payment-processor/core/services"
-	"payment-processor/infrastructure"
-	"payment-processor/structs"
+	"payment-processor/interfaces"
 	usecases "payment-processor/use_cases"
-	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
-
-	"github.com/redis/go-redis/v9"
 )
 
+// consumeBatchSize is how many messages a worker takes per read. Kept small
+// so that a growing pool spreads the backlog instead of a few workers holding
+// it pending.
+const consumeBatchSize = 10
+
 type StreamWorkerPool struct {
-	redis                 infrastructure.Redis
-	streamName            string
-	groupName             string
-	numWorkers            int
+	store                 interfaces.Store
+	queue                 interfaces.Queue
+	routing               interfaces.RoutingStrategy
+	minWorkers            int
+	maxWorkers            int
+	hostname              string
+	mu                    sync.Mutex
+	workers               []chan struct{}
+	latency               atomic.Int64
 	stopCh                chan struct{}
 	wg                    sync.WaitGroup
 	processPaymentService services.ProcessPaymentService
 	queuePaymentUseCase   usecases.QueuePaymentsUseCase
+	paymentStatusUseCase  usecases.PaymentStatusUseCase
+	webhookUseCase        *usecases.WebhookUseCase
+	deadLetterUseCase     *usecases.DeadLetterUseCase
 }
 
 func NewStreamWorkerPool(
-	redis infrastructure.Redis,
-	streamName,
-	groupName string,
-	numWorkers int,
+	store interfaces.Store,
+	queue interfaces.Queue,
+	routing interfaces.RoutingStrategy,
+	minWorkers,
+	maxWorkers int,
 	processPaymentService services.ProcessPaymentService,
 	queuePaymentUseCase usecases.QueuePaymentsUseCase,
+	paymentStatusUseCase usecases.PaymentStatusUseCase,
+	webhookUseCase *usecases.WebhookUseCase,
+	deadLetterUseCase *usecases.DeadLetterUseCase,
 ) *StreamWorkerPool {
 	return &StreamWorkerPool{
-		redis:                 redis,
-		streamName:            streamName,
-		groupName:             groupName,
-		numWorkers:            numWorkers,
+		store:                 store,
+		queue:                 queue,
+		routing:               routing,
+		minWorkers:            minWorkers,
+		maxWorkers:            max(maxWorkers, minWorkers),
 		stopCh:                make(chan struct{}),
 		processPaymentService: processPaymentService,
 		queuePaymentUseCase:   queuePaymentUseCase,
+		paymentStatusUseCase:  paymentStatusUseCase,
+		webhookUseCase:        webhookUseCase,
+		deadLetterUseCase:     deadLetterUseCase,
 	}
 }
 
 func (swp *StreamWorkerPool) Start(ctx context.Context) error {
-	if err := swp.redis.XGroupCreate(ctx, swp.streamName, swp.groupName); err != nil {
-		return err
+	// The queue may still be unreachable at boot; Consume sets it up again
+	// once it is back, so only log here.
+	if err := swp.queue.Setup(ctx); err != nil {
+		log.Printf("Failed to set up the payments queue, will retry: %v", err)
 	}
 
-	for i := 0; i < swp.numWorkers; i++ {
-		swp.wg.Add(1)
-		go swp.worker(ctx, fmt.Sprintf("worker-%d", i))
+	// Consumer names must be unique across instances, otherwise api1 and api2
+	// would share (and ack) each other's pending entries.
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "local"
+	}
+	swp.hostname = hostname
+	swp.resize(ctx, swp.minWorkers)
+	usecases.GetWorkerScaling().Update(swp.minWorkers, swp.minWorkers, swp.maxWorkers, 0, 0, 0)
+	go swp.autoscale(ctx)
+	for _, processor := range config.LoadConfig().Processors {
+		go swp.pollHealth(ctx, processor)
 	}
-	go swp.getServiceStatusData(ctx)
 
-	log.Printf("Started %d stream workers for %s", swp.numWorkers, swp.streamName)
+	log.Printf("Started %d stream workers for %s", swp.minWorkers, config.LoadConfig().Queue)
 	return nil
 }
 
@@ -69,137 +99,238 @@ func (swp *StreamWorkerPool) Stop() {
 	log.Println("All stream workers stopped")
 }
 
-func (swp *StreamWorkerPool) worker(ctx context.Context, consumerName string) {
+func (swp *StreamWorkerPool) worker(ctx context.Context, consumerName string, quit chan struct{}) {
 	defer swp.wg.Done()
 
+	config := config.LoadConfig()
+	claimInterval := time.Duration(config.ClaimInterval) * time.Millisecond
+	lastClaim := time.Now()
+
 	for {
 		select {
 		case <-swp.stopCh:
 			return
+		case <-quit:
+			return
 		case <-ctx.Done():
 			return
 		default:
-			streams, err := swp.redis.MessagesConsumer(ctx, swp.groupName, consumerName, swp.streamName, 100)
+			if time.Since(lastClaim) >= claimInterval {
+				lastClaim = time.Now()
+				swp.reclaim(ctx, consumerName)
+			}
+
+			messages, err := swp.queue.Consume(ctx, consumerName, consumeBatchSize, time.Second)
 			if err != nil {
-				log.Printf("Worker %s: Stream read error: %v", consumerName, err)
+				log.Printf("Worker %s: Queue read error: %v", consumerName, err)
 				time.Sleep(100 * time.Millisecond)
 				continue
 			}
-			if len(streams) == 0 || len(streams[0].Messages) == 0 {
-				continue
-			}
 
-			for _, stream := range streams {
-				for _, message := range stream.Messages {
-					defaultStatus := swp.getSerializedServiceStatus(ctx, "default")
-					fallbackStatus := swp.getSerializedServiceStatus(ctx, "fallback")
-
-					if defaultStatus.Failing && fallbackStatus.Failing {
-						swp.redis.XAdd(ctx, swp.streamName, message.Values)
-						continue
-					}
-
-					var serviceType string
-
-					if defaultStatus.Failing && !fallbackStatus.Failing {
-						serviceType = "fallback"
-					} else if !defaultStatus.Failing && fallbackStatus.Failing {
-						serviceType = "default"
-					} else {
-						if defaultStatus.MinResponseTime <= fallbackStatus.MinResponseTime {
-							serviceType = "default"
-						} else {
-							serviceType = "fallback"
-						}
-					}
-					success := swp.processPayment(serviceType, message, ctx)
-					if !success {
-						log.Printf("Worker %s: Failed to process payment for message %s", consumerName, message.ID)
-						swp.redis.XAdd(ctx, swp.streamName, message.Values)
-					}
-				}
+			for _, message := range messages {
+				swp.handleMessage(ctx, consumerName, message, false)
 			}
 		}
 	}
 }
 
-func (swp *StreamWorkerPool) processPayment(serviceType string, message redis.XMessage, ctx context.Context) bool {
-
-	// Parse payment data
-	correlationID := message.Values["correlationId"].(string)
-	amount := message.Values["amount"].(string)
-	requestedAt := message.Values["requestedAt"].(string)
-	amountFloat, _ := strconv.ParseFloat(amount, 64)
-
-	paymentData := models.Payment{
-		CorrelationID: correlationID,
-		Amount:        amountFloat,
-		RequestedAt:   requestedAt,
-		Type:          serviceType,
+// reclaim takes over deliveries that another consumer never acked,
+// typically because its instance crashed mid-batch, and processes them.
+func (swp *StreamWorkerPool) reclaim(ctx context.Context, consumerName string) {
+	minIdle := time.Duration(config.LoadConfig().ClaimMinIdle) * time.Millisecond
+	messages, err := swp.queue.Reclaim(ctx, consumerName, minIdle, 100)
+	if err != nil {
+		log.Printf("Worker %s: Failed to reclaim pending messages: %v", consumerName, err)
+		return
 	}
-
-	success := swp.processPaymentService.ProcessPayment(serviceType, paymentData, ctx)
-	if success {
-		parsedTime, _ := time.Parse(time.RFC3339, requestedAt)
-		tsFloat := float64(parsedTime.Unix())
-		swp.queuePaymentUseCase.StoreAsScore(ctx, config.LoadConfig().SetQueue, tsFloat, paymentData)
+	if len(messages) > 0 {
+		log.Printf("Worker %s: Reclaimed %d pending messages", consumerName, len(messages))
+	}
+	for _, message := range messages {
+		swp.handleMessage(ctx, consumerName, message, true)
 	}
-	return true
 }
 
-func (swp *StreamWorkerPool) getSerializedServiceStatus(ctx context.Context, serviceType string) structs.ServiceStatus {
-	config := config.LoadConfig()
-	var data string
-	var status structs.ServiceStatus
-	if serviceType == "default" {
-		data, _ = swp.redis.Get(ctx, config.RedisDefaultServiceStatuskey)
-	} else {
-		data, _ = swp.redis.Get(ctx, config.RedisFallbackServiceStatuskey)
-	}
-
-	if data == "" {
-		return structs.ServiceStatus{
-			Failing:         true,
-			MinResponseTime: 0,
-		}
+// handleMessage processes one queue message and acks it once its outcome is
+// recorded. The routing strategy picks the processor, holds the entry pending
+// or defers it; the entry is also deferred when the processor's circuit
+// breaker refuses the call. A processor failure schedules a delayed retry
+// with one more attempt, or dead-letters the entry after MAX_ATTEMPTS;
+// deferred entries do not spend an attempt. A payment the processor refuses
+// with a 4xx will be refused again, so it is dead-lettered at once. Entries that could not be handled
+// at all are left pending so reclaim redelivers them after CLAIM_MIN_IDLE_MS.
+// A reclaimed entry whose status already says processed was accepted by the
+// processor but not recorded, so only the recording is retried.
+func (swp *StreamWorkerPool) handleMessage(ctx context.Context, consumerName string, message models.QueueMessage, reclaimed bool) {
+	if len(message.Values) == 0 {
+		// Deleted from the queue while pending, nothing left to process.
+		swp.ack(ctx, consumerName, message.ID)
+		return
 	}
-	data = string(data)
-	if err := json.Unmarshal([]byte(data), &status); err != nil {
-		log.Printf("Failed to unmarshal  service status: %v", err)
-		return structs.ServiceStatus{
-			Failing:         true,
-			MinResponseTime: 0,
+
+	entry, err := usecases.ParseQueuedPayment(message)
+	if err != nil {
+		// A malformed entry will never succeed, so it is not retried.
+		log.Printf("Worker %s: Dead-lettering message %s: %v", consumerName, message.ID, err)
+		swp.deadLetter(ctx, consumerName, message, entry, err.Error())
+		return
+	}
+	payment := entry.Payment()
+	if reclaimed {
+		if processor, ok := swp.processedBy(ctx, payment.CorrelationID); ok {
+			log.Printf("Worker %s: Payment %s was already accepted by %s, recording it", consumerName, payment.CorrelationID, processor)
+			swp.complete(ctx, consumerName, message, payment, processor)
+			return
 		}
 	}
-	return status
-}
 
-func (swp *StreamWorkerPool) getServiceStatusData(ctx context.Context) {
-	ticker := time.NewTicker(5 * time.Second)
-	defer ticker.Stop()
-	for {
-		select {
-		case <-swp.stopCh:
-			log.Println("Service status goroutine: Stop signal received, stopping execution")
+	decision := swp.routing.Route(payment, usecases.GetProcessorStatus().State())
+	switch decision.Action {
+	case models.RouteHold:
+		log.Printf("Worker %s: Holding payment %s (%s): %s", consumerName, payment.CorrelationID, swp.routing.Name(), decision.Reason)
+		return
+	case models.RouteRetryLater:
+		log.Printf("Worker %s: Deferring payment %s (%s): %s", consumerName, payment.CorrelationID, swp.routing.Name(), decision.Reason)
+		entry.Deferrals++
+		swp.scheduleRetry(ctx, consumerName, message, entry, decision.Reason)
+		return
+	}
+	serviceType := decision.Processor
+	probe, allowed := usecases.GetCircuitBreakers().Allow(serviceType)
+	if !allowed {
+		// Another worker took the last probe of a half-open breaker.
+		entry.Deferrals++
+		swp.scheduleRetry(ctx, consumerName, message, entry, fmt.Sprintf("circuit breaker of %s is open", serviceType))
+		return
+	}
+	log.Printf("Worker %s: Routing payment %s to %s (%s): %s", consumerName, payment.CorrelationID, serviceType, swp.routing.Name(), decision.Reason)
+
+	swp.trackStatus(swp.paymentStatusUseCase.MarkDispatching(ctx, payment.CorrelationID, serviceType))
+	err = swp.processPayment(serviceType, payment, ctx)
+	usecases.GetCircuitBreakers().Record(ctx, swp.store, serviceType, probe, services.IsProcessorFault(err))
+	if err != nil {
+		log.Printf("Worker %s: Failed to process payment for message %s: %v", consumerName, message.ID, err)
+		action := failureActionFor(err, entry.Attempts+1, config.LoadConfig().MaxAttempts)
+		if action == failureLeavePending {
 			return
-		case <-ctx.Done():
-			log.Println("Service status goroutine: Context canceled, stopping execution")
+		}
+		reason := fmt.Sprintf("attempt %d via %s: %v", entry.Attempts+1, serviceType, err)
+		entry.Attempts++
+		entry.Reasons = append(entry.Reasons, reason)
+		if action == failureDeadLetter {
+			swp.deadLetter(ctx, consumerName, message, entry, reason)
 			return
-		case <-ticker.C:
-			newCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
-			defer cancel()
-			config := config.LoadConfig()
-			defaultStatus, err := services.GetDefaultServiceStatusData(newCtx)
-			if err != nil {
-				log.Printf("Failed to get default service status: %v", err)
-			}
-			swp.redis.Set(ctx, config.RedisDefaultServiceStatuskey, string(defaultStatus))
-			fallbackStatus, err := services.GetFallbackServiceStatusData(newCtx)
-			if err != nil {
-				log.Printf("Failed to get fallback service status: %v", err)
-			}
-			swp.redis.Set(ctx, config.RedisFallbackServiceStatuskey, string(fallbackStatus))
 		}
+		swp.scheduleRetry(ctx, consumerName, message, entry, reason)
+		return
+	}
+	swp.complete(ctx, consumerName, message, payment, serviceType)
+}
+
+// failureAction is what becomes of an entry whose payment call failed.
+type failureAction int
+
+const (
+	// failureLeavePending keeps the entry pending without spending an
+	// attempt, for calls cut short by shutdown.
+	failureLeavePending failureAction = iota
+	failureRetry
+	failureDeadLetter
+)
+
+// failureActionFor decides the fate of an entry whose attempt-th call failed
+// with err. Only processor faults are retried: a payment refused with a 4xx
+// would be refused again.
+func failureActionFor(err error, attempt, maxAttempts int) failureAction {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return failureLeavePending
+	case !services.IsProcessorFault(err), attempt >= maxAttempts:
+		return failureDeadLetter
+	default:
+		return failureRetry
+	}
+}
+
+// complete records a payment processor accepted, then notifies the client and
+// acks the entry. The status is marked processed first: if the summary cannot
+// be written the entry stays pending, and its redelivery finds the status and
+// retries the recording without calling the processor again.
+func (swp *StreamWorkerPool) complete(ctx context.Context, consumerName string, message models.QueueMessage, payment models.Payment, processor string) {
+	swp.trackStatus(swp.paymentStatusUseCase.MarkProcessed(ctx, payment.CorrelationID, processor))
+	payment.Type = processor
+	if err := swp.recordProcessed(ctx, payment); err != nil {
+		log.Printf("Worker %s: Leaving message %s pending: %v", consumerName, message.ID, err)
+		return
+	}
+	swp.trackStatus(swp.webhookUseCase.Notify(ctx, payment, models.ProcessedState(processor), ""))
+	swp.ack(ctx, consumerName, message.ID)
+}
+
+// processedBy reports the processor a payment's status says accepted it. A
+// status that cannot be read counts as not processed.
+func (swp *StreamWorkerPool) processedBy(ctx context.Context, correlationID string) (string, bool) {
+	status, err := swp.paymentStatusUseCase.Get(ctx, correlationID)
+	if err != nil || !strings.HasPrefix(string(status.State), models.PaymentStateProcessedPrefix) {
+		return "", false
 	}
+	return strings.TrimPrefix(string(status.State), models.PaymentStateProcessedPrefix), true
+}
 
+// scheduleRetry hands the entry over to the retry schedule. If that fails the
+// entry stays pending and is reclaimed later.
+func (swp *StreamWorkerPool) scheduleRetry(ctx context.Context, consumerName string, message models.QueueMessage, entry models.QueuedPayment, reason string) {
+	if _, err := swp.queuePaymentUseCase.ScheduleRetry(ctx, message, entry); err != nil {
+		log.Printf("Worker %s: Failed to schedule retry of message %s: %v", consumerName, message.ID, err)
+		return
+	}
+	swp.trackStatus(swp.paymentStatusUseCase.MarkRetrying(ctx, entry.CorrelationID, reason))
+}
+
+// deadLetter moves the entry to the dead-letter queue and notifies the
+// client. If the move fails the entry stays pending and is reclaimed later.
+func (swp *StreamWorkerPool) deadLetter(ctx context.Context, consumerName string, message models.QueueMessage, entry models.QueuedPayment, reason string) {
+	if len(entry.Reasons) == 0 || entry.Reasons[len(entry.Reasons)-1] != reason {
+		entry.Reasons = append(entry.Reasons, reason)
+	}
+	if err := swp.deadLetterUseCase.DeadLetter(ctx, message, entry); err != nil {
+		log.Printf("Worker %s: Failed to dead-letter message %s: %v", consumerName, message.ID, err)
+		return
+	}
+	swp.trackStatus(swp.webhookUseCase.Notify(ctx, entry.Payment(), models.PaymentStateDeadLettered, reason))
+}
+
+func (swp *StreamWorkerPool) ack(ctx context.Context, consumerName, id string) {
+	if err := swp.queue.Ack(ctx, id); err != nil {
+		log.Printf("Worker %s: Failed to ack message %s: %v", consumerName, id, err)
+	}
+}
+
+func (swp *StreamWorkerPool) processPayment(serviceType string, payment models.Payment, ctx context.Context) error {
+	payment.Type = serviceType
+	started := time.Now()
+	err := swp.processPaymentService.ProcessPayment(serviceType, payment, ctx)
+	latency := time.Since(started)
+	swp.observeLatency(latency)
+	usecases.GetProcessorOutcomes().Record(serviceType, latency, services.IsProcessorFault(err))
+	return err
+}
+
+// recordProcessed adds a payment to the summary. Adding the same payment
+// twice leaves a single entry, so a redelivery can safely retry it.
+func (swp *StreamWorkerPool) recordProcessed(ctx context.Context, payment models.Payment) error {
+	parsedTime, _ := time.Parse(time.RFC3339, payment.RequestedAt)
+	tsFloat := float64(parsedTime.Unix())
+	// The summary only needs the amount and processor.
+	payment.CallbackURL = ""
+	if err := swp.queuePaymentUseCase.StoreAsScore(ctx, config.LoadConfig().SetQueue, tsFloat, payment); err != nil {
+		return fmt.Errorf("failed to record processed payment %s: %w", payment.CorrelationID, err)
+	}
+	return nil
+}
+
+func (swp *StreamWorkerPool) trackStatus(err error) {
+	if err != nil {
+		log.Printf("Failed to track payment status: %v", err)
+	}
 }
@@ -0,0 +1,32 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"payment-processor/core/services"
+	"testing"
+)
+
+func TestFailureActionFor(t *testing.T) {
+	timeout := fmt.Errorf("HTTP request failed: %w", context.DeadlineExceeded)
+	tests := []struct {
+		name    string
+		err     error
+		attempt int
+		want    failureAction
+	}{
+		{"timeout", timeout, 1, failureRetry},
+		{"connection error", errors.New("connection refused"), 1, failureRetry},
+		{"5xx", &services.ProcessorStatusError{StatusCode: 503, Status: "503 Service Unavailable"}, 4, failureRetry},
+		{"5xx on the last attempt", &services.ProcessorStatusError{StatusCode: 500, Status: "500 Internal Server Error"}, 5, failureDeadLetter},
+		{"422", &services.ProcessorStatusError{StatusCode: 422, Status: "422 Unprocessable Entity"}, 1, failureDeadLetter},
+		{"400", &services.ProcessorStatusError{StatusCode: 400, Status: "400 Bad Request"}, 1, failureDeadLetter},
+		{"shutdown", fmt.Errorf("HTTP request failed: %w", context.Canceled), 5, failureLeavePending},
+	}
+	for _, tt := range tests {
+		if got := failureActionFor(tt.err, tt.attempt, 5); got != tt.want {
+			t.Errorf("%s: failureActionFor(attempt %d) = %d, want %d", tt.name, tt.attempt, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package workers
+
+import (
+	"context"
+	"log"
+	"payment-processor/config"
+	"payment-processor/core/models"
+	"payment-processor/core/services"
+	usecases "payment-processor/use_cases"
+	"sync"
+	"time"
+)
+
+const webhookBatchSize = 50
+
+// WebhookDispatcher polls the webhook schedule and delivers due
+// notifications. Deliveries are claimed with a lease, so several instances
+// can run a dispatcher against the same Redis.
+type WebhookDispatcher struct {
+	webhookUseCase *usecases.WebhookUseCase
+	webhookService *services.WebhookService
+	stopCh         chan struct{}
+	wg             sync.WaitGroup
+}
+
+func NewWebhookDispatcher(
+	webhookUseCase *usecases.WebhookUseCase,
+	webhookService *services.WebhookService,
+) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		webhookUseCase: webhookUseCase,
+		webhookService: webhookService,
+		stopCh:         make(chan struct{}),
+	}
+}
+
+func (wd *WebhookDispatcher) Start(ctx context.Context) {
+	wd.wg.Add(1)
+	go wd.run(ctx)
+	log.Println("Started webhook dispatcher")
+}
+
+func (wd *WebhookDispatcher) Stop() {
+	close(wd.stopCh)
+	wd.wg.Wait()
+	log.Println("Webhook dispatcher stopped")
+}
+
+func (wd *WebhookDispatcher) run(ctx context.Context) {
+	defer wd.wg.Done()
+
+	ticker := time.NewTicker(time.Duration(config.LoadConfig().Webhooks.PollInterval) * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-wd.stopCh:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deliveries, err := wd.webhookUseCase.ClaimDue(ctx, webhookBatchSize)
+			if err != nil {
+				log.Printf("Failed to claim webhook deliveries: %v", err)
+				continue
+			}
+
+			var wg sync.WaitGroup
+			for _, delivery := range deliveries {
+				wg.Add(1)
+				go func(delivery models.WebhookDelivery) {
+					defer wg.Done()
+					wd.deliver(ctx, delivery)
+				}(delivery)
+			}
+			wg.Wait()
+		}
+	}
+}
+
+func (wd *WebhookDispatcher) deliver(ctx context.Context, delivery models.WebhookDelivery) {
+	start := time.Now()
+	statusCode, err := wd.webhookService.Send(ctx, delivery.URL, delivery.CorrelationID, []byte(delivery.Payload))
+	if err != nil {
+		log.Printf("Webhook delivery %s attempt %d failed: %v", delivery.CorrelationID, delivery.Attempts+1, err)
+	}
+	if err := wd.webhookUseCase.RecordAttempt(ctx, delivery, statusCode, err, time.Since(start)); err != nil {
+		log.Printf("Failed to record webhook attempt %s: %v", delivery.CorrelationID, err)
+	}
+}